@@ -0,0 +1,200 @@
+package fsm
+
+import "time"
+
+// Span is the part of the source a syntax node was parsed from
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+func (span Span) GetSpan() Span {
+	return span
+}
+
+type Node interface {
+	GetSpan() Span
+}
+
+// File is the syntax tree of a single .aml source. The top level declarations belong to the model
+// named by 'model MY_MODEL', Models are the ones declared as blocks.
+type File struct {
+	Span
+	FileName string
+	Syntax   *SyntaxDecl
+	Model    *ModelDecl
+	Models   []*ModelDecl
+	Declarations
+}
+
+// Declarations are the enums, variables and states of a model, along with the files included into it
+type Declarations struct {
+	Includes  []*IncludeDecl
+	Enums     []*EnumDecl
+	Variables []*VarDecl
+	Events    []*EventDecl
+	States    []*StateDecl
+	Choices   []*ChoiceDecl
+}
+
+// isEmpty reports if there is nothing declared, neither directly nor by the included files
+func (declarations *Declarations) isEmpty() bool {
+	if len(declarations.Enums) > 0 || len(declarations.Variables) > 0 || len(declarations.Events) > 0 || len(declarations.States) > 0 || len(declarations.Choices) > 0 {
+		return false
+	}
+	for _, include := range declarations.Includes {
+		if include.File != nil && !include.File.isEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// GetModels returns the models of the file, the top level declarations first when there are any.
+// Models declared as blocks in files included at the top level are part of the file as well.
+func (file *File) GetModels() []*ModelDecl {
+	models := []*ModelDecl{}
+	if len(file.Models) == 0 || !file.isEmpty() {
+		topLevel := &ModelDecl{Span: file.Span, FileName: file.FileName, Declarations: file.Declarations}
+		if file.Model != nil {
+			topLevel.Span = file.Model.Span
+			topLevel.Name = file.Model.Name
+		}
+		models = append(models, topLevel)
+	}
+	return append(models, file.blockModels()...)
+}
+
+func (file *File) blockModels() []*ModelDecl {
+	models := []*ModelDecl{}
+	for _, include := range file.Includes {
+		if include.File != nil {
+			models = append(models, include.File.blockModels()...)
+		}
+	}
+	return append(models, file.Models...)
+}
+
+// SyntaxDecl: syntax fsm
+type SyntaxDecl struct {
+	Span
+	Name string
+}
+
+// ModelDecl: model MY_MODEL, or model MY_MODEL { ... } with the declarations in the block
+type ModelDecl struct {
+	Span
+	FileName string
+	Name     string
+	Block    bool
+	Declarations
+}
+
+// IncludeDecl: include "common.aml" or import "common.aml", the path is relative to the including file.
+// The declarations of the file are merged into the model, an import only merges a file once.
+// File is set once the directive is resolved.
+type IncludeDecl struct {
+	Span
+	Path   string
+	Import bool
+	File   *File
+}
+
+// EnumDecl: enum Color { RED, GREEN, BLUE }
+type EnumDecl struct {
+	Span
+	Name    string
+	Members []*EnumMember
+}
+
+type EnumMember struct {
+	Span
+	Name string
+}
+
+// VarDecl: var i: int = 10. Untyped declarations take the rest of the line as the value,
+// when that is not a single literal it becomes a string and Unquoted is set.
+type VarDecl struct {
+	Span
+	Name     string
+	Type     *TypeRef
+	Value    Expr
+	Unquoted bool
+}
+
+// EventDecl: event PAYMENT(amount: float), the parameters are variables in the guards and updates of transitions on the event
+type EventDecl struct {
+	Span
+	Name       string
+	Parameters []*ParameterDecl
+}
+
+type ParameterDecl struct {
+	Span
+	Name string
+	Type *TypeRef
+}
+
+// TypeRef names a type: int, float, bool, string or a declared enum
+type TypeRef struct {
+	Span
+	Name string
+}
+
+// StateDecl: [init] state STATE_1 { ... }, States are the substates declared within.
+// The substates of a parallel state are regions that are all active at once.
+type StateDecl struct {
+	Span
+	Name             string
+	Initial          bool
+	Parallel         bool
+	States           []*StateDecl
+	Entry            []*ComputationDecl
+	Exit             []*ComputationDecl
+	AutoComputations []*ComputationDecl
+	AutoEvents       []*TransitionDecl
+	Transitions      []*TransitionDecl
+	Timers           []*TransitionDecl
+}
+
+// ChoiceDecl: choice CHECK { (guard) -> STATE (update) ... else -> STATE }, a pseudo-state that a transition
+// passes through on its way to the state of the first branch whose guard holds
+type ChoiceDecl struct {
+	Span
+	Name     string
+	Branches []*TransitionDecl
+	Else     *TransitionDecl
+}
+
+// TransitionDecl covers event transitions (EVENT (guard) -> STATE (update)), auto-events (|> guard -> STATE (update))
+// and timed transitions (after 500ms (guard) -> STATE (update)), the latter two have no Event.
+// Timed transitions have a Delay, Repeat is set for every.
+type TransitionDecl struct {
+	Span
+	Event     string
+	Delay     time.Duration
+	Repeat    bool
+	Guard     []Expr
+	Target    string
+	Terminate bool
+	Updates   []*ComputationDecl
+	Raw       string
+	RawGuard  string
+	RawUpdate string
+}
+
+// ComputationDecl: total = price * qty + tax, or send OTHER.EVENT and raise EVENT when Send is set
+type ComputationDecl struct {
+	Span
+	Left     string
+	Operator ArithmeticSymbol
+	Right    Expr
+	Send     *SendDecl
+}
+
+// SendDecl: send OTHER.EVENT, or raise EVENT when there is no Model
+type SendDecl struct {
+	Span
+	Model string
+	Event string
+}
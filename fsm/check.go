@@ -0,0 +1,235 @@
+package fsm
+
+// typeChecker infers the types of expressions against the declared variables,
+// every mismatch is reported as a diagnostic
+type typeChecker struct {
+	fileName    string
+	variables   *Variables
+	diagnostics *Diagnostics
+}
+
+// TypeCheck checks every condition and computation of the model against the declared variables
+func (fsm *FiniteStateMachine) TypeCheck() Diagnostics {
+	return typeCheck(fsm.states, fsm.choices, &fsm.variables, fsm.events)
+}
+
+func typeCheck(states map[string]*State, choices map[string]*Choice, variables *Variables, events map[string][]Parameter) Diagnostics {
+	diagnostics := Diagnostics{}
+	checker := typeChecker{
+		variables:   variables,
+		diagnostics: &diagnostics,
+	}
+	for _, stateName := range sortedKeys(states) {
+		state := states[stateName]
+		checker.checkComputational(state.entry)
+		checker.checkComputational(state.exit)
+		checker.checkComputational(state.defaultComputations)
+		for _, autoEvent := range state.autoEvents {
+			checker.checkConditionals(autoEvent.conditions)
+			checker.checkComputational(autoEvent.compuatations)
+		}
+		for _, event := range sortedKeys(state.transitions) {
+			checker.variables = withParameters(variables, events[event])
+			for _, edge := range state.transitions[event] {
+				checker.checkConditionals(edge.condition2)
+				checker.checkComputational(edge.computation2)
+			}
+			checker.variables = variables
+		}
+		for _, timer := range state.timers {
+			checker.checkConditionals(timer.edge.condition2)
+			checker.checkComputational(timer.edge.computation2)
+		}
+	}
+	for _, choiceName := range sortedKeys(choices) {
+		choice := choices[choiceName]
+		for _, branch := range choice.branches {
+			checker.checkConditionals(branch.condition2)
+			checker.checkComputational(branch.computation2)
+		}
+		choice.otherwise.HasValue(func(otherwise *Edge) {
+			checker.checkComputational(otherwise.computation2)
+		})
+	}
+	return diagnostics
+}
+
+func (checker *typeChecker) checkConditionals(conditionals Conditionals) {
+	for i := range conditionals.Conditions {
+		checker.checkCondition(conditionals.Conditions[i].Expr())
+	}
+}
+
+func (checker *typeChecker) checkComputational(computational Computational) {
+	for i := range computational.Computations {
+		computation := &computational.Computations[i]
+		if computation.Send.IsSome() {
+			continue
+		}
+		checker.checkComputation(computation.Left, computation.Operator, computation.Expr(), computation.Expr().GetSpan())
+	}
+}
+
+// checkCondition reports guards that are not well typed bools
+func (checker *typeChecker) checkCondition(expr Expr) bool {
+	valueType, ok := checker.checkExpr(expr)
+	if ok && valueType != BOOL {
+		checker.errorf(expr, "a condition must be a bool, got %s", valueType)
+		return false
+	}
+	return ok
+}
+
+// checkComputation reports assignments of values the variable cannot hold, such as 'b += 1' on a bool
+func (checker *typeChecker) checkComputation(left string, operator ArithmeticSymbol, right Expr, span Span) (VariableType, bool) {
+	leftType, isDeclared := checker.variables.types[left]
+	if !isDeclared {
+		checker.diagnostics.Errorf(checker.fileName, span, CODE_UNDECLARED_VARIABLE, "variable '%s' is not declared", left)
+		return leftType, false
+	}
+	rightType, ok := checker.checkAgainst(right, checker.variables.enumTypes[left])
+	if !ok {
+		return leftType, false
+	}
+	if leftType == ENUM && rightType == ENUM && enumOf(right) != checker.variables.enumTypes[left] {
+		checker.diagnostics.Errorf(checker.fileName, span, CODE_TYPE_MISMATCH, "cannot assign %s '%s' to %s variable '%s'", enumOf(right), right, checker.variables.enumTypes[left], left)
+		return leftType, false
+	}
+	if !assignable(leftType, operator, rightType) {
+		checker.diagnostics.Errorf(checker.fileName, span, CODE_TYPE_MISMATCH, "cannot use %s '%s' with %s variable '%s'", operator.ASToString(), typeName(right, rightType), checker.variableTypeName(left), left)
+		return leftType, false
+	}
+	return leftType, true
+}
+
+// checkExpr returns the type of the expression, false when it is not well typed.
+// Variable references are resolved to their declared type along the way.
+func (checker *typeChecker) checkExpr(expr Expr) (VariableType, bool) {
+	switch node := expr.(type) {
+	case *Literal:
+		return node.Type, true
+	case *VarRef:
+		valueType, isDeclared := checker.variables.types[node.Name]
+		if !isDeclared {
+			if enum, isMember := checker.variables.memberOf(node.Name); isMember {
+				node.Type, node.Enum = ENUM, enum.Name
+				return ENUM, true
+			}
+			checker.diagnostics.Errorf(checker.fileName, node.Span, CODE_UNDECLARED_VARIABLE, "variable '%s' is not declared", node.Name)
+			return valueType, false
+		}
+		node.Type, node.Enum = valueType, checker.variables.enumTypes[node.Name]
+		return valueType, true
+	case *NotExpr:
+		operand, ok := checker.checkExpr(node.Operand)
+		if ok && operand != BOOL {
+			checker.errorf(node, "'!' is not defined for %s", operand)
+			return BOOL, false
+		}
+		return BOOL, ok
+	case *NegateExpr:
+		operand, ok := checker.checkExpr(node.Operand)
+		if ok && !isNumeric(operand) {
+			checker.errorf(node, "'-' is not defined for %s", operand)
+			return operand, false
+		}
+		return operand, ok
+	case *LogicExpr:
+		left, leftOk := checker.checkAgainst(node.Left, checker.enumHint(node.Right))
+		right, rightOk := checker.checkAgainst(node.Right, checker.enumHint(node.Left))
+		if !leftOk || !rightOk {
+			return BOOL, false
+		}
+		var valid bool
+		switch node.Symbol {
+		case AND, OR:
+			valid = left == BOOL && right == BOOL
+		case EQUAL, NOT_EQUAL:
+			valid = (left == right && enumOf(node.Left) == enumOf(node.Right)) || (isNumeric(left) && isNumeric(right))
+		default:
+			valid = (isNumeric(left) && isNumeric(right)) || (left == STRING && right == STRING)
+		}
+		if !valid {
+			checker.errorf(node, "'%s' is not defined for %s and %s", node.Symbol.LSToString(), typeName(node.Left, left), typeName(node.Right, right))
+		}
+		return BOOL, valid
+	case *ArithmeticExpr:
+		left, leftOk := checker.checkExpr(node.Left)
+		right, rightOk := checker.checkExpr(node.Right)
+		if !leftOk || !rightOk {
+			return left, false
+		}
+		var valid bool
+		switch node.Symbol {
+		case ADD:
+			valid = (isNumeric(left) && isNumeric(right)) || (left == STRING && right == STRING)
+		case MODULO:
+			valid = left == INT && right == INT
+		default:
+			valid = isNumeric(left) && isNumeric(right)
+		}
+		if !valid {
+			checker.errorf(node, "'%s' is not defined for %s and %s", node.Symbol.ASToString(), left, right)
+		}
+		return ExprType(node), valid
+	default:
+		return STRING, false
+	}
+}
+
+// checkAgainst checks an operand compared with or assigned to a value of the enum,
+// so a misspelled member is reported as such rather than as an undeclared variable
+func (checker *typeChecker) checkAgainst(expr Expr, enumName string) (VariableType, bool) {
+	ref, isRef := expr.(*VarRef)
+	if !isRef || len(enumName) == 0 {
+		return checker.checkExpr(expr)
+	}
+	if _, isDeclared := checker.variables.types[ref.Name]; isDeclared {
+		return checker.checkExpr(expr)
+	}
+	if enum, declared := checker.variables.enums[enumName]; !declared || !enum.Has(ref.Name) {
+		checker.diagnostics.Errorf(checker.fileName, ref.Span, CODE_UNKNOWN_MEMBER, "'%s' is not a member of enum %s", ref.Name, enumName)
+		return ENUM, false
+	}
+	ref.Type, ref.Enum = ENUM, enumName
+	return ENUM, true
+}
+
+// enumHint is the enum of an operand that is an enum variable
+func (checker *typeChecker) enumHint(expr Expr) string {
+	if ref, isRef := expr.(*VarRef); isRef {
+		return checker.variables.enumTypes[ref.Name]
+	}
+	return ""
+}
+
+// enumOf is the enum of a checked expression, empty when it is not an enum
+func enumOf(expr Expr) string {
+	if ref, isRef := expr.(*VarRef); isRef && ref.Type == ENUM {
+		return ref.Enum
+	}
+	return ""
+}
+
+func (checker *typeChecker) variableTypeName(name string) string {
+	if enumName, isEnum := checker.variables.enumTypes[name]; isEnum {
+		return enumName
+	}
+	return checker.variables.types[name].String()
+}
+
+// typeName names the enum of enum operands in messages
+func typeName(expr Expr, valueType VariableType) string {
+	if valueType == ENUM {
+		return enumOf(expr)
+	}
+	return valueType.String()
+}
+
+func (checker *typeChecker) errorf(node Node, format string, args ...any) {
+	checker.diagnostics.Errorf(checker.fileName, node.GetSpan(), CODE_TYPE_MISMATCH, format, args...)
+}
+
+func isNumeric(valueType VariableType) bool {
+	return valueType == INT || valueType == FLOAT
+}
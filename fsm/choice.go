@@ -0,0 +1,137 @@
+package fsm
+
+import (
+	"fmt"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/functions"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+// Choice is a pseudo-state, a transition to it continues on the first branch whose guard holds,
+// or on the else branch when none does. Choices are never active, they are passed through within a single step.
+type Choice struct {
+	name      string
+	branches  []*Edge
+	otherwise types.Option[*Edge]
+}
+
+func (choice *Choice) GetName() string {
+	return choice.name
+}
+
+// GetBranches returns the guarded branches in the order they are tried, without the else branch
+func (choice *Choice) GetBranches() []*Edge {
+	return choice.branches
+}
+
+func (choice *Choice) GetElse() types.Option[*Edge] {
+	return choice.otherwise
+}
+
+// choose returns the first branch whose guard holds, else the else branch. The outcome of every guard is passed to evaluated.
+func (choice *Choice) choose(variables *Variables, evaluated func(edge *Edge, holds bool)) (*Edge, error) {
+	for _, branch := range choice.branches {
+		holds, err := branch.holds(variables)
+		if err != nil {
+			return nil, err
+		}
+		evaluated(branch, holds)
+		if holds {
+			return branch, nil
+		}
+	}
+	if choice.otherwise.IsNone() {
+		return nil, fmt.Errorf("No branch of choice %s holds and it has no else branch", choice.name)
+	}
+	return choice.otherwise.Get(), nil
+}
+
+type ChoiceBuilder struct {
+	name      string
+	branches  []*Edge
+	otherwise types.Option[*Edge]
+}
+
+// When declares a branch, give it a guard with And2, branches are tried in the order they are declared
+func (builder *ChoiceBuilder) When(f functions.Consumer[*EdgeBuilder]) *ChoiceBuilder {
+	edgeBuilder := newEdgeBuilder()
+	f(&edgeBuilder)
+	edgeBuilder.computation2.FuncSignature = "func()"
+	edge := edgeBuilder.build()
+	builder.branches = append(builder.branches, &edge)
+	return builder
+}
+
+// Else declares the branch taken when no guard holds
+func (builder *ChoiceBuilder) Else(f functions.Consumer[*EdgeBuilder]) *ChoiceBuilder {
+	edgeBuilder := newEdgeBuilder()
+	f(&edgeBuilder)
+	edgeBuilder.computation2.FuncSignature = "func()"
+	edge := edgeBuilder.build()
+	builder.otherwise = types.Some(&edge)
+	return builder
+}
+
+// Choice declares a choice pseudo-state, transitions and branches name it like a state
+func (fsm *FsmBuilder) Choice(name string, f functions.Consumer[*ChoiceBuilder]) *FsmBuilder {
+	cb := ChoiceBuilder{name: name, otherwise: types.None[*Edge]()}
+	f(&cb)
+	_, isState := fsm.states[name]
+	_, isChoice := fsm.choices[name]
+	if isState || isChoice {
+		fsm.duplicates = append(fsm.duplicates, name)
+	}
+	fsm.choices[name] = &Choice{name: cb.name, branches: cb.branches, otherwise: cb.otherwise}
+	return fsm
+}
+
+// GetChoices returns the choice pseudo-states by name
+func (fsm *FiniteStateMachine) GetChoices() map[string]*Choice {
+	return fsm.choices
+}
+
+// takeEdge applies the transition of the edge from the source. A transition to a choice runs its update and follows
+// the branches of the choices until it reaches a state, which is then entered from the source like any other target.
+func (fsm *FiniteStateMachine) takeEdge(source *State, edge *Edge) (mode.Mode, error) {
+	targetName := edge.resultingState.Get()
+	if _, isChoice := fsm.choices[targetName]; !isChoice {
+		target, hasState := fsm.states[targetName]
+		if !hasState {
+			return mode.CRASH, &UnknownTargetStateError{Source: source.name, Target: targetName}
+		}
+		return mode.CONTINUE, fsm.applyTransition(source, target, edge.compute)
+	}
+	if err := edge.compute(&fsm.variables, fsm.send); err != nil {
+		return mode.CRASH, err
+	}
+	for passed := 0; ; passed++ {
+		choice, isChoice := fsm.choices[targetName]
+		if !isChoice {
+			break
+		}
+		if passed == len(fsm.choices) {
+			return mode.CRASH, fmt.Errorf("Choice %s leads back to itself", choice.name)
+		}
+		branch, err := choice.choose(&fsm.variables, fsm.evaluated(source, fsm.step.Event))
+		if err != nil {
+			return mode.CRASH, err
+		}
+		fsm.logger.Debugf("Choice [%s] -> [%s]", choice.name, branch.resultingState.GetOrElse("terminate"))
+		if branch.terminate == mode.TERMINATE {
+			return mode.TERMINATE, nil
+		}
+		if err := branch.compute(&fsm.variables, fsm.send); err != nil {
+			return mode.CRASH, err
+		}
+		targetName = branch.resultingState.Get()
+	}
+	target, hasState := fsm.states[targetName]
+	if !hasState {
+		return mode.CRASH, &UnknownTargetStateError{Source: source.name, Target: targetName}
+	}
+	// the updates already ran, only the states between the source and the target are left and entered
+	return mode.CONTINUE, fsm.applyTransition(source, target, func(*Variables, func(Message)) error {
+		return nil
+	})
+}
@@ -3,17 +3,171 @@ package fsm
 import (
 	"fmt"
 	"strings"
+
+	"github.com/Wafl97/go_aml/util/types"
 )
 
+// Computation assigns to Left. The value is Expression when set,
+// otherwise the raw Right as written in the source.
+// A computation with Send sends an event to a model of the system instead.
+// A computation the loader could not type check crashes the model when it runs.
 type Computation struct {
-	Left      string
-	Operator  ArithmeticSymbol
-	Right     any
-	ValueType VariableType
+	Left       string
+	Operator   ArithmeticSymbol
+	Right      any
+	ValueType  VariableType
+	Expression Expr
+	Send       types.Option[Message]
+	invalid    bool
+}
+
+// Message is an event sent to a model of a system, send OTHER.EVENT,
+// or raised in the model itself when there is no Model, raise EVENT
+type Message struct {
+	Model string
+	Event string
+}
+
+// IsRaised reports if the event is raised in the model sending it
+func (message Message) IsRaised() bool {
+	return len(message.Model) == 0
+}
+
+func (message Message) String() string {
+	if message.IsRaised() {
+		return message.Event
+	}
+	return message.Model + "." + message.Event
+}
+
+// ParseMessage splits MODEL.EVENT at the first dot
+func ParseMessage(str string) (Message, bool) {
+	model, event, found := strings.Cut(str, ".")
+	if !found || len(model) == 0 || len(event) == 0 {
+		return Message{}, false
+	}
+	return Message{Model: model, Event: event}, true
 }
 
 func (computation *Computation) ToString() string {
-	return fmt.Sprintf("%s %s %v", computation.Left, computation.Operator.ASToString(), computation.Right)
+	if computation.Send.IsSome() && computation.Send.Get().IsRaised() {
+		return fmt.Sprintf("raise(%q)", computation.Send.Get().Event)
+	}
+	if computation.Send.IsSome() {
+		return fmt.Sprintf("send(%q, %q)", computation.Send.Get().Model, computation.Send.Get().Event)
+	}
+	if computation.Expression == nil {
+		return fmt.Sprintf("%s %s %v", computation.Left, computation.Operator.ASToString(), computation.Right)
+	}
+	right := GenerateExpr(computation.Expression)
+	if computation.ValueType == FLOAT {
+		right = generateAsFloat(computation.Expression, 0)
+	}
+	return fmt.Sprintf("%s %s %s", computation.Left, computation.Operator.ASToString(), right)
+}
+
+// Expr returns the right hand side as an expression tree
+func (computation *Computation) Expr() Expr {
+	if computation.Expression != nil {
+		return computation.Expression
+	}
+	if raw, isRaw := computation.Right.(string); isRaw {
+		// the older computations keep the right side as written in the source
+		if parsed, diagnostics := ParseExpression(raw); !diagnostics.HasErrors() {
+			return parsed
+		}
+	}
+	return NewLiteral(computation.Right)
+}
+
+// Execute evaluates the right hand side and stores the result in the variable.
+// Sending needs a system to deliver the event and raising needs a model to queue it, see Computational.Run.
+func (computation *Computation) Execute(variables *Variables) error {
+	if computation.invalid {
+		return fmt.Errorf("the computation of '%s' did not type check", computation.Left)
+	}
+	if computation.Send.IsSome() && computation.Send.Get().IsRaised() {
+		return fmt.Errorf("cannot raise %s outside of a model", computation.Send.Get())
+	}
+	if computation.Send.IsSome() {
+		return fmt.Errorf("cannot send %s outside of a system", computation.Send.Get())
+	}
+	right, err := variables.Evaluate(computation.Expr())
+	if err != nil {
+		return err
+	}
+	value := right
+	if computation.Operator != ASSIGN {
+		current, declared := variables.values[computation.Left]
+		if !declared {
+			return fmt.Errorf("variable '%s' is not declared", computation.Left)
+		}
+		value, err = arithmetic(computation.Operator.arithmetic(), normalize(current), right)
+		if err != nil {
+			return err
+		}
+	}
+	value, err = convert(value, computation.ValueType)
+	if err != nil {
+		return fmt.Errorf("cannot assign to '%s', %s", computation.Left, err.Error())
+	}
+	variables.Set(computation.Left, value)
+	return nil
+}
+
+// arithmetic maps a compound assignment (+=) to its operation (+)
+func (symbol ArithmeticSymbol) arithmetic() ArithmeticSymbol {
+	switch symbol {
+	case ADD_ASSIGN:
+		return ADD
+	case SUB_ASSIGN:
+		return SUBTRACT
+	case MUL_ASSIGN:
+		return MULTIPLY
+	case DIV_ASSIGN:
+		return DIVIDE
+	default:
+		return symbol
+	}
+}
+
+// assignable reports if a value of type right can be assigned to a variable of type left with the operator
+func assignable(left VariableType, operator ArithmeticSymbol, right VariableType) bool {
+	compatible := left == right || (left == FLOAT && right == INT)
+	switch operator {
+	case ASSIGN:
+		return compatible
+	case ADD_ASSIGN:
+		return compatible && left != BOOL && left != ENUM
+	default:
+		return compatible && (left == INT || left == FLOAT)
+	}
+}
+
+// convert stores an evaluated value as the declared type of a variable
+func convert(value any, valueType VariableType) (any, error) {
+	switch v := value.(type) {
+	case int64:
+		switch valueType {
+		case INT:
+			return v, nil
+		case FLOAT:
+			return float64(v), nil
+		}
+	case float64:
+		if valueType == FLOAT {
+			return v, nil
+		}
+	case bool:
+		if valueType == BOOL {
+			return v, nil
+		}
+	case string:
+		if valueType == STRING || valueType == ENUM {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%T is not a %s", value, valueType)
 }
 
 type Computational struct {
@@ -21,6 +175,26 @@ type Computational struct {
 	Computations  []Computation
 }
 
+// Execute runs the computations in order, stopping at the first that fails
+func (computational Computational) Execute(variables *Variables) error {
+	return computational.Run(variables, nil)
+}
+
+// Run is Execute with the sent and raised messages passed to send, send may be nil when nothing can be sent
+func (computational Computational) Run(variables *Variables, send func(Message)) error {
+	for i := range computational.Computations {
+		computation := &computational.Computations[i]
+		if computation.Send.IsSome() && send != nil {
+			send(computation.Send.Get())
+			continue
+		}
+		if err := computation.Execute(variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (computational Computational) Generate() string {
 	switch len(computational.Computations) {
 	case 0:
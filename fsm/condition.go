@@ -5,14 +5,24 @@ import (
 	"strings"
 )
 
+// Condition is either a full expression (Expression) or the older
+// 'Left Symbol Right' comparison, which is used when Expression is nil
 type Condition struct {
-	Left      string
-	Symbol    LogicSymbol
-	Right     any
-	ValueType VariableType
+	Left       string
+	Symbol     LogicSymbol
+	Right      any
+	ValueType  VariableType
+	Expression Expr
 }
 
 func (condition *Condition) ToString() string {
+	return condition.toString(0)
+}
+
+func (condition *Condition) toString(parentPrecedence int) string {
+	if condition.Expression != nil {
+		return printExpr(condition.Expression, parentPrecedence, true)
+	}
 	switch condition.ValueType {
 	case BOOL:
 		switch condition.Right {
@@ -27,18 +37,59 @@ func (condition *Condition) ToString() string {
 	return ""
 }
 
+// Expr returns the condition as an expression tree
+func (condition *Condition) Expr() Expr {
+	if condition.Expression != nil {
+		return condition.Expression
+	}
+	left := &VarRef{Name: condition.Left, Type: condition.ValueType}
+	var right Expr = NewLiteral(condition.Right)
+	if raw, isRaw := condition.Right.(string); isRaw {
+		// the older conditions keep the right side as written in the source
+		if parsed, diagnostics := ParseExpression(raw); !diagnostics.HasErrors() {
+			right = parsed
+		}
+	}
+	return &LogicExpr{Symbol: condition.Symbol, Left: left, Right: right}
+}
+
 type Conditionals struct {
 	Conditions []Condition
 }
 
+// Expr joins the conditions into a single expression, nil when there are no conditions
+func (conditionals Conditionals) Expr() Expr {
+	var joined Expr
+	for i := range conditionals.Conditions {
+		expr := conditionals.Conditions[i].Expr()
+		if joined == nil {
+			joined = expr
+			continue
+		}
+		joined = &LogicExpr{Symbol: AND, Left: joined, Right: expr}
+	}
+	return joined
+}
+
+// Evaluate checks that every condition holds, no conditions always hold
+func (conditionals Conditionals) Evaluate(variables *Variables) (bool, error) {
+	expr := conditionals.Expr()
+	if expr == nil {
+		return true, nil
+	}
+	return variables.EvaluateBool(expr)
+}
+
 func (conditionals Conditionals) Generate() string {
 	switch len(conditionals.Conditions) {
 	case 0:
 		return "nil"
+	case 1:
+		return fmt.Sprintf("func() bool { return %s }", conditionals.Conditions[0].ToString())
 	default:
 		conditionalStrings := make([]string, len(conditionals.Conditions))
 		for i := 0; i < len(conditionalStrings); i++ {
-			conditionalStrings[i] = (conditionals.Conditions)[i].ToString()
+			conditionalStrings[i] = (conditionals.Conditions)[i].toString(precedenceAnd)
 		}
 		return fmt.Sprintf("func() bool { return %s }", strings.Join(conditionalStrings, " && "))
 	}
@@ -0,0 +1,233 @@
+package fsm
+
+import (
+	"strings"
+)
+
+// Configuration names the active innermost states, one for each active region in the order they are declared
+type Configuration []string
+
+func (configuration Configuration) String() string {
+	return strings.Join(configuration, ", ")
+}
+
+func (configuration Configuration) Contains(state string) bool {
+	for _, active := range configuration {
+		if active == state {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConfiguration returns the active innermost states
+func (fsm *FiniteStateMachine) GetConfiguration() Configuration {
+	configuration := make(Configuration, len(fsm.configuration))
+	for i, state := range fsm.configuration {
+		configuration[i] = state.name
+	}
+	return configuration
+}
+
+// GetActiveStates returns the active states and their ancestors, outermost first
+func (fsm *FiniteStateMachine) GetActiveStates() []string {
+	active := []string{}
+	seen := map[string]bool{}
+	for _, leaf := range fsm.configuration {
+		path := []string{}
+		for state := leaf; state != nil; state = fsm.states[state.parent] {
+			path = append([]string{state.name}, path...)
+		}
+		for _, state := range path {
+			if !seen[state] {
+				seen[state] = true
+				active = append(active, state)
+			}
+		}
+	}
+	return active
+}
+
+// IsIn reports if the state is active, either as an innermost state or as an ancestor of one
+func (fsm *FiniteStateMachine) IsIn(state string) bool {
+	for _, active := range fsm.GetActiveStates() {
+		if active == state {
+			return true
+		}
+	}
+	return false
+}
+
+// GetActiveTriggers returns the events with transitions from any of the active states
+func (fsm *FiniteStateMachine) GetActiveTriggers() []string {
+	triggers := []string{}
+	seen := map[string]bool{}
+	for _, stateName := range fsm.GetActiveStates() {
+		for _, trigger := range fsm.states[stateName].GetEdgeTriggers() {
+			if !seen[trigger] {
+				seen[trigger] = true
+				triggers = append(triggers, trigger)
+			}
+		}
+	}
+	return triggers
+}
+
+func (fsm *FiniteStateMachine) isActive(leaf *State) bool {
+	for _, active := range fsm.configuration {
+		if active == leaf {
+			return true
+		}
+	}
+	return false
+}
+
+// enter returns the innermost states entered with the state, following the initial substates
+// and entering every region of a parallel state
+func (fsm *FiniteStateMachine) enter(state *State) []*State {
+	if state.parallel && len(state.children) > 0 {
+		entered := []*State{}
+		for _, region := range state.children {
+			entered = append(entered, fsm.enter(fsm.states[region])...)
+		}
+		return entered
+	}
+	if initial, hasInitial := fsm.states[state.initial]; hasInitial {
+		return fsm.enter(initial)
+	}
+	return []*State{state}
+}
+
+// enterTowards enters the state down to the target, the other regions of parallel states on the way are entered as usual
+func (fsm *FiniteStateMachine) enterTowards(state *State, target *State) []*State {
+	if state == target {
+		return fsm.enter(state)
+	}
+	next := fsm.childTowards(state, target)
+	if !state.parallel {
+		return fsm.enterTowards(next, target)
+	}
+	entered := []*State{}
+	for _, region := range state.children {
+		if region == next.name {
+			entered = append(entered, fsm.enterTowards(next, target)...)
+		} else {
+			entered = append(entered, fsm.enter(fsm.states[region])...)
+		}
+	}
+	return entered
+}
+
+// applyTransition exits the source side of the transition scope and enters the target.
+// Exit actions run innermost first, then the computation of the transition, then entry actions outermost first.
+func (fsm *FiniteStateMachine) applyTransition(source *State, target *State, computation func(*Variables, func(Message)) error) error {
+	scope := fsm.transitionScope(source, target)
+	exited := fsm.childTowards(scope, source)
+	if err := fsm.runExitActions(fsm.statesBetween(exited, fsm.configuration)); err != nil {
+		return err
+	}
+	if err := computation(&fsm.variables, fsm.send); err != nil {
+		return err
+	}
+	return fsm.enterFrom(scope, exited, target)
+}
+
+// enterFrom enters the target from the scope, the entered states take the place of the exited ones in the configuration
+func (fsm *FiniteStateMachine) enterFrom(scope *State, exited *State, target *State) error {
+	entryRoot := fsm.childTowards(scope, target)
+	entered := fsm.enterTowards(entryRoot, target)
+	configuration := make([]*State, 0, len(fsm.configuration)+len(entered))
+	inserted := false
+	for _, leaf := range fsm.configuration {
+		if !fsm.isDescendant(leaf, exited) {
+			configuration = append(configuration, leaf)
+		} else if !inserted {
+			configuration = append(configuration, entered...)
+			inserted = true
+		}
+	}
+	if !inserted {
+		configuration = append(configuration, entered...)
+	}
+	fsm.configuration = configuration
+	return fsm.runEntryActions(fsm.statesBetween(entryRoot, entered))
+}
+
+// statesBetween lists the states from the root down to each of the leaves below it, parents before their substates
+func (fsm *FiniteStateMachine) statesBetween(root *State, leaves []*State) []*State {
+	states := []*State{}
+	seen := map[*State]bool{}
+	for _, leaf := range leaves {
+		if !fsm.isDescendant(leaf, root) {
+			continue
+		}
+		path := []*State{}
+		for state := leaf; state != root; state = fsm.states[state.parent] {
+			path = append([]*State{state}, path...)
+		}
+		for _, state := range append([]*State{root}, path...) {
+			if !seen[state] {
+				seen[state] = true
+				states = append(states, state)
+			}
+		}
+	}
+	return states
+}
+
+// runEntryActions runs the entry actions outermost first and starts the timers of the entered states
+func (fsm *FiniteStateMachine) runEntryActions(states []*State) error {
+	for _, state := range states {
+		if err := state.entry.Run(&fsm.variables, fsm.send); err != nil {
+			return err
+		}
+		fsm.armTimers(state)
+	}
+	return nil
+}
+
+// runExitActions runs the exit actions in reverse, substates are left before their parents, and stops their timers
+func (fsm *FiniteStateMachine) runExitActions(states []*State) error {
+	for i := len(states) - 1; i >= 0; i-- {
+		fsm.disarmTimers(states[i])
+		if err := states[i].exit.Run(&fsm.variables, fsm.send); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transitionScope is the innermost proper ancestor of the source that contains the target, nil for the top level.
+// Regions of a parallel state are only left together, so a transition between regions leaves the parallel state.
+func (fsm *FiniteStateMachine) transitionScope(source *State, target *State) *State {
+	scope := fsm.states[source.parent]
+	for scope != nil {
+		if fsm.isDescendant(target, scope) && (!scope.parallel || fsm.childTowards(scope, source) == fsm.childTowards(scope, target)) {
+			return scope
+		}
+		scope = fsm.states[scope.parent]
+	}
+	return nil
+}
+
+// childTowards returns the substate of the scope that is or contains the state, scope nil is the top level
+func (fsm *FiniteStateMachine) childTowards(scope *State, state *State) *State {
+	scopeName := ""
+	if scope != nil {
+		scopeName = scope.name
+	}
+	for state.parent != scopeName {
+		state = fsm.states[state.parent]
+	}
+	return state
+}
+
+// isDescendant reports if the state is the ancestor or one of its substates
+func (fsm *FiniteStateMachine) isDescendant(state *State, ancestor *State) bool {
+	for ; state != nil; state = fsm.states[state.parent] {
+		if state == ancestor {
+			return true
+		}
+	}
+	return false
+}
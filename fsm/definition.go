@@ -0,0 +1,131 @@
+package fsm
+
+import (
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/logger"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+// Definition is a built model that is never changed by the machines made from it. Its states and choices are shared
+// by all of its machines, so making one with NewInstance only costs the copy of the variables.
+// A Definition is safe for concurrent use, the machines made from it are not.
+type Definition struct {
+	modelName     string
+	states        map[string]*State
+	choices       map[string]*Choice
+	initial       types.Option[*State]
+	variables     Variables
+	events        map[string][]Parameter
+	clock         Clock
+	maxMicrosteps int
+	cache         map[string]any
+}
+
+// Define validates the model and builds its definition, the builder must not be changed afterwards.
+// The definition of an invalid model is built all the same, it is returned along with the *ValidationError.
+func (fsm *FsmBuilder) Define() (*Definition, error) {
+	if len(fsm.modelName) == 0 {
+		fsm.modelName = "Default (FSM)"
+	}
+	if initial, declared := fsm.states[fsm.initialName]; declared {
+		// Initial may have been given before the state was declared
+		fsm.initialState = types.Some(initial)
+	}
+	definition := &Definition{
+		modelName:     fsm.modelName,
+		states:        fsm.states,
+		choices:       fsm.choices,
+		initial:       fsm.initialState,
+		variables:     fsm.variables.Copy(),
+		events:        fsm.events,
+		clock:         fsm.clock,
+		maxMicrosteps: fsm.maxMicrosteps,
+		cache:         map[string]any{"states-keys": sortedKeys(fsm.states)},
+	}
+	events := map[string]bool{}
+	for event := range fsm.events {
+		events[event] = true
+	}
+	for _, state := range fsm.states {
+		for event := range state.transitions {
+			events[event] = true
+		}
+	}
+	definition.cache["events"] = events
+	machine := definition.instance()
+	definition.cache["hash"] = machine.GetHash()
+	return definition, fsm.Validate()
+}
+
+// NewInstance returns a machine that has entered the initial state, with the variables as declared
+func (definition *Definition) NewInstance() FiniteStateMachine {
+	machine := definition.instance()
+	machine.start()
+	return machine
+}
+
+func (definition *Definition) GetModelName() string {
+	return definition.modelName
+}
+
+// GetHash returns the hash of the model, see FiniteStateMachine.GetHash
+func (definition *Definition) GetHash() string {
+	return definition.cache["hash"].(string)
+}
+
+// instance returns a machine of the definition that has not entered any state yet
+func (definition *Definition) instance() FiniteStateMachine {
+	return FiniteStateMachine{
+		logger:        logger.New(definition.modelName),
+		definition:    definition,
+		modelName:     definition.modelName,
+		states:        definition.states,
+		choices:       definition.choices,
+		declared:      definition.variables,
+		events:        definition.events,
+		clock:         definition.clock,
+		maxMicrosteps: definition.maxMicrosteps,
+		observers:     map[Hook][]*registration{},
+		cache:         definition.cache,
+	}
+}
+
+// Reset brings the machine back to the initial state with the variables as declared, as if it was just made.
+// The entry actions of the initial state run again. The observers and the clock are kept.
+func (fsm *FiniteStateMachine) Reset() {
+	fsm.start()
+}
+
+// GetDefinition returns the definition the machine was made from
+func (fsm *FiniteStateMachine) GetDefinition() *Definition {
+	return fsm.definition
+}
+
+// start enters the initial state, forgetting everything the machine did before
+func (fsm *FiniteStateMachine) start() {
+	fsm.mode = mode.CONTINUE
+	fsm.cause = ""
+	fsm.err = nil
+	fsm.variables = fsm.declared.Copy()
+	fsm.configuration = nil
+	fsm.outbox = nil
+	fsm.raised = nil
+	fsm.queue = nil
+	fsm.internalSteps = 0
+	fsm.now = fsm.clock.Now()
+	fsm.armed = map[*Timer]time.Time{}
+	fsm.definition.initial.HasValue(func(initial *State) {
+		fsm.initial = initial
+		fsm.configuration = fsm.enter(initial)
+		if err := fsm.runEntryActions(fsm.statesBetween(initial, fsm.configuration)); err != nil {
+			fsm.fail(mode.CRASH, err)
+		} else {
+			fsm.runToCompletion()
+		}
+		if fsm.isStopped() {
+			fsm.disarmAll()
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package fsm
+
+import (
+	"fmt"
+)
+
+type Severity uint
+
+const (
+	SEVERITY_ERROR   Severity = 0
+	SEVERITY_WARNING Severity = 1
+	SEVERITY_INFO    Severity = 2
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_INFO:
+		return "info"
+	default:
+		return ""
+	}
+}
+
+// DiagnosticCode identifies the kind of problem, codes are stable so tools can match on them
+type DiagnosticCode string
+
+const (
+	CODE_UNEXPECTED_TOKEN    DiagnosticCode = "AML0001"
+	CODE_MISSING_NAME        DiagnosticCode = "AML0002"
+	CODE_MISSING_VALUE       DiagnosticCode = "AML0003"
+	CODE_MISSING_TARGET      DiagnosticCode = "AML0004"
+	CODE_INVALID_OPERATOR    DiagnosticCode = "AML0005"
+	CODE_UNCLOSED_BLOCK      DiagnosticCode = "AML0006"
+	CODE_DUPLICATE_MODEL     DiagnosticCode = "AML0007"
+	CODE_INVALID_DURATION    DiagnosticCode = "AML0008"
+	CODE_MISSING_ELSE        DiagnosticCode = "AML0009"
+	CODE_MISSING_SYNTAX      DiagnosticCode = "AML0100"
+	CODE_INVALID_VALUE       DiagnosticCode = "AML0101"
+	CODE_UNDECLARED_VARIABLE DiagnosticCode = "AML0102"
+	CODE_DUPLICATE_STATE     DiagnosticCode = "AML0103"
+	CODE_EMPTY_STATE         DiagnosticCode = "AML0104"
+	CODE_MISSING_INITIAL     DiagnosticCode = "AML0105"
+	CODE_MULTIPLE_INITIAL    DiagnosticCode = "AML0106"
+	CODE_TYPE_MISMATCH       DiagnosticCode = "AML0107"
+	CODE_UNKNOWN_TYPE        DiagnosticCode = "AML0108"
+	CODE_UNQUOTED_STRING     DiagnosticCode = "AML0109"
+	CODE_DUPLICATE_VARIABLE  DiagnosticCode = "AML0110"
+	CODE_UNKNOWN_MEMBER      DiagnosticCode = "AML0111"
+	CODE_DUPLICATE_ENUM      DiagnosticCode = "AML0112"
+	CODE_UNKNOWN_MODEL       DiagnosticCode = "AML0113"
+	CODE_UNHANDLED_EVENT     DiagnosticCode = "AML0114"
+	CODE_MULTIPLE_MODELS     DiagnosticCode = "AML0115"
+	CODE_INCLUDE_NOT_FOUND   DiagnosticCode = "AML0116"
+	CODE_INCLUDE_CYCLE       DiagnosticCode = "AML0117"
+	CODE_DUPLICATE_EVENT     DiagnosticCode = "AML0118"
+	CODE_CHOICE_CYCLE        DiagnosticCode = "AML0119"
+	CODE_UNKNOWN_STATE       DiagnosticCode = "AML0120"
+	CODE_UNREACHABLE_EDGE    DiagnosticCode = "AML0121"
+)
+
+type Diagnostic struct {
+	Severity Severity
+	File     string
+	Span     Span
+	Code     DiagnosticCode
+	Message  string
+}
+
+// String formats the diagnostic as file:line:column: severity[code]: message
+func (diagnostic Diagnostic) String() string {
+	file := diagnostic.File
+	if len(file) == 0 {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%s: %s[%s]: %s", file, diagnostic.Span.Start, diagnostic.Severity, diagnostic.Code, diagnostic.Message)
+}
+
+type Diagnostics []Diagnostic
+
+func (diagnostics *Diagnostics) Errorf(file string, span Span, code DiagnosticCode, format string, args ...any) {
+	diagnostics.add(SEVERITY_ERROR, file, span, code, format, args...)
+}
+
+func (diagnostics *Diagnostics) Warnf(file string, span Span, code DiagnosticCode, format string, args ...any) {
+	diagnostics.add(SEVERITY_WARNING, file, span, code, format, args...)
+}
+
+func (diagnostics *Diagnostics) add(severity Severity, file string, span Span, code DiagnosticCode, format string, args ...any) {
+	*diagnostics = append(*diagnostics, Diagnostic{
+		Severity: severity,
+		File:     file,
+		Span:     span,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (diagnostics Diagnostics) HasErrors() bool {
+	return diagnostics.count(SEVERITY_ERROR) > 0
+}
+
+func (diagnostics Diagnostics) HasWarnings() bool {
+	return diagnostics.count(SEVERITY_WARNING) > 0
+}
+
+func (diagnostics Diagnostics) count(severity Severity) int {
+	count := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// WithCode returns the diagnostics matching the code, in the order they were reported
+func (diagnostics Diagnostics) WithCode(code DiagnosticCode) Diagnostics {
+	matching := Diagnostics{}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code == code {
+			matching = append(matching, diagnostic)
+		}
+	}
+	return matching
+}
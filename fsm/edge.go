@@ -10,6 +10,13 @@ type EdgeMetaData struct {
 	rawLine     string
 	computation types.Option[string]
 	condition   types.Option[string]
+	origin      origin
+}
+
+// origin is where an edge is declared in a file, edges made with the builder have none
+type origin struct {
+	file string
+	span Span
 }
 
 type Edge struct {
@@ -19,36 +26,74 @@ type Edge struct {
 	computation2   Computational
 	condition      types.Option[functions.Predicate[*Variables]]
 	condition2     Conditionals
+	disabled       bool
 	metaData       EdgeMetaData
 }
 
-func (edge *Edge) checkCondition(variables *Variables) (types.Option[string], mode.Mode) {
-	next := edge.resultingState
+func (edge *Edge) GetConditions() Conditionals {
+	return edge.condition2
+}
+
+func (edge *Edge) GetComputations() Computational {
+	return edge.computation2
+}
+
+func (edge *Edge) GetResultingState() types.Option[string] {
+	return edge.resultingState
+}
+
+// GetGuard returns the text of the guard, a predicate given as a closure is shown by its metadata
+func (edge *Edge) GetGuard() string {
+	if len(edge.condition2.Conditions) > 0 {
+		return printExpr(edge.condition2.Expr(), 0, false)
+	}
+	return edge.metaData.condition.GetOrElse("")
+}
+
+// checkCondition returns the resulting state when the guard holds, the computation is left to the caller.
+// A terminating edge whose guard holds returns no state and TERMINATE, an edge whose guard fails returns DEADLOCK.
+func (edge *Edge) checkCondition(variables *Variables) (types.Option[string], mode.Mode, error) {
+	holds, err := edge.holds(variables)
+	switch {
+	case err != nil:
+		return types.None[string](), mode.CRASH, err
+	case !holds:
+		return types.None[string](), mode.DEADLOCK, nil
+	}
+	return edge.resultingState, edge.terminate, nil
+}
+
+// holds reports if the guard of the edge holds, the deprecated predicate is checked before the conditions.
+// The guard of a disabled edge never holds.
+func (edge *Edge) holds(variables *Variables) (bool, error) {
+	if edge.disabled {
+		return false, nil
+	}
+	holds := true
 	edge.condition.HasValue(func(p functions.Predicate[*Variables]) {
-		if !p(variables) {
-			next = types.None[string]()
-			return
-		}
-		edge.compute(variables)
-	}).Else(func() {
-		edge.compute(variables)
+		holds = p(variables)
 	})
-	return next, edge.terminate
+	if !holds {
+		return false, nil
+	}
+	return edge.condition2.Evaluate(variables)
 }
 
-func (edge *Edge) compute(variables *Variables) {
+func (edge *Edge) compute(variables *Variables, send func(Message)) error {
 	edge.computation.HasValue(func(c functions.Consumer[*Variables]) {
 		c(variables)
 	})
+	return edge.computation2.Run(variables, send)
 }
 
 type EdgeBuilder struct {
 	terminate      mode.Mode
 	resultingState types.Option[string]
-	computation    types.Option[functions.Consumer[*Variables]] // DEPRECATED
+	computation    types.Option[functions.Consumer[*Variables]] // DEPRECATED, use computation2
 	computation2   Computational
-	condition      types.Option[functions.Predicate[*Variables]] // DEPRECATED
+	condition      types.Option[functions.Predicate[*Variables]] // DEPRECATED, use condition2
 	condition2     Conditionals
+	disabled       bool
 	metaData       EdgeMetaData
 }
 
@@ -76,6 +121,12 @@ func (builder *EdgeBuilder) MetaData(metaData string) *EdgeBuilder {
 	return builder
 }
 
+// declaredAt records where the edge is declared, so that its problems are reported there
+func (builder *EdgeBuilder) declaredAt(file string, span Span) *EdgeBuilder {
+	builder.metaData.origin = origin{file: file, span: span}
+	return builder
+}
+
 func (builder *EdgeBuilder) End() *EdgeBuilder {
 	builder.terminate = mode.TERMINATE
 	return builder
@@ -86,7 +137,7 @@ func (builder *EdgeBuilder) Then(state string) *EdgeBuilder {
 	return builder
 }
 
-// DEPRECATED
+// DEPRECATED, use And2. The predicate is still checked, before the conditions.
 func (builder *EdgeBuilder) And(condition functions.Predicate[*Variables]) *EdgeBuilder {
 	builder.condition = types.Some(condition)
 	return builder
@@ -97,12 +148,18 @@ func (builder *EdgeBuilder) And2(conditions *Conditionals) *EdgeBuilder {
 	return builder
 }
 
+// disable keeps the guard as written but makes it never hold, for a guard that does not type check
+func (builder *EdgeBuilder) disable() *EdgeBuilder {
+	builder.disabled = true
+	return builder
+}
+
 func (builder *EdgeBuilder) AndMeta(metaData string) *EdgeBuilder {
 	builder.metaData.condition = types.Some(metaData)
 	return builder
 }
 
-// DEPRECATED
+// DEPRECATED, use Run2. The consumer is still run, before the computations.
 func (builder *EdgeBuilder) Run(computation functions.Consumer[*Variables]) *EdgeBuilder {
 	builder.computation = types.Some(computation)
 	return builder
@@ -126,6 +183,7 @@ func (builder *EdgeBuilder) build() Edge {
 		computation2:   builder.computation2,
 		condition:      builder.condition,
 		condition2:     builder.condition2,
+		disabled:       builder.disabled,
 		metaData:       builder.metaData,
 	}
 }
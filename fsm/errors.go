@@ -0,0 +1,87 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+// The errors Fire returns are matched with errors.Is, the details are taken with errors.As
+// from an *UnknownEventError, a *NoEnabledTransitionError or an *UnknownTargetStateError.
+// Any other error crashed the model, such as a guard that could not be evaluated.
+var (
+	ErrUnknownEvent        = errors.New("unknown event")
+	ErrNoEnabledTransition = errors.New("no enabled transition")
+	ErrUnknownTargetState  = errors.New("unknown target state")
+	ErrTerminated          = errors.New("the model has terminated")
+)
+
+// UnknownEventError is returned for an event that no transition of the model is on, the model deadlocks
+type UnknownEventError struct {
+	Event string
+}
+
+func (err *UnknownEventError) Error() string {
+	return fmt.Sprintf("Unknown event %s", err.Event)
+}
+
+func (err *UnknownEventError) Is(target error) bool {
+	return target == ErrUnknownEvent
+}
+
+// FailedGuard is a guard that did not hold in the state
+type FailedGuard struct {
+	State string
+	Guard string
+}
+
+func (guard FailedGuard) String() string {
+	return fmt.Sprintf("[%s] %s", guard.State, guard.Guard)
+}
+
+// NoEnabledTransitionError is returned when no transition of the active states reacts to the event, the model deadlocks.
+// Configuration is where the model was and Guards lists the guards that failed, in the order they were checked.
+type NoEnabledTransitionError struct {
+	Event         string
+	Configuration Configuration
+	Guards        []FailedGuard
+}
+
+func (err *NoEnabledTransitionError) Error() string {
+	message := fmt.Sprintf("no enabled transition for event %q in %v", err.Event, err.Configuration)
+	if len(err.Guards) == 0 {
+		return message
+	}
+	guards := make([]string, len(err.Guards))
+	for i, guard := range err.Guards {
+		guards[i] = guard.String()
+	}
+	return fmt.Sprintf("%s, the guards failed: %s", message, strings.Join(guards, ", "))
+}
+
+func (err *NoEnabledTransitionError) Is(target error) bool {
+	return target == ErrNoEnabledTransition
+}
+
+// UnknownTargetStateError is returned for a transition to a state the model does not have, the model crashes
+type UnknownTargetStateError struct {
+	Source string
+	Target string
+}
+
+func (err *UnknownTargetStateError) Error() string {
+	return fmt.Sprintf("State %s not found from transition of %s", err.Target, err.Source)
+}
+
+func (err *UnknownTargetStateError) Is(target error) bool {
+	return target == ErrUnknownTargetState
+}
+
+// fail stops the model in the mode, the error is returned by Fire and its text is the cause
+func (fsm *FiniteStateMachine) fail(stop mode.Mode, err error) {
+	fsm.err = err
+	fsm.cause = err.Error()
+	fsm.mode = stop
+}
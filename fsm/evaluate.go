@@ -0,0 +1,226 @@
+package fsm
+
+import (
+	"fmt"
+)
+
+// Evaluate computes the value of the expression against the variables.
+// Numbers evaluate to int64 or float64, ints are promoted to floats where the two meet.
+func (variables *Variables) Evaluate(expr Expr) (any, error) {
+	switch node := expr.(type) {
+	case *Literal:
+		return normalize(node.Value), nil
+	case *VarRef:
+		value, declared := variables.values[node.Name]
+		if !declared {
+			if _, isMember := variables.memberOf(node.Name); isMember {
+				return node.Name, nil
+			}
+			return nil, fmt.Errorf("variable '%s' is not declared", node.Name)
+		}
+		return normalize(value), nil
+	case *NotExpr:
+		operand, err := variables.EvaluateBool(node.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return !operand, nil
+	case *NegateExpr:
+		operand, err := variables.Evaluate(node.Operand)
+		if err != nil {
+			return nil, err
+		}
+		switch value := operand.(type) {
+		case int64:
+			return -value, nil
+		case float64:
+			return -value, nil
+		default:
+			return nil, fmt.Errorf("cannot negate %T", operand)
+		}
+	case *LogicExpr:
+		return variables.evaluateLogic(node)
+	case *ArithmeticExpr:
+		left, err := variables.Evaluate(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := variables.Evaluate(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic(node.Symbol, left, right)
+	default:
+		return nil, fmt.Errorf("cannot evaluate %T", expr)
+	}
+}
+
+// EvaluateBool evaluates an expression that must result in a bool, as guards do
+func (variables *Variables) EvaluateBool(expr Expr) (bool, error) {
+	value, err := variables.Evaluate(expr)
+	if err != nil {
+		return false, err
+	}
+	result, isBool := value.(bool)
+	if !isBool {
+		return false, fmt.Errorf("expected a bool, got %T from '%s'", value, printExpr(expr, 0, false))
+	}
+	return result, nil
+}
+
+func (variables *Variables) evaluateLogic(node *LogicExpr) (any, error) {
+	switch node.Symbol {
+	case AND, OR:
+		left, err := variables.EvaluateBool(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		// short circuit like the generated code does
+		if (node.Symbol == AND && !left) || (node.Symbol == OR && left) {
+			return left, nil
+		}
+		return variables.EvaluateBool(node.Right)
+	}
+	left, err := variables.Evaluate(node.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := variables.Evaluate(node.Right)
+	if err != nil {
+		return nil, err
+	}
+	return compare(node.Symbol, left, right)
+}
+
+func compare(symbol LogicSymbol, left, right any) (bool, error) {
+	left, right = promote(left, right)
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			return compareOrdered(symbol, l, r), nil
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			return compareOrdered(symbol, l, r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return compareOrdered(symbol, l, r), nil
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			switch symbol {
+			case EQUAL:
+				return l == r, nil
+			case NOT_EQUAL:
+				return l != r, nil
+			default:
+				return false, fmt.Errorf("bools cannot be compared with '%s'", symbol.LSToString())
+			}
+		}
+	}
+	return false, fmt.Errorf("cannot compare %T with %T", left, right)
+}
+
+func compareOrdered[T int64 | float64 | string](symbol LogicSymbol, left, right T) bool {
+	switch symbol {
+	case EQUAL:
+		return left == right
+	case NOT_EQUAL:
+		return left != right
+	case GRATER_THAN:
+		return left > right
+	case GRATER_THAN_OR_EQUAL:
+		return left >= right
+	case LESS_THAN:
+		return left < right
+	case LESS_THAN_OR_EQUAL:
+		return left <= right
+	default:
+		return false
+	}
+}
+
+func arithmetic(symbol ArithmeticSymbol, left, right any) (any, error) {
+	left, right = promote(left, right)
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			switch symbol {
+			case ADD:
+				return l + r, nil
+			case SUBTRACT:
+				return l - r, nil
+			case MULTIPLY:
+				return l * r, nil
+			case DIVIDE, MODULO:
+				if r == 0 {
+					return nil, fmt.Errorf("integer division by zero")
+				}
+				if symbol == DIVIDE {
+					return l / r, nil
+				}
+				return l % r, nil
+			}
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			switch symbol {
+			case ADD:
+				return l + r, nil
+			case SUBTRACT:
+				return l - r, nil
+			case MULTIPLY:
+				return l * r, nil
+			case DIVIDE:
+				return l / r, nil
+			}
+		}
+	case string:
+		if r, ok := right.(string); ok && symbol == ADD {
+			return l + r, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' is not defined for %T and %T", symbol.ASToString(), left, right)
+}
+
+// promote turns an int into a float when the other operand is a float
+func promote(left, right any) (any, any) {
+	switch l := left.(type) {
+	case int64:
+		if _, isFloat := right.(float64); isFloat {
+			return float64(l), right
+		}
+	case float64:
+		if r, isInt := right.(int64); isInt {
+			return left, float64(r)
+		}
+	}
+	return left, right
+}
+
+// normalize widens the Go number types to int64 and float64
+func normalize(value any) any {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,88 @@
+package fsm
+
+import (
+	"fmt"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+// Parameter is a value carried by an event, event PAYMENT(amount: float)
+type Parameter struct {
+	Name string
+	Type VariableType
+}
+
+// GetParameters returns the parameters of the event, in the order they are declared
+func (fsm *FiniteStateMachine) GetParameters(event string) []Parameter {
+	return fsm.events[event]
+}
+
+// FireWith is Fire for an event carrying arguments. The arguments are variables while the event is handled,
+// a parameter without an argument holds the zero value of its type.
+// A model that has terminated is left as it is and ErrTerminated is returned.
+func (fsm *FiniteStateMachine) FireWith(event string, arguments map[string]any) error {
+	if fsm.mode == mode.TERMINATE {
+		return ErrTerminated
+	}
+	fsm.err = nil
+	fsm.outbox = nil
+	fsm.internalSteps = 0
+	fsm.begin(event)
+	fsm.dispatch(event, arguments)
+	fsm.runToCompletion()
+	fsm.settle()
+	return fsm.err
+}
+
+// dispatch handles a single event, the events it raises are left in the queue
+func (fsm *FiniteStateMachine) dispatch(event string, arguments map[string]any) {
+	parameters := fsm.events[event]
+	for _, parameter := range parameters {
+		if _, isVariable := fsm.declared.types[parameter.Name]; isVariable {
+			// binding it would overwrite the variable and then remove it
+			fsm.fail(mode.CRASH, fmt.Errorf("Parameter %s of %s has the name of a variable", parameter.Name, event))
+			return
+		}
+	}
+	for name := range arguments {
+		if !hasParameter(parameters, name) {
+			fsm.fail(mode.CRASH, fmt.Errorf("Event %s has no parameter %s", event, name))
+			return
+		}
+	}
+	for _, parameter := range parameters {
+		value, given := arguments[parameter.Name]
+		if !given {
+			value = parameter.Type.zero()
+		}
+		converted, err := convert(normalize(value), parameter.Type)
+		if err != nil {
+			fsm.fail(mode.CRASH, fmt.Errorf("Bad argument %s of %s, %s", parameter.Name, event, err.Error()))
+			return
+		}
+		fsm.variables.Set(parameter.Name, converted)
+		fsm.variables.SetType(parameter.Name, parameter.Type)
+		// the parameter is only a variable while the event is handled, whichever way it ends
+		defer fsm.variables.remove(parameter.Name)
+	}
+	fsm.fire(event)
+}
+
+func hasParameter(parameters []Parameter, name string) bool {
+	for _, parameter := range parameters {
+		if parameter.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withParameters returns a copy of the variables with the parameters declared, the scope of transitions on the event
+func withParameters(variables *Variables, parameters []Parameter) *Variables {
+	scope := variables.Copy()
+	for _, parameter := range parameters {
+		scope.Set(parameter.Name, parameter.Type.zero())
+		scope.SetType(parameter.Name, parameter.Type)
+	}
+	return &scope
+}
@@ -0,0 +1,241 @@
+package fsm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node in the expression tree used by guards, shared by the parser,
+// the interpreter (Variables.Evaluate) and the code generator (GenerateExpr)
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Literal: 10, 0.5, true, "some string"
+type Literal struct {
+	Span
+	Value any
+	Type  VariableType
+}
+
+// VarRef: i, or a member of an enum (RED). Enum is set for ENUM references.
+type VarRef struct {
+	Span
+	Name string
+	Type VariableType
+	Enum string
+}
+
+// NotExpr: !b
+type NotExpr struct {
+	Span
+	Operand Expr
+}
+
+// NegateExpr: -i
+type NegateExpr struct {
+	Span
+	Operand Expr
+}
+
+// LogicExpr covers the comparisons and the boolean connectives: i >= 10 && b
+type LogicExpr struct {
+	Span
+	Symbol LogicSymbol
+	Left   Expr
+	Right  Expr
+}
+
+// ArithmeticExpr: (i + j) * 2
+type ArithmeticExpr struct {
+	Span
+	Symbol ArithmeticSymbol
+	Left   Expr
+	Right  Expr
+}
+
+func (*Literal) exprNode()        {}
+func (*VarRef) exprNode()         {}
+func (*NotExpr) exprNode()        {}
+func (*NegateExpr) exprNode()     {}
+func (*LogicExpr) exprNode()      {}
+func (*ArithmeticExpr) exprNode() {}
+
+func NewLiteral(value any) *Literal {
+	value = normalize(value)
+	var valueType VariableType
+	switch value.(type) {
+	case int64:
+		valueType = INT
+	case float64:
+		valueType = FLOAT
+	case bool:
+		valueType = BOOL
+	default:
+		valueType = STRING
+	}
+	return &Literal{Value: value, Type: valueType}
+}
+
+// precedence follows Go, so generated code needs no more parentheses than the source
+const (
+	precedenceOr             = 1
+	precedenceAnd            = 2
+	precedenceComparison     = 3
+	precedenceAdditive       = 4
+	precedenceMultiplicative = 5
+	precedenceUnary          = 6
+)
+
+func (symbol LogicSymbol) precedence() int {
+	switch symbol {
+	case OR:
+		return precedenceOr
+	case AND:
+		return precedenceAnd
+	default:
+		return precedenceComparison
+	}
+}
+
+func (symbol ArithmeticSymbol) precedence() int {
+	switch symbol {
+	case MULTIPLY, DIVIDE, MODULO:
+		return precedenceMultiplicative
+	default:
+		return precedenceAdditive
+	}
+}
+
+func (literal *Literal) String() string     { return printExpr(literal, 0, false) }
+func (ref *VarRef) String() string          { return printExpr(ref, 0, false) }
+func (expr *NotExpr) String() string        { return printExpr(expr, 0, false) }
+func (expr *NegateExpr) String() string     { return printExpr(expr, 0, false) }
+func (expr *LogicExpr) String() string      { return printExpr(expr, 0, false) }
+func (expr *ArithmeticExpr) String() string { return printExpr(expr, 0, false) }
+
+// GenerateExpr prints the expression as Go code, ints are converted where they meet floats
+func GenerateExpr(expr Expr) string {
+	return printExpr(expr, 0, true)
+}
+
+func printExpr(expr Expr, parentPrecedence int, generate bool) string {
+	var str string
+	precedence := precedenceUnary
+	switch node := expr.(type) {
+	case *Literal:
+		str = formatValue(node.Value)
+	case *VarRef:
+		str = node.Name
+	case *NotExpr:
+		str = "!" + printExpr(node.Operand, precedenceUnary, generate)
+	case *NegateExpr:
+		operand := printExpr(node.Operand, precedenceUnary, generate)
+		if strings.HasPrefix(operand, "-") {
+			// --i would be a decrement in Go
+			operand = "(" + operand + ")"
+		}
+		str = "-" + operand
+	case *LogicExpr:
+		precedence = node.Symbol.precedence()
+		left, right := node.Left, node.Right
+		str = fmt.Sprintf("%s %s %s",
+			printOperand(left, right, precedence, generate),
+			node.Symbol.LSToString(),
+			printOperand(right, left, precedence+1, generate))
+	case *ArithmeticExpr:
+		precedence = node.Symbol.precedence()
+		left, right := node.Left, node.Right
+		str = fmt.Sprintf("%s %s %s",
+			printOperand(left, right, precedence, generate),
+			node.Symbol.ASToString(),
+			printOperand(right, left, precedence+1, generate))
+	default:
+		return ""
+	}
+	if precedence < parentPrecedence {
+		return "(" + str + ")"
+	}
+	return str
+}
+
+// printOperand prints one side of a binary expression, in generated code an int
+// operand is converted to float64 when the other side is a float
+func printOperand(operand Expr, other Expr, precedence int, generate bool) string {
+	if generate && ExprType(other) == FLOAT {
+		return generateAsFloat(operand, precedence)
+	}
+	return printExpr(operand, precedence, generate)
+}
+
+// generateAsFloat converts int expressions, int literals are left as Go converts constants by itself
+func generateAsFloat(expr Expr, precedence int) string {
+	if _, isLiteral := expr.(*Literal); isLiteral || ExprType(expr) != INT {
+		return printExpr(expr, precedence, true)
+	}
+	return fmt.Sprintf("float64(%s)", printExpr(expr, 0, true))
+}
+
+// ExprType is the type the expression evaluates to
+func ExprType(expr Expr) VariableType {
+	switch node := expr.(type) {
+	case *Literal:
+		return node.Type
+	case *VarRef:
+		return node.Type
+	case *NotExpr, *LogicExpr:
+		return BOOL
+	case *NegateExpr:
+		return ExprType(node.Operand)
+	case *ArithmeticExpr:
+		left, right := ExprType(node.Left), ExprType(node.Right)
+		switch {
+		case left == STRING || right == STRING:
+			return STRING
+		case left == FLOAT || right == FLOAT:
+			return FLOAT
+		default:
+			return left
+		}
+	default:
+		return STRING
+	}
+}
+
+// Walk calls visit for the expression and each of its sub-expressions, parents before children
+func Walk(expr Expr, visit func(Expr)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+	switch node := expr.(type) {
+	case *NotExpr:
+		Walk(node.Operand, visit)
+	case *NegateExpr:
+		Walk(node.Operand, visit)
+	case *LogicExpr:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	case *ArithmeticExpr:
+		Walk(node.Left, visit)
+		Walk(node.Right, visit)
+	}
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		str := strconv.FormatFloat(v, 'f', -1, 64)
+		if _, err := strconv.ParseInt(str, 10, 64); err == nil {
+			// keep the value a float in generated code
+			str += ".0"
+		}
+		return str
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -2,11 +2,16 @@ package fsm
 
 import (
 	"fmt"
+	"go/token"
 	"os"
 	"path"
+	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/Wafl97/go_aml/fsm/mode"
 	"github.com/Wafl97/go_aml/util/logger"
+	"github.com/Wafl97/go_aml/util/types"
 )
 
 const GENERATOR_VERSION = "v0.1.0"
@@ -25,7 +30,25 @@ func Generate(model *FiniteStateMachine) {
 	os.MkdirAll("srcgen", os.ModeDir)
 
 	generateFile(path.Join("srcgen", "go.mod"), fmt.Sprintf(modFile, GENERATOR_VERSION))
-	generateFile(path.Join("srcgen", model.GetModelName()+".go"), generateCode(model))
+	generateFile(path.Join("srcgen", model.GetModelName()+".go"), generateCode(model, "main", mainImports, fmt.Sprintf(mainStructure, model.initial.GetName())))
+
+	glog.Info("Generation complete")
+}
+
+// GenerateSystem generates a package for every model and a main package delivering the events they send
+func GenerateSystem(system *System) {
+	glog := logger.New("GENERATOR")
+	glog.Infof("Generating code ...")
+	os.MkdirAll("srcgen", os.ModeDir)
+
+	generateFile(path.Join("srcgen", "go.mod"), fmt.Sprintf(modFile, GENERATOR_VERSION))
+	generateFile(path.Join("srcgen", "main.go"), generateSystemMain(system))
+	for _, model := range system.GetMachines() {
+		packageName := generatePackageName(model.GetModelName())
+		os.MkdirAll(path.Join("srcgen", packageName), os.ModeDir)
+		section := fmt.Sprintf(packageStructure, model.initial.GetName(), model.GetModelName())
+		generateFile(path.Join("srcgen", packageName, model.GetModelName()+".go"), generateCode(model, packageName, packageImports, section))
+	}
 
 	glog.Info("Generation complete")
 }
@@ -39,15 +62,9 @@ func generateFile(fileName, fileContent string) {
 }
 
 const codeStructure string = `/* Generated by AML %s */
-package main
+package %s
 
-import (
-	"bufio"
-	"fmt"
-	"io"
-	"os"
-	"strings"
-)
+import (%s)
 
 type (
 	State      int
@@ -56,88 +73,772 @@ type (
 		resultingState State
 		function       func()
 	}
+	Timer struct {
+		delay      time.Duration
+		repeat     bool
+		transition Transition
+	}
 	StateNode struct {
 		name                 string
+		parent               State
+		initial              State
+		parallel             bool
+		children             []State
+		entry                func()
+		exit                 func()
 		autoComputation      func(event string)
 		autoEventTransitions []Transition
 		transitions          map[string][]Transition
+		timers               []Timer
 	}
 )
 
+%s
 var ( /* VARIABLES */
 %s)
 
 const ( /* STATES */
 	TERMINATION_STATE State = -1
+	NO_STATE          State = -2
 %s)
 
 var STATES []StateNode = []StateNode{
 %s}
 
-var CURRENT_STATE *StateNode = &STATES[STATE_%s]
-	
-func main() {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("State = %%s\n", CURRENT_STATE.name)
-		switch event, err := reader.ReadString('\n'); err {
-		case nil:
-			handleEvent(event)
-		case io.EOF:
-			os.Exit(0)
-		default:
-			fmt.Print(err.Error())
-			os.Exit(1)
+// CHOICES holds the branches of the choice pseudo-states in the order they are tried, the else branch is the last
+var CHOICES = map[State][]Transition{
+%s}
+
+var ( /* EVENT PARAMETERS */
+%s)
+
+// PARAMETERS set the parameters of the events carrying them from their arguments
+var PARAMETERS = map[string]func(arguments []string) error{
+%s}
+
+// MAX_MICROSTEPS bounds the raised events handled for a single event
+const MAX_MICROSTEPS = %d
+
+// RAISED holds the raised events, they are handled before the next event
+var RAISED []string
+
+func raise(event string) {
+	RAISED = append(RAISED, event)
+}
+
+// runToCompletion handles the raised events in order until none are left
+func runToCompletion() {
+	for steps := 0; len(RAISED) > 0; steps++ {
+		if steps == MAX_MICROSTEPS {
+			RAISED = nil
+			crash(fmt.Sprintf("Still raising events after %%d microsteps", MAX_MICROSTEPS))
+			return
 		}
+		event := RAISED[0]
+		RAISED = RAISED[1:]
+		handleEvent(event)
 	}
 }
 
-func handleEvent(event string) {
-	event = strings.TrimSpace(event)
-	state, success := CURRENT_STATE.transitions[event]
-	if !success {
-		runAutoEvents(event)
-		return
+// CONFIGURATION holds the active innermost states, one for each active region
+var CONFIGURATION []State
+
+func configurationName() string {
+	names := make([]string, len(CONFIGURATION))
+	for i, state := range CONFIGURATION {
+		names[i] = STATES[state].name
 	}
-	for _, transition := range state {
-		if transition.condition == nil || transition.condition() {
-			applyTransition(&transition)
+	return strings.Join(names, ", ")
+}
+
+// handleEvent lets every active region react to the event, in the order the regions are declared.
+// The transitions of a state holding parallel regions are only tried when none of its regions took the event.
+// The event is written as EVENT, or as EVENT(arguments...) when it carries parameters.
+func handleEvent(input string) {
+	event, arguments := parseEvent(input)
+	if setParameters, hasParameters := PARAMETERS[event]; hasParameters {
+		if err := setParameters(arguments); err != nil {
+			fmt.Printf("Bad arguments for %%s: %%s\n", event, err.Error())
 			return
 		}
 	}
-	runAutoEvents(event)
+	fired := false
+	sources := []State{}
+	pending := append([]State{}, CONFIGURATION...)
+	for len(pending) > 0 {
+		deferred := []State{}
+		for _, from := range pending {
+			if !isActive(from) || anyWithin(sources, from) {
+				continue
+			}
+			if anyWithin(pending, from) {
+				// a shared state is tried once the regions within it had their turn
+				deferred = appendOnce(deferred, from)
+				continue
+			}
+			for state := from; state != NO_STATE; state = STATES[state].parent {
+				if transition := enabled(STATES[state].transitions[event]); transition != nil {
+					applyTransition(state, transition)
+					sources = append(sources, state)
+					fired = true
+					break
+				}
+				if parent := STATES[state].parent; parent != NO_STATE && hasOtherRegions(parent, state) {
+					deferred = appendOnce(deferred, parent)
+					break
+				}
+			}
+		}
+		pending = deferred
+	}
+	if !fired {
+		runAutoEvents(event)
+	}
+}
+
+// parseEvent splits EVENT(1, "two") into the event and its arguments
+func parseEvent(input string) (string, []string) {
+	input = strings.TrimSpace(input)
+	open := strings.Index(input, "(")
+	if open < 0 || !strings.HasSuffix(input, ")") {
+		return input, nil
+	}
+	arguments := []string{}
+	for _, argument := range strings.Split(input[open+1:len(input)-1], ",") {
+		if argument = strings.TrimSpace(argument); len(argument) > 0 {
+			arguments = append(arguments, argument)
+		}
+	}
+	return strings.TrimSpace(input[:open]), arguments
+}
+
+// parseInt and the other parse functions read the argument at i, a missing argument is the zero value
+func parseInt(arguments []string, i int) (int, error) {
+	if i >= len(arguments) {
+		return 0, nil
+	}
+	return strconv.Atoi(arguments[i])
+}
+
+func parseFloat(arguments []string, i int) (float64, error) {
+	if i >= len(arguments) {
+		return 0, nil
+	}
+	return strconv.ParseFloat(arguments[i], 64)
 }
 
-func applyTransition(transition *Transition) {
+func parseBool(arguments []string, i int) (bool, error) {
+	if i >= len(arguments) {
+		return false, nil
+	}
+	return strconv.ParseBool(arguments[i])
+}
+
+func parseString(arguments []string, i int) (string, error) {
+	if i >= len(arguments) {
+		return "", nil
+	}
+	if unquoted, err := strconv.Unquote(arguments[i]); err == nil {
+		return unquoted, nil
+	}
+	return arguments[i], nil
+}
+
+func enabled(transitions []Transition) *Transition {
+	for i := range transitions {
+		if transitions[i].condition == nil || transitions[i].condition() {
+			return &transitions[i]
+		}
+	}
+	return nil
+}
+
+// applyTransition exits the source side of the transition scope and enters the target.
+// Exit actions run innermost first, then the function of the transition, then entry actions outermost first.
+func applyTransition(source State, transition *Transition) {
+	if _, isChoice := CHOICES[transition.resultingState]; isChoice {
+		applyChoice(source, transition)
+		return
+	}
 	switch transition.resultingState {
 	case TERMINATION_STATE:
-		fmt.Println("Terminating")
-		os.Exit(0)
+		terminate()
 	default:
-		CURRENT_STATE = &STATES[transition.resultingState]
+		target := transition.resultingState
+		scope := transitionScope(source, target)
+		exited := childTowards(scope, source)
+		runExitActions(statesBetween(exited, CONFIGURATION))
+		if transition.function != nil {
+			transition.function()
+		}
+		enterFrom(scope, exited, target)
+	}
+}
+
+// applyChoice runs the function of the transition and follows the branches of the choices until it reaches a state,
+// which is then entered from the source like any other target
+func applyChoice(source State, transition *Transition) {
+	for {
 		if transition.function != nil {
 			transition.function()
 		}
+		branches, isChoice := CHOICES[transition.resultingState]
+		if !isChoice {
+			break
+		}
+		transition = enabled(branches)
 	}
+	switch transition.resultingState {
+	case TERMINATION_STATE:
+		terminate()
+	default:
+		applyTransition(source, &Transition{resultingState: transition.resultingState})
+	}
+}
+
+// enterFrom enters the target from the scope, the entered states take the place of the exited ones in the configuration
+func enterFrom(scope State, exited State, target State) {
+	entryRoot := childTowards(scope, target)
+	entered := enterTowards(entryRoot, target)
+	configuration := make([]State, 0, len(CONFIGURATION)+len(entered))
+	inserted := false
+	for _, leaf := range CONFIGURATION {
+		if !isDescendant(leaf, exited) {
+			configuration = append(configuration, leaf)
+		} else if !inserted {
+			configuration = append(configuration, entered...)
+			inserted = true
+		}
+	}
+	if !inserted {
+		configuration = append(configuration, entered...)
+	}
+	CONFIGURATION = configuration
+	runEntryActions(statesBetween(entryRoot, entered))
+}
+
+// statesBetween lists the states from the root down to each of the leaves below it, parents before their substates
+func statesBetween(root State, leaves []State) []State {
+	states := []State{}
+	seen := map[State]bool{}
+	for _, leaf := range leaves {
+		if !isDescendant(leaf, root) {
+			continue
+		}
+		path := []State{}
+		for state := leaf; state != root; state = STATES[state].parent {
+			path = append([]State{state}, path...)
+		}
+		for _, state := range append([]State{root}, path...) {
+			if !seen[state] {
+				seen[state] = true
+				states = append(states, state)
+			}
+		}
+	}
+	return states
 }
 
+func runEntryActions(states []State) {
+	for _, state := range states {
+		if STATES[state].entry != nil {
+			STATES[state].entry()
+		}
+		armTimers(state)
+	}
+}
+
+// runExitActions runs the exit actions in reverse, substates are left before their parents
+func runExitActions(states []State) {
+	for i := len(states) - 1; i >= 0; i-- {
+		disarmTimers(states[i])
+		if STATES[states[i]].exit != nil {
+			STATES[states[i]].exit()
+		}
+	}
+}
+
+// ARMED holds the running timers of the active states. ENTERED counts the entries of every state,
+// so that a timer falling due after its state was left is ignored.
+var (
+	ARMED   = map[State][]*time.Timer{}
+	ENTERED = map[State]int{}
+)
+
+// armTimers starts the timers of an entered state, a timer that falls due is handed to timeout
+func armTimers(state State) {
+	ENTERED[state]++
+	ARMED[state] = make([]*time.Timer, len(STATES[state].timers))
+	for i := range STATES[state].timers {
+		startTimer(state, i, ENTERED[state])
+	}
+}
+
+func startTimer(state State, i int, entry int) {
+	ARMED[state][i] = time.AfterFunc(STATES[state].timers[i].delay, func() {
+		timeout(func() { handleTimer(state, i, entry) })
+	})
+}
+
+func disarmTimers(state State) {
+	for _, timer := range ARMED[state] {
+		timer.Stop()
+	}
+	delete(ARMED, state)
+}
+
+// handleTimer takes the transition of a timer that fell due, a repeating timer starts over while its state stays active
+func handleTimer(state State, i int, entry int) {
+	if !isActive(state) || ENTERED[state] != entry {
+		return
+	}
+	timer := &STATES[state].timers[i]
+	if timer.transition.condition == nil || timer.transition.condition() {
+		applyTransition(state, &timer.transition)
+	}
+	if timer.repeat && isActive(state) && ENTERED[state] == entry {
+		startTimer(state, i, entry)
+	}
+}
+
+// runAutoEvents runs the auto-events of the active states, a state stops once one of its auto-events leaves it
 func runAutoEvents(event string) {
-	if CURRENT_STATE.autoComputation != nil {
-		CURRENT_STATE.autoComputation(event)
+	visited := map[State]bool{}
+	for _, leaf := range append([]State{}, CONFIGURATION...) {
+		for state := leaf; state != NO_STATE && !visited[state]; state = STATES[state].parent {
+			visited[state] = true
+			node := &STATES[state]
+			if !isActive(state) {
+				break
+			}
+			if node.autoComputation != nil {
+				node.autoComputation(event)
+			}
+			for i := range node.autoEventTransitions {
+				autoTransition := &node.autoEventTransitions[i]
+				if !isActive(state) {
+					break
+				}
+				if autoTransition.condition != nil && !autoTransition.condition() {
+					continue
+				}
+				applyTransition(state, autoTransition)
+			}
+		}
+	}
+}
+
+// enter returns the innermost states entered with the state, every region of a parallel state is entered
+func enter(state State) []State {
+	node := &STATES[state]
+	if node.parallel {
+		entered := []State{}
+		for _, region := range node.children {
+			entered = append(entered, enter(region)...)
+		}
+		return entered
+	}
+	if node.initial != NO_STATE {
+		return enter(node.initial)
+	}
+	return []State{state}
+}
+
+func enterTowards(state State, target State) []State {
+	if state == target {
+		return enter(state)
+	}
+	next := childTowards(state, target)
+	if !STATES[state].parallel {
+		return enterTowards(next, target)
+	}
+	entered := []State{}
+	for _, region := range STATES[state].children {
+		if region == next {
+			entered = append(entered, enterTowards(next, target)...)
+		} else {
+			entered = append(entered, enter(region)...)
+		}
+	}
+	return entered
+}
+
+// transitionScope is the innermost proper ancestor of the source containing the target,
+// regions of a parallel state are only left together
+func transitionScope(source State, target State) State {
+	for scope := STATES[source].parent; scope != NO_STATE; scope = STATES[scope].parent {
+		if isDescendant(target, scope) && (!STATES[scope].parallel || childTowards(scope, source) == childTowards(scope, target)) {
+			return scope
+		}
+	}
+	return NO_STATE
+}
+
+func childTowards(scope State, state State) State {
+	for STATES[state].parent != scope {
+		state = STATES[state].parent
+	}
+	return state
+}
+
+func isDescendant(state State, ancestor State) bool {
+	for ; state != NO_STATE; state = STATES[state].parent {
+		if state == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func isActive(state State) bool {
+	for _, leaf := range CONFIGURATION {
+		if isDescendant(leaf, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOtherRegions reports if an active state within the ancestor lies outside of the state
+func hasOtherRegions(ancestor State, state State) bool {
+	for _, leaf := range CONFIGURATION {
+		if isDescendant(leaf, ancestor) && !isDescendant(leaf, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyWithin reports if one of the states is a substate of the ancestor
+func anyWithin(states []State, ancestor State) bool {
+	for _, state := range states {
+		if state != ancestor && isDescendant(state, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendOnce(states []State, state State) []State {
+	for _, other := range states {
+		if other == state {
+			return states
+		}
 	}
-	for _, autoTransition := range CURRENT_STATE.autoEventTransitions {
-		if autoTransition.condition != nil && !autoTransition.condition() {
+	return append(states, state)
+}
+`
+
+const mainImports string = `
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+`
+
+// mainStructure runs a single model as a program
+const mainStructure string = `
+func main() {
+	if len(os.Args) > 1 {
+		data, err := os.ReadFile(os.Args[1])
+		if err == nil {
+			err = restore(data)
+		}
+		if err != nil {
+			fmt.Printf("Cannot resume from %%s: %%s\n", os.Args[1], err.Error())
+			os.Exit(1)
+		}
+	} else {
+		CONFIGURATION = enter(STATE_%[1]s)
+		runEntryActions(statesBetween(STATE_%[1]s, CONFIGURATION))
+		runToCompletion()
+	}
+	lines := make(chan string)
+	go readLines(lines)
+	for {
+		fmt.Printf("State = %%s\n", configurationName())
+		select {
+		case event, more := <-lines:
+			if !more {
+				os.Exit(0)
+			}
+			handleEvent(event)
+		case handle := <-TIMEOUTS:
+			handle()
+		}
+		runToCompletion()
+	}
+}
+
+// readLines hands the lines of the input to the main loop, the channel is closed at the end of the input
+func readLines(lines chan<- string) {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		switch line, err := reader.ReadString('\n'); err {
+		case nil:
+			lines <- line
+		case io.EOF:
+			close(lines)
+			return
+		default:
+			fmt.Print(err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// TIMEOUTS hands the timers that fell due to the main loop, they are handled in between the events
+var TIMEOUTS = make(chan func())
+
+func timeout(handle func()) {
+	TIMEOUTS <- handle
+}
+
+func terminate() {
+	fmt.Println("Terminating")
+	os.Exit(0)
+}
+
+func crash(cause string) {
+	fmt.Printf("Crashed: %%s\n", cause)
+	os.Exit(1)
+}
+
+// send has no system to deliver to, the sent events are only printed
+func send(model string, event string) {
+	fmt.Printf("Sent %%s.%%s\n", model, event)
+}
+`
+
+const packageImports string = `
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+`
+
+// packageStructure makes a model a package of a system, the system sets Send and Timeout and calls Start before handling events
+const packageStructure string = `
+// Send delivers the events sent by the model
+var Send func(model string, event string)
+
+// Timeout hands a timer that fell due to the system, which calls handle in between the events
+var Timeout func(handle func())
+
+// TERMINATED is set once the model terminates, it ignores every event from then on
+var TERMINATED bool
+
+// Start enters the initial state
+func Start() {
+	CONFIGURATION = enter(STATE_%[1]s)
+	runEntryActions(statesBetween(STATE_%[1]s, CONFIGURATION))
+	runToCompletion()
+}
+
+// Restore resumes from a snapshot instead of starting over, see restore
+func Restore(data []byte) error {
+	return restore(data)
+}
+
+// HandleEvent lets the model react to the event, and then to the events it raised meanwhile
+func HandleEvent(event string) {
+	if !TERMINATED {
+		handleEvent(event)
+		runToCompletion()
+	}
+}
+
+// Configuration names the active innermost states
+func Configuration() string {
+	if TERMINATED {
+		return "terminated"
+	}
+	return configurationName()
+}
+
+func terminate() {
+	fmt.Println("%[2]s terminating")
+	TERMINATED = true
+	RAISED = nil
+}
+
+func crash(cause string) {
+	fmt.Printf("%[2]s crashed: %%s\n", cause)
+	TERMINATED = true
+	RAISED = nil
+}
+
+func send(model string, event string) {
+	if Send != nil {
+		Send(model, event)
+	}
+}
+
+func timeout(handle func()) {
+	if Timeout != nil {
+		Timeout(func() {
+			if !TERMINATED {
+				handle()
+				runToCompletion()
+			}
+		})
+	}
+}
+`
+
+const systemStructure string = `/* Generated by AML %s */
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+%s)
+
+type Message struct {
+	model string
+	event string
+}
+
+// QUEUE holds the sent events, they are delivered in order once the current event is handled
+var QUEUE []Message
+
+var MODELS = map[string]func(event string){
+%s}
+
+func main() {
+	send := func(model string, event string) {
+		QUEUE = append(QUEUE, Message{model, event})
+	}
+%s	deliver()
+	lines := make(chan string)
+	go readLines(lines)
+	for {
+		fmt.Printf("State = %%s\n", configurationName())
+		select {
+		case input, more := <-lines:
+			if !more {
+				os.Exit(0)
+			}
+			model, event, found := strings.Cut(strings.TrimSpace(input), ".")
+			if !found {
+				fmt.Println("Expected MODEL.EVENT")
+				continue
+			}
+			QUEUE = append(QUEUE, Message{model, event})
+		case handle := <-TIMEOUTS:
+			handle()
+		}
+		deliver()
+	}
+}
+
+// readLines hands the lines of the input to the main loop, the channel is closed at the end of the input
+func readLines(lines chan<- string) {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		switch line, err := reader.ReadString('\n'); err {
+		case nil:
+			lines <- line
+		case io.EOF:
+			close(lines)
+			return
+		default:
+			fmt.Print(err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// TIMEOUTS hands the timers that fell due in any model to the main loop, they are handled in between the events
+var TIMEOUTS = make(chan func())
+
+func timeout(handle func()) {
+	TIMEOUTS <- handle
+}
+
+func deliver() {
+	for len(QUEUE) > 0 {
+		message := QUEUE[0]
+		QUEUE = QUEUE[1:]
+		handleEvent, known := MODELS[message.model]
+		if !known {
+			fmt.Printf("Unknown model %%s\n", message.model)
 			continue
 		}
-		applyTransition(&autoTransition)
+		handleEvent(message.event)
 	}
 }
+
+func configurationName() string {
+	return strings.Join([]string{
+%s	}, " | ")
+}
 `
 
-func generateCode(model *FiniteStateMachine) string {
+func generateSystemMain(system *System) string {
+	imports := "\n"
+	var models, start, configuration string
+	for _, model := range system.GetMachines() {
+		packageName := generatePackageName(model.GetModelName())
+		imports += fmt.Sprintf("\t\"srcgen/%s\"\n", packageName)
+		models += fmt.Sprintf("\t%q: %s.HandleEvent,\n", model.GetModelName(), packageName)
+		start += fmt.Sprintf("\t%[1]s.Send = send\n\t%[1]s.Timeout = timeout\n\t%[1]s.Start()\n", packageName)
+		configuration += fmt.Sprintf("\t\t\"%s: \" + %s.Configuration(),\n", model.GetModelName(), packageName)
+	}
+	return fmt.Sprintf(systemStructure, GENERATOR_VERSION, imports, models, start, configuration)
+}
+
+// generatePackageName turns the model name into a package name, keeping clear of keywords and the imports of main
+func generatePackageName(modelName string) string {
+	name := strings.Map(func(char rune) rune {
+		if unicode.IsLetter(char) || unicode.IsDigit(char) {
+			return unicode.ToLower(char)
+		}
+		return '_'
+	}, modelName)
+	switch {
+	case len(name) == 0 || unicode.IsDigit(rune(name[0])):
+		name = "model_" + name
+	case token.IsKeyword(name):
+		name += "_model"
+	}
+	switch name {
+	case "main", "bufio", "fmt", "io", "os", "strings":
+		name += "_model"
+	}
+	return name
+}
+
+func generateCode(model *FiniteStateMachine, packageName string, imports string, section string) string {
+	var enums string
+	for _, enum := range model.variables.GetEnums() {
+		enums += fmt.Sprintf("type %s int\n\nconst ( /* %s */\n", enum.Name, enum.Name)
+		for i, member := range enum.Members {
+			if i == 0 {
+				enums += fmt.Sprintf("\t%s %s = iota\n", member, enum.Name)
+			} else {
+				enums += fmt.Sprintf("\t%s\n", member)
+			}
+		}
+		enums += ")\n"
+	}
 	var variables string
-	for varName, varValue := range model.variables.values {
-		variables += fmt.Sprintf("\t%s = %v\n", varName, varValue)
+	// the values as declared, before the entry actions of the initial states ran
+	for varName, varValue := range model.declared.values {
+		switch varType := model.variables.GetType(varName); varType {
+		case ENUM:
+			variables += fmt.Sprintf("\t%s %s = %s\n", varName, model.variables.GetEnumType(varName), varValue)
+		default:
+			variables += fmt.Sprintf("\t%s %s = %s\n", varName, varType.GoType(), formatValue(normalize(varValue)))
+		}
 	}
 	var states string
 	stateCount := 0
@@ -167,35 +868,190 @@ func generateCode(model *FiniteStateMachine) string {
 				autoEvent.compuatations.Generate(),
 			)
 		}
-		transitions += fmt.Sprintf("\t{\"%s\",\n\t\t%s,\n\t\t[]Transition{ /* AUTO-EVENTS */\n%s\t\t},\n\t\tmap[string][]Transition{ /* STATE_%s */\n",
+		children := make([]string, len(state.children))
+		for i, child := range state.children {
+			children[i] = "STATE_" + child
+		}
+		transitions += fmt.Sprintf("\t{\"%s\", %s, %s, %t, []State{%s},\n\t\t%s,\n\t\t%s,\n\t\t%s,\n\t\t[]Transition{ /* AUTO-EVENTS */\n%s\t\t},\n\t\tmap[string][]Transition{ /* STATE_%s */\n",
 			stateName,
+			generateStateRef(state.GetParent()),
+			generateStateRef(state.GetInitial()),
+			state.parallel,
+			strings.Join(children, ", "),
+			state.entry.Generate(),
+			state.exit.Generate(),
 			defaultComputation,
 			autoEvents,
 			stateName)
 		for event, edges := range state.GetTransitions() {
 			transitions += fmt.Sprintf("\t\t\t\"%s\": {\n", event)
 			for _, edge := range edges {
-				var resultState string
-				switch edge.terminate {
-				case mode.TERMINATE:
-					resultState = "TERMINATION_STATE"
-				default:
-					resultState = fmt.Sprintf("STATE_%s", edge.resultingState.Get())
-				}
 				transitions += fmt.Sprintf("\t\t\t\t{%s, %s, %s}, /* %s */\n",
 					edge.condition2.Generate(),
-					resultState,
+					generateResultingState(edge),
 					//GenerateComputation("func()", &edge.computation2),
 					edge.computation2.Generate(),
 					edge.metaData.rawLine)
 			}
 			transitions += "\t\t\t},\n"
 		}
+		transitions += "\t\t},\n\t\t[]Timer{ /* TIMERS */\n"
+		for _, timer := range state.timers {
+			transitions += fmt.Sprintf("\t\t\t{%d, %t, Transition{%s, %s, %s}}, /* %s */\n",
+				timer.delay,
+				timer.repeat,
+				timer.edge.condition2.Generate(),
+				generateResultingState(timer.edge),
+				timer.edge.computation2.Generate(),
+				timer.edge.metaData.rawLine)
+		}
 		transitions += "\t\t},\n\t},\n"
 		stateCount++
 	}
-	initialState := model.currentState.Get().GetName()
-	return fmt.Sprintf(codeStructure, GENERATOR_VERSION, variables, states, transitions, initialState)
+	choiceNames := make([]string, 0, len(model.choices))
+	for choiceName := range model.choices {
+		choiceNames = append(choiceNames, choiceName)
+	}
+	sort.Strings(choiceNames)
+	var choices string
+	for _, choiceName := range choiceNames {
+		choice := model.choices[choiceName]
+		states += fmt.Sprintf("\tSTATE_%s State = %d /* CHOICE */\n", choiceName, stateCount)
+		stateCount++
+		choices += fmt.Sprintf("\tSTATE_%s: {\n", choiceName)
+		branches := choice.branches
+		choice.otherwise.HasValue(func(otherwise *Edge) {
+			branches = append(append([]*Edge{}, branches...), otherwise)
+		})
+		for _, branch := range branches {
+			choices += fmt.Sprintf("\t\t{%s, %s, %s}, /* %s */\n",
+				branch.condition2.Generate(),
+				generateResultingState(branch),
+				branch.computation2.Generate(),
+				branch.metaData.rawLine)
+		}
+		choices += "\t},\n"
+	}
+	parameters, setters := generateParameters(model)
+	return fmt.Sprintf(codeStructure, GENERATOR_VERSION, packageName, imports, enums, variables, states, transitions, choices, parameters, setters, model.maxMicrosteps) + generateRestore(model) + section
+}
+
+// restoreStructure reads the JSON form of a Snapshot
+const restoreStructure string = `
+// MODEL_HASH identifies the model, only a snapshot of a model with the same hash is resumed
+const MODEL_HASH = %q
+
+// restore resumes from the JSON form of a snapshot taken of the same model, the timers of the active states start over
+func restore(data []byte) error {
+	var snapshot struct {
+		Hash          string   ` + "`json:\"hash\"`" + `
+		Configuration []string ` + "`json:\"configuration\"`" + `
+		Variables     []struct {
+			Name  string          ` + "`json:\"name\"`" + `
+			Value json.RawMessage ` + "`json:\"value\"`" + `
+		} ` + "`json:\"variables\"`" + `
+		Mode int ` + "`json:\"mode\"`" + `
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if snapshot.Hash != MODEL_HASH {
+		return fmt.Errorf("the snapshot is of another model")
+	}
+	if snapshot.Mode == %d || snapshot.Mode == %d {
+		return fmt.Errorf("the model had stopped")
+	}
+	configuration := make([]State, len(snapshot.Configuration))
+	for i, name := range snapshot.Configuration {
+		configuration[i] = NO_STATE
+		for state := range STATES {
+			if STATES[state].name == name {
+				configuration[i] = State(state)
+			}
+		}
+		if configuration[i] == NO_STATE {
+			return fmt.Errorf("unknown state %%s", name)
+		}
+	}
+	for _, variable := range snapshot.Variables {
+		if err := restoreVariable(variable.Name, variable.Value); err != nil {
+			return err
+		}
+	}
+	CONFIGURATION = configuration
+	for state := range STATES {
+		if isActive(State(state)) {
+			armTimers(State(state))
+		}
+	}
+	return nil
+}
+
+func restoreVariable(name string, value json.RawMessage) error {
+	switch name {
+%s	}
+	return fmt.Errorf("unknown variable %%s", name)
+}
+`
+
+// generateRestore reads the variables from a snapshot, the members of enums are read by name
+func generateRestore(model *FiniteStateMachine) string {
+	var cases string
+	for _, name := range sortedKeys(model.declared.types) {
+		cases += fmt.Sprintf("\tcase %q:\n", name)
+		if model.declared.GetType(name) != ENUM {
+			cases += fmt.Sprintf("\t\treturn json.Unmarshal(value, &%s)\n", name)
+			continue
+		}
+		enum := model.declared.GetEnum(model.declared.GetEnumType(name)).Get()
+		cases += "\t\tvar member string\n\t\tif err := json.Unmarshal(value, &member); err != nil {\n\t\t\treturn err\n\t\t}\n\t\tswitch member {\n"
+		for _, member := range enum.Members {
+			cases += fmt.Sprintf("\t\tcase %q:\n\t\t\t%s = %s\n", member, name, member)
+		}
+		cases += fmt.Sprintf("\t\tdefault:\n\t\t\treturn fmt.Errorf(\"%%s is not a %s\", member)\n\t\t}\n\t\treturn nil\n", enum.Name)
+	}
+	return fmt.Sprintf(restoreStructure, model.GetHash(), mode.TERMINATE, mode.CRASH, cases)
+}
+
+// generateParameters declares a variable for every event parameter, along with the functions setting them from arguments
+func generateParameters(model *FiniteStateMachine) (string, string) {
+	var parameters, setters string
+	declared := map[string]bool{}
+	events := make([]string, 0, len(model.events))
+	for event := range model.events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	for _, event := range events {
+		if len(model.events[event]) == 0 {
+			continue
+		}
+		setters += fmt.Sprintf("\t%q: func(arguments []string) (err error) {\n", event)
+		for i, parameter := range model.events[event] {
+			if !declared[parameter.Name] {
+				declared[parameter.Name] = true
+				parameters += fmt.Sprintf("\t%s %s\n", parameter.Name, parameter.Type.GoType())
+			}
+			parse := "parse" + strings.ToUpper(parameter.Type.String()[:1]) + parameter.Type.String()[1:]
+			setters += fmt.Sprintf("\t\tif %s, err = %s(arguments, %d); err != nil {\n\t\t\treturn err\n\t\t}\n", parameter.Name, parse, i)
+		}
+		setters += "\t\treturn nil\n\t},\n"
+	}
+	return parameters, setters
+}
+
+func generateResultingState(edge *Edge) string {
+	if edge.terminate == mode.TERMINATE {
+		return "TERMINATION_STATE"
+	}
+	return "STATE_" + edge.resultingState.Get()
+}
+
+func generateStateRef(state types.Option[string]) string {
+	if state.IsNone() {
+		return "NO_STATE"
+	}
+	return "STATE_" + state.Get()
 }
 
 /* func GenerateComputation(funcSignature string, computations *[]Computation) string {
@@ -0,0 +1,98 @@
+package fsm
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ParseFS parses the named file of fsys along with the files it includes or imports, the file is nil when it cannot be read
+func ParseFS(fsys fs.FS, name string) (*File, Diagnostics) {
+	name = path.Clean(name)
+	contents, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		diagnostics := Diagnostics{}
+		diagnostics.Errorf(name, Span{}, CODE_INCLUDE_NOT_FOUND, "cannot read %s, %s", name, err.Error())
+		return nil, diagnostics
+	}
+	file, diagnostics := ParseFile(name, string(contents))
+	r := resolver{fsys: fsys}
+	r.resolveFile(file, map[string]bool{name: true})
+	return file, append(diagnostics, r.diagnostics...)
+}
+
+// resolver follows the include and import directives of a file, reading the included files from fsys
+type resolver struct {
+	fsys        fs.FS
+	open        []string
+	diagnostics Diagnostics
+}
+
+// resolveIncludes reports the directives of a file parsed without a file system, they cannot be followed
+func resolveIncludes(file *File) Diagnostics {
+	r := resolver{}
+	r.resolveFile(file, map[string]bool{})
+	return r.diagnostics
+}
+
+// resolveFile reads the files included into the file, imported holds the files already merged into its top level model
+func (r *resolver) resolveFile(file *File, imported map[string]bool) {
+	r.open = append(r.open, file.FileName)
+	r.resolve(file.FileName, &file.Declarations, true, imported)
+	for _, modelDecl := range file.Models {
+		r.resolve(file.FileName, &modelDecl.Declarations, false, map[string]bool{})
+	}
+	r.open = r.open[:len(r.open)-1]
+}
+
+// resolve reads the files included into the declarations, only files included at the top level may declare models.
+// A file is imported once into each model.
+func (r *resolver) resolve(fileName string, declarations *Declarations, topLevel bool, imported map[string]bool) {
+	for _, include := range declarations.Includes {
+		directive := "include"
+		if include.Import {
+			directive = "import"
+		}
+		if r.fsys == nil {
+			r.diagnostics.Errorf(fileName, include.Span, CODE_INCLUDE_NOT_FOUND, "cannot %s %s without a file system, load the model with LoadFS", directive, include.Path)
+			continue
+		}
+		target := path.Join(path.Dir(fileName), include.Path)
+		if !fs.ValidPath(target) {
+			r.diagnostics.Errorf(fileName, include.Span, CODE_INCLUDE_NOT_FOUND, "cannot %s %s, it is outside of the file system", directive, include.Path)
+			continue
+		}
+		if cycle := r.cycleTo(target); len(cycle) > 0 {
+			r.diagnostics.Errorf(fileName, include.Span, CODE_INCLUDE_CYCLE, "cannot %s %s, it would include itself: %s", directive, include.Path, cycle)
+			continue
+		}
+		if include.Import && imported[target] {
+			continue
+		}
+		contents, err := fs.ReadFile(r.fsys, target)
+		if err != nil {
+			r.diagnostics.Errorf(fileName, include.Span, CODE_INCLUDE_NOT_FOUND, "cannot %s %s, %s", directive, include.Path, err.Error())
+			continue
+		}
+		imported[target] = true
+		file, diagnostics := ParseFile(target, string(contents))
+		r.diagnostics = append(r.diagnostics, diagnostics...)
+		r.diagnostics = append(r.diagnostics, checkSyntax(target, file)...)
+		if !topLevel && len(file.Models) > 0 {
+			r.diagnostics.Errorf(fileName, include.Span, CODE_MULTIPLE_MODELS, "cannot %s %s into a model block, it declares models of its own", directive, include.Path)
+			continue
+		}
+		include.File = file
+		r.resolveFile(file, imported)
+	}
+}
+
+// cycleTo returns the chain of open files from the target back to itself, empty when the target is not open
+func (r *resolver) cycleTo(target string) string {
+	for i, open := range r.open {
+		if open == target {
+			return strings.Join(append(append([]string{}, r.open[i:]...), target), " -> ")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,354 @@
+package fsm
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenKind uint
+
+const (
+	TOKEN_EOF        TokenKind = 0
+	TOKEN_ILLEGAL    TokenKind = 1
+	TOKEN_IDENT      TokenKind = 2  // STATE_1
+	TOKEN_INT        TokenKind = 3  // 10
+	TOKEN_FLOAT      TokenKind = 4  // 0.5
+	TOKEN_STRING     TokenKind = 5  // "some string"
+	TOKEN_KEYWORD    TokenKind = 6  // state
+	TOKEN_LBRACE     TokenKind = 7  // {
+	TOKEN_RBRACE     TokenKind = 8  // }
+	TOKEN_LPAREN     TokenKind = 9  // (
+	TOKEN_RPAREN     TokenKind = 10 // )
+	TOKEN_COMMA      TokenKind = 11 // ,
+	TOKEN_ARROW      TokenKind = 12 // ->
+	TOKEN_TERMINATE  TokenKind = 13 // -x
+	TOKEN_AUTO_RUN   TokenKind = 14 // >>
+	TOKEN_AUTO_EVENT TokenKind = 15 // |>
+	TOKEN_MINUS      TokenKind = 16 // -
+	TOKEN_ASSIGN     TokenKind = 17 // =
+	TOKEN_ADD_ASSIGN TokenKind = 18 // +=
+	TOKEN_SUB_ASSIGN TokenKind = 19 // -=
+	TOKEN_MUL_ASSIGN TokenKind = 20 // *=
+	TOKEN_DIV_ASSIGN TokenKind = 21 // /=
+	TOKEN_EQ         TokenKind = 22 // ==
+	TOKEN_NE         TokenKind = 23 // !=
+	TOKEN_GT         TokenKind = 24 // >
+	TOKEN_GE         TokenKind = 25 // >=
+	TOKEN_LT         TokenKind = 26 // <
+	TOKEN_LE         TokenKind = 27 // <=
+	TOKEN_AND        TokenKind = 28 // &&
+	TOKEN_OR         TokenKind = 29 // ||
+	TOKEN_NOT        TokenKind = 30 // !
+	TOKEN_PLUS       TokenKind = 31 // +
+	TOKEN_STAR       TokenKind = 32 // *
+	TOKEN_SLASH      TokenKind = 33 // /
+	TOKEN_PERCENT    TokenKind = 34 // %
+	TOKEN_COLON      TokenKind = 35 // :
+	TOKEN_DOT        TokenKind = 36 // .
+	TOKEN_DURATION   TokenKind = 37 // 500ms
+)
+
+var keywords = map[string]bool{
+	"syntax":   true,
+	"model":    true,
+	"var":      true,
+	"init":     true,
+	"state":    true,
+	"parallel": true,
+	"enum":     true,
+	"entry":    true,
+	"exit":     true,
+	"send":     true,
+	"raise":    true,
+	"include":  true,
+	"import":   true,
+	"event":    true,
+	"after":    true,
+	"every":    true,
+	"choice":   true,
+	"else":     true,
+}
+
+// operators are matched longest first, so "->" wins over "-" and ">=" over ">"
+var operators = []struct {
+	text string
+	kind TokenKind
+}{
+	{"->", TOKEN_ARROW},
+	{">>", TOKEN_AUTO_RUN},
+	{"|>", TOKEN_AUTO_EVENT},
+	{"+=", TOKEN_ADD_ASSIGN},
+	{"-=", TOKEN_SUB_ASSIGN},
+	{"*=", TOKEN_MUL_ASSIGN},
+	{"/=", TOKEN_DIV_ASSIGN},
+	{"==", TOKEN_EQ},
+	{"!=", TOKEN_NE},
+	{">=", TOKEN_GE},
+	{"<=", TOKEN_LE},
+	{"&&", TOKEN_AND},
+	{"||", TOKEN_OR},
+	{">", TOKEN_GT},
+	{"<", TOKEN_LT},
+	{"=", TOKEN_ASSIGN},
+	{"!", TOKEN_NOT},
+	{"-", TOKEN_MINUS},
+	{"+", TOKEN_PLUS},
+	{"*", TOKEN_STAR},
+	{"/", TOKEN_SLASH},
+	{"%", TOKEN_PERCENT},
+	{"{", TOKEN_LBRACE},
+	{"}", TOKEN_RBRACE},
+	{"(", TOKEN_LPAREN},
+	{")", TOKEN_RPAREN},
+	{",", TOKEN_COMMA},
+	{":", TOKEN_COLON},
+	{".", TOKEN_DOT},
+}
+
+func (kind TokenKind) String() string {
+	switch kind {
+	case TOKEN_EOF:
+		return "end of file"
+	case TOKEN_ILLEGAL:
+		return "illegal token"
+	case TOKEN_IDENT:
+		return "identifier"
+	case TOKEN_INT:
+		return "int"
+	case TOKEN_FLOAT:
+		return "float"
+	case TOKEN_STRING:
+		return "string"
+	case TOKEN_DURATION:
+		return "duration"
+	case TOKEN_KEYWORD:
+		return "keyword"
+	case TOKEN_TERMINATE:
+		return "'-x'"
+	}
+	for _, operator := range operators {
+		if operator.kind == kind {
+			return fmt.Sprintf("'%s'", operator.text)
+		}
+	}
+	return "unknown token"
+}
+
+// Pos is a location in the source. Line and Column are 1-based, Column counts runes.
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (pos Pos) String() string {
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+type Token struct {
+	Kind  TokenKind
+	Text  string
+	Start Pos
+	End   Pos
+}
+
+func (token Token) Span() Span {
+	return Span{Start: token.Start, End: token.End}
+}
+
+func (token Token) String() string {
+	switch token.Kind {
+	case TOKEN_EOF:
+		return token.Kind.String()
+	default:
+		return fmt.Sprintf("'%s'", token.Text)
+	}
+}
+
+type Lexer struct {
+	source string
+	pos    Pos
+}
+
+func NewLexer(source string) Lexer {
+	return Lexer{
+		source: source,
+		pos:    Pos{Offset: 0, Line: 1, Column: 1},
+	}
+}
+
+// Tokenize runs the lexer to the end of the source, the last token is always TOKEN_EOF
+func Tokenize(source string) []Token {
+	lexer := NewLexer(source)
+	tokens := []Token{}
+	for {
+		token := lexer.Next()
+		tokens = append(tokens, token)
+		if token.Kind == TOKEN_EOF {
+			return tokens
+		}
+	}
+}
+
+func (lexer *Lexer) Next() Token {
+	lexer.skipWhitespaceAndComments()
+	start := lexer.pos
+	if lexer.pos.Offset >= len(lexer.source) {
+		return Token{Kind: TOKEN_EOF, Start: start, End: start}
+	}
+	char := lexer.peek(0)
+	switch {
+	case char == '"':
+		return lexer.lexString()
+	case isDigit(char):
+		return lexer.lexNumber()
+	case isIdentStart(char):
+		return lexer.lexIdent()
+	case char == '-' && lexer.peek(1) == 'x' && !isIdentPart(lexer.peek(2)):
+		lexer.advance()
+		lexer.advance()
+		return lexer.token(TOKEN_TERMINATE, start)
+	}
+	for _, operator := range operators {
+		if hasPrefixAt(lexer.source, lexer.pos.Offset, operator.text) {
+			for range operator.text {
+				lexer.advance()
+			}
+			return lexer.token(operator.kind, start)
+		}
+	}
+	lexer.advance()
+	return lexer.token(TOKEN_ILLEGAL, start)
+}
+
+func (lexer *Lexer) token(kind TokenKind, start Pos) Token {
+	return Token{
+		Kind:  kind,
+		Text:  lexer.source[start.Offset:lexer.pos.Offset],
+		Start: start,
+		End:   lexer.pos,
+	}
+}
+
+func (lexer *Lexer) lexString() Token {
+	start := lexer.pos
+	lexer.advance() // opening quote
+	for lexer.pos.Offset < len(lexer.source) {
+		switch lexer.peek(0) {
+		case '\\':
+			lexer.advance()
+			if lexer.peek(0) != '\n' {
+				lexer.advance()
+			}
+		case '\n':
+			// unterminated string, stop at the end of the line
+			return lexer.token(TOKEN_ILLEGAL, start)
+		case '"':
+			lexer.advance()
+			return lexer.token(TOKEN_STRING, start)
+		default:
+			lexer.advance()
+		}
+	}
+	return lexer.token(TOKEN_ILLEGAL, start)
+}
+
+// lexNumber reads an int or a float, a number directly followed by a unit is a duration such as 500ms or 1m30s
+func (lexer *Lexer) lexNumber() Token {
+	start := lexer.pos
+	kind := TOKEN_INT
+	for isDigit(lexer.peek(0)) {
+		lexer.advance()
+	}
+	if lexer.peek(0) == '.' && isDigit(lexer.peek(1)) {
+		lexer.advance() // decimal point
+		for isDigit(lexer.peek(0)) {
+			lexer.advance()
+		}
+		kind = TOKEN_FLOAT
+	}
+	if !isIdentStart(lexer.peek(0)) {
+		return lexer.token(kind, start)
+	}
+	for isIdentPart(lexer.peek(0)) || (lexer.peek(0) == '.' && isDigit(lexer.peek(1))) {
+		lexer.advance()
+	}
+	return lexer.token(TOKEN_DURATION, start)
+}
+
+func (lexer *Lexer) lexIdent() Token {
+	start := lexer.pos
+	for isIdentPart(lexer.peek(0)) {
+		lexer.advance()
+	}
+	token := lexer.token(TOKEN_IDENT, start)
+	if keywords[token.Text] {
+		token.Kind = TOKEN_KEYWORD
+	}
+	return token
+}
+
+func (lexer *Lexer) skipWhitespaceAndComments() {
+	for lexer.pos.Offset < len(lexer.source) {
+		char := lexer.peek(0)
+		switch {
+		case unicode.IsSpace(char):
+			lexer.advance()
+		case char == '/' && lexer.peek(1) == '/':
+			for lexer.pos.Offset < len(lexer.source) && lexer.peek(0) != '\n' {
+				lexer.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the rune n runes ahead of the current position, or 0 past the end of the source
+func (lexer *Lexer) peek(n int) rune {
+	offset := lexer.pos.Offset
+	for ; n > 0 && offset < len(lexer.source); n-- {
+		_, size := utf8.DecodeRuneInString(lexer.source[offset:])
+		offset += size
+	}
+	if offset >= len(lexer.source) {
+		return 0
+	}
+	char, _ := utf8.DecodeRuneInString(lexer.source[offset:])
+	return char
+}
+
+func (lexer *Lexer) advance() {
+	char, size := utf8.DecodeRuneInString(lexer.source[lexer.pos.Offset:])
+	lexer.pos.Offset += size
+	switch {
+	case char == '\n':
+		lexer.pos.Line++
+		lexer.pos.Column = 1
+	case char == '\r' && lexer.peek(0) != '\n':
+		// old style line ending without a line feed
+		lexer.pos.Line++
+		lexer.pos.Column = 1
+	case char == '\r':
+		// part of \r\n, the line is advanced by the \n
+	default:
+		lexer.pos.Column++
+	}
+}
+
+func hasPrefixAt(source string, offset int, prefix string) bool {
+	return len(source)-offset >= len(prefix) && source[offset:offset+len(prefix)] == prefix
+}
+
+func isDigit(char rune) bool {
+	return '0' <= char && char <= '9'
+}
+
+func isIdentStart(char rune) bool {
+	return char == '_' || unicode.IsLetter(char)
+}
+
+func isIdentPart(char rune) bool {
+	return isIdentStart(char) || unicode.IsDigit(char)
+}
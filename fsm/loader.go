@@ -0,0 +1,717 @@
+package fsm
+
+import (
+	"io/fs"
+	"strconv"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/logger"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+var plog logger.Logger = logger.New("PARSER")
+
+// FromString builds the model and logs the diagnostics, use Load to inspect them instead
+func FromString(str string) types.Option[FiniteStateMachine] {
+	plog.Info("Building model ...")
+
+	model, diagnostics := Load("", str)
+	for _, diagnostic := range diagnostics {
+		switch diagnostic.Severity {
+		case SEVERITY_ERROR:
+			plog.Error(diagnostic.String())
+		case SEVERITY_WARNING:
+			plog.Warn(diagnostic.String())
+		default:
+			plog.Info(diagnostic.String())
+		}
+	}
+	if model.IsSome() {
+		plog.Info("Building complete")
+	}
+	return model
+}
+
+// Load parses and builds the model. No model is returned when the diagnostics have errors,
+// callers decide themselves if warnings should stop them.
+// A file with several models is loaded with LoadSystem, one with include directives with LoadFS.
+func Load(fileName, source string) (types.Option[FiniteStateMachine], Diagnostics) {
+	file, diagnostics := ParseFile(fileName, source)
+	diagnostics = append(diagnostics, resolveIncludes(file)...)
+	return loadFile(file, diagnostics)
+}
+
+// LoadFS is Load for the named file of fsys, following its include and import directives
+func LoadFS(fsys fs.FS, name string) (types.Option[FiniteStateMachine], Diagnostics) {
+	file, diagnostics := ParseFS(fsys, name)
+	if file == nil {
+		return types.None[FiniteStateMachine](), diagnostics
+	}
+	return loadFile(file, diagnostics)
+}
+
+func loadFile(file *File, diagnostics Diagnostics) (types.Option[FiniteStateMachine], Diagnostics) {
+	definition, diagnostics := defineFile(file, diagnostics)
+	if definition.IsNone() {
+		return types.None[FiniteStateMachine](), diagnostics
+	}
+	return types.Some(definition.Get().NewInstance()), diagnostics
+}
+
+// LoadDefinition is Load for a model that many machines are made from, see Definition
+func LoadDefinition(fileName, source string) (types.Option[*Definition], Diagnostics) {
+	file, diagnostics := ParseFile(fileName, source)
+	diagnostics = append(diagnostics, resolveIncludes(file)...)
+	return defineFile(file, diagnostics)
+}
+
+func defineFile(file *File, diagnostics Diagnostics) (types.Option[*Definition], Diagnostics) {
+	if models := file.GetModels(); len(models) > 1 {
+		diagnostics.Errorf(file.FileName, models[1].Span, CODE_MULTIPLE_MODELS, "the file declares %d models, load it as a system", len(models))
+		return types.None[*Definition](), diagnostics
+	}
+	builder := NewFsmBuilder()
+	diagnostics = append(diagnostics, FromFile(file.FileName, file, &builder)...)
+	if builder.initialState.IsNone() {
+		diagnostics.Errorf(file.FileName, file.Span, CODE_MISSING_INITIAL, "no initial state provided")
+	}
+	if diagnostics.HasErrors() {
+		return types.None[*Definition](), diagnostics
+	}
+	// the problems Define finds are among the diagnostics already, where they are declared
+	definition, _ := builder.Define()
+	return types.Some(definition), diagnostics
+}
+
+// Source is the name and contents of an .aml file
+type Source struct {
+	Name     string
+	Contents string
+}
+
+// LoadSystem parses and builds every model of the sources into one system. Models are named,
+// so that they can send events to each other, and the names must be unique across the sources.
+// No system is returned when the diagnostics have errors.
+func LoadSystem(sources ...Source) (types.Option[System], Diagnostics) {
+	files := make([]*File, len(sources))
+	diagnostics := Diagnostics{}
+	for i, source := range sources {
+		file, fileDiagnostics := ParseFile(source.Name, source.Contents)
+		diagnostics = append(diagnostics, fileDiagnostics...)
+		diagnostics = append(diagnostics, resolveIncludes(file)...)
+		files[i] = file
+	}
+	return loadSystem(files, diagnostics)
+}
+
+// LoadSystemFS is LoadSystem for the named files of fsys, following their include and import directives
+func LoadSystemFS(fsys fs.FS, names ...string) (types.Option[System], Diagnostics) {
+	files := make([]*File, 0, len(names))
+	diagnostics := Diagnostics{}
+	for _, name := range names {
+		file, fileDiagnostics := ParseFS(fsys, name)
+		diagnostics = append(diagnostics, fileDiagnostics...)
+		if file == nil {
+			return types.None[System](), diagnostics
+		}
+		files = append(files, file)
+	}
+	return loadSystem(files, diagnostics)
+}
+
+func loadSystem(files []*File, diagnostics Diagnostics) (types.Option[System], Diagnostics) {
+	models := []*ModelDecl{}
+	declared := map[string]*ModelDecl{}
+	for _, file := range files {
+		diagnostics = append(diagnostics, checkSyntax(file.FileName, file)...)
+		for _, modelDecl := range file.GetModels() {
+			if len(modelDecl.Name) == 0 {
+				diagnostics.Errorf(modelDecl.FileName, modelDecl.Span, CODE_MISSING_NAME, "the models of a system must be named")
+				continue
+			}
+			if other, exists := declared[modelDecl.Name]; exists {
+				diagnostics.Errorf(modelDecl.FileName, modelDecl.Span, CODE_DUPLICATE_MODEL, "model %s is already declared on line %d of %s", modelDecl.Name, other.Start.Line, other.FileName)
+				continue
+			}
+			declared[modelDecl.Name] = modelDecl
+			models = append(models, modelDecl)
+		}
+	}
+	machines := make([]*FiniteStateMachine, 0, len(models))
+	for _, modelDecl := range models {
+		for _, unit := range unitsOf(modelDecl.FileName, &modelDecl.Declarations) {
+			diagnostics = append(diagnostics, checkSends(unit.fileName, unit.declarations.States, declared)...)
+			diagnostics = append(diagnostics, checkChoiceSends(unit.fileName, unit.declarations.Choices, declared)...)
+		}
+		builder := NewFsmBuilder()
+		diagnostics = append(diagnostics, fromModel(modelDecl, &builder)...)
+		if builder.initialState.IsNone() {
+			diagnostics.Errorf(modelDecl.FileName, modelDecl.Span, CODE_MISSING_INITIAL, "no initial state provided for model %s", modelDecl.Name)
+			continue
+		}
+		machine, _ := builder.Build()
+		machines = append(machines, &machine)
+	}
+	if len(machines) == 0 || diagnostics.HasErrors() {
+		return types.None[System](), diagnostics
+	}
+	return types.Some(NewSystem(machines...)), diagnostics
+}
+
+// sourceUnit is a part of a model along with the file it was declared in
+type sourceUnit struct {
+	fileName     string
+	declarations *Declarations
+}
+
+// unitsOf lists the parts of a model in the order they are loaded, included files before the file including them
+func unitsOf(fileName string, declarations *Declarations) []sourceUnit {
+	units := []sourceUnit{}
+	for _, include := range declarations.Includes {
+		if include.File != nil {
+			units = append(units, unitsOf(include.File.FileName, &include.File.Declarations)...)
+		}
+	}
+	return append(units, sourceUnit{fileName: fileName, declarations: declarations})
+}
+
+// checkSends reports events sent to models that are not declared, or that have no transition on the event
+func checkSends(fileName string, stateDecls []*StateDecl, models map[string]*ModelDecl) Diagnostics {
+	return checkSent(fileName, stateComputations(stateDecls), models)
+}
+
+// checkChoiceSends is checkSends for the branches of choices
+func checkChoiceSends(fileName string, choiceDecls []*ChoiceDecl, models map[string]*ModelDecl) Diagnostics {
+	return checkSent(fileName, choiceComputations(choiceDecls), models)
+}
+
+// stateComputations lists the computations of the states and their substates
+func stateComputations(stateDecls []*StateDecl) []*ComputationDecl {
+	computations := []*ComputationDecl{}
+	for _, stateDecl := range stateDecls {
+		computations = append(append(append(computations, stateDecl.Entry...), stateDecl.Exit...), stateDecl.AutoComputations...)
+		for _, transition := range append(append(append([]*TransitionDecl{}, stateDecl.AutoEvents...), stateDecl.Transitions...), stateDecl.Timers...) {
+			computations = append(computations, transition.Updates...)
+		}
+		computations = append(computations, stateComputations(stateDecl.States)...)
+	}
+	return computations
+}
+
+// choiceComputations lists the computations of the branches of the choices
+func choiceComputations(choiceDecls []*ChoiceDecl) []*ComputationDecl {
+	computations := []*ComputationDecl{}
+	for _, choiceDecl := range choiceDecls {
+		for _, branch := range append(append([]*TransitionDecl{}, choiceDecl.Branches...), choiceDecl.Else) {
+			if branch != nil {
+				computations = append(computations, branch.Updates...)
+			}
+		}
+	}
+	return computations
+}
+
+func checkSent(fileName string, computations []*ComputationDecl, models map[string]*ModelDecl) Diagnostics {
+	diagnostics := Diagnostics{}
+	for _, computation := range computations {
+		if computation.Send == nil || len(computation.Send.Model) == 0 {
+			continue
+		}
+		target, exists := models[computation.Send.Model]
+		if !exists {
+			diagnostics.Errorf(fileName, computation.Span, CODE_UNKNOWN_MODEL, "cannot send %s.%s, model %s is not declared", computation.Send.Model, computation.Send.Event, computation.Send.Model)
+		} else if !modelHandles(target, computation.Send.Event) {
+			diagnostics.Warnf(fileName, computation.Span, CODE_UNHANDLED_EVENT, "model %s has no transition on %s", computation.Send.Model, computation.Send.Event)
+		}
+	}
+	return diagnostics
+}
+
+func modelHandles(modelDecl *ModelDecl, event string) bool {
+	for _, unit := range unitsOf(modelDecl.FileName, &modelDecl.Declarations) {
+		if handlesEvent(unit.declarations.States, event) {
+			return true
+		}
+	}
+	return false
+}
+
+func handlesEvent(stateDecls []*StateDecl, event string) bool {
+	for _, stateDecl := range stateDecls {
+		for _, transition := range stateDecl.Transitions {
+			if transition.Event == event {
+				return true
+			}
+		}
+		if handlesEvent(stateDecl.States, event) {
+			return true
+		}
+	}
+	return false
+}
+
+type loader struct {
+	fileName    string
+	builder     *FsmBuilder
+	checker     typeChecker
+	declared    map[string]bool
+	parameters  map[string]*EventDecl
+	diagnostics Diagnostics
+}
+
+// FromFile populates the builder with the declarations of a parsed file, the first model when it declares several
+func FromFile(fileName string, file *File, builder *FsmBuilder) Diagnostics {
+	diagnostics := checkSyntax(fileName, file)
+	modelDecl := file.GetModels()[0]
+	modelDecl.FileName = fileName
+	return append(diagnostics, fromModel(modelDecl, builder)...)
+}
+
+func checkSyntax(fileName string, file *File) Diagnostics {
+	diagnostics := Diagnostics{}
+	if file.Syntax == nil {
+		diagnostics.Warnf(fileName, Span{Start: file.Start, End: file.Start}, CODE_MISSING_SYNTAX, "missing 'syntax fsm' declaration")
+	} else if file.Syntax.Name != "fsm" {
+		diagnostics.Errorf(fileName, file.Syntax.Span, CODE_MISSING_SYNTAX, "unsupported syntax '%s', expected 'fsm'", file.Syntax.Name)
+	}
+	return diagnostics
+}
+
+// fromModel populates the builder with the declarations of the model and the files included into it.
+// Every enum is declared before the variables, the variables before the events and the events before the states.
+func fromModel(modelDecl *ModelDecl, builder *FsmBuilder) Diagnostics {
+	l := loader{
+		builder:     builder,
+		declared:    map[string]bool{},
+		parameters:  map[string]*EventDecl{},
+		diagnostics: Diagnostics{},
+	}
+	l.checker = typeChecker{
+		variables:   &builder.variables,
+		diagnostics: &l.diagnostics,
+	}
+	if len(modelDecl.Name) > 0 {
+		builder.Name(modelDecl.Name)
+	}
+	units := unitsOf(modelDecl.FileName, &modelDecl.Declarations)
+	for _, unit := range units {
+		l.inFile(unit.fileName)
+		for _, enumDecl := range unit.declarations.Enums {
+			l.handleEnumDeclaration(enumDecl)
+		}
+	}
+	for _, unit := range units {
+		l.inFile(unit.fileName)
+		for _, varDecl := range unit.declarations.Variables {
+			l.handleVariableDeclaration(varDecl)
+		}
+	}
+	for _, unit := range units {
+		l.inFile(unit.fileName)
+		for _, eventDecl := range unit.declarations.Events {
+			l.handleEventDeclaration(eventDecl)
+		}
+	}
+	var initialState *StateDecl
+	for _, unit := range units {
+		l.inFile(unit.fileName)
+		for _, stateDecl := range unit.declarations.States {
+			l.handleStateDeclaration(stateDecl)
+		}
+		candidates := unit.declarations.States
+		if initialState != nil {
+			candidates = append([]*StateDecl{initialState}, candidates...)
+		}
+		initialState = l.selectInitial(candidates)
+	}
+	if initialState != nil {
+		builder.Initial(initialState.Name)
+		plog.Debugf("setting initial state %s", initialState.Name)
+	}
+	choices := map[string]*ChoiceDecl{}
+	for _, unit := range units {
+		l.inFile(unit.fileName)
+		for _, choiceDecl := range unit.declarations.Choices {
+			if l.handleChoiceDeclaration(choiceDecl) {
+				choices[choiceDecl.Name] = choiceDecl
+			}
+		}
+	}
+	for _, unit := range units {
+		l.inFile(unit.fileName)
+		for _, choiceDecl := range unit.declarations.Choices {
+			if choices[choiceDecl.Name] == choiceDecl {
+				l.checkChoiceCycle(choiceDecl, choices)
+			}
+		}
+		l.checkRaises(unit.declarations, modelDecl)
+	}
+	for _, problem := range builder.checkEdges() {
+		l.diagnostics.Errorf(problem.origin.file, problem.origin.span, problem.code, "%s", problem.message)
+	}
+	return l.diagnostics
+}
+
+// checkRaises warns about raised events the model has no transition on
+func (l *loader) checkRaises(declarations *Declarations, modelDecl *ModelDecl) {
+	computations := append(stateComputations(declarations.States), choiceComputations(declarations.Choices)...)
+	for _, computation := range computations {
+		if computation.Send == nil || len(computation.Send.Model) > 0 {
+			continue
+		}
+		if !modelHandles(modelDecl, computation.Send.Event) {
+			l.diagnostics.Warnf(l.fileName, computation.Span, CODE_UNHANDLED_EVENT, "the model has no transition on the raised event %s", computation.Send.Event)
+		}
+	}
+}
+
+// inFile sets the file the following declarations are reported in
+func (l *loader) inFile(fileName string) {
+	l.fileName = fileName
+	l.checker.fileName = fileName
+}
+
+func (l *loader) handleEnumDeclaration(enumDecl *EnumDecl) {
+	variables := &l.builder.variables
+	if variables.GetEnum(enumDecl.Name).IsSome() {
+		l.diagnostics.Errorf(l.fileName, enumDecl.Span, CODE_DUPLICATE_ENUM, "enum %s is already declared", enumDecl.Name)
+		return
+	}
+	enum := &Enum{Name: enumDecl.Name}
+	for _, member := range enumDecl.Members {
+		if enum.Has(member.Name) {
+			l.diagnostics.Errorf(l.fileName, member.Span, CODE_DUPLICATE_ENUM, "member %s is declared twice in enum %s", member.Name, enum.Name)
+			continue
+		}
+		// members are constants in generated code, so they must be unique across enums
+		if other, isMember := variables.memberOf(member.Name); isMember {
+			l.diagnostics.Errorf(l.fileName, member.Span, CODE_DUPLICATE_ENUM, "member %s is already declared in enum %s", member.Name, other.Name)
+			continue
+		}
+		enum.Members = append(enum.Members, member.Name)
+	}
+	variables.DeclareEnum(enum)
+	plog.Debugf("Declared enum %s", enum.Name)
+}
+
+func (l *loader) handleVariableDeclaration(varDecl *VarDecl) {
+	variables := &l.builder.variables
+	if _, exists := variables.types[varDecl.Name]; exists {
+		l.diagnostics.Errorf(l.fileName, varDecl.Span, CODE_DUPLICATE_VARIABLE, "variable '%s' is already declared", varDecl.Name)
+		return
+	}
+	if _, isMember := variables.memberOf(varDecl.Name); isMember || variables.GetEnum(varDecl.Name).IsSome() {
+		l.diagnostics.Errorf(l.fileName, varDecl.Span, CODE_DUPLICATE_VARIABLE, "'%s' is already declared as an enum or enum member", varDecl.Name)
+		return
+	}
+	if varDecl.Type != nil {
+		if enum := variables.GetEnum(varDecl.Type.Name); enum.IsSome() {
+			l.handleEnumVariableDeclaration(varDecl, enum.Get())
+			return
+		}
+	}
+	constants := NewVariables()
+	value, err := constants.Evaluate(varDecl.Value)
+	if err != nil {
+		l.diagnostics.Errorf(l.fileName, varDecl.Value.GetSpan(), CODE_INVALID_VALUE, "bad variable declaration, the value of '%s' must be a constant", varDecl.Name)
+		return
+	}
+	valueType := NewLiteral(value).Type
+	if varDecl.Type != nil {
+		declaredType, known := ParseVariableType(varDecl.Type.Name)
+		if !known {
+			l.diagnostics.Errorf(l.fileName, varDecl.Type.Span, CODE_UNKNOWN_TYPE, "unknown type '%s'", varDecl.Type.Name)
+			return
+		}
+		converted, err := convert(value, declaredType)
+		if err != nil {
+			l.diagnostics.Errorf(l.fileName, varDecl.Value.GetSpan(), CODE_TYPE_MISMATCH, "cannot use %s '%s' as %s variable '%s'", valueType, varDecl.Value, declaredType, varDecl.Name)
+			return
+		}
+		value, valueType = converted, declaredType
+	} else if varDecl.Unquoted {
+		if enum, isMember := variables.memberOf(value.(string)); isMember {
+			l.handleEnumVariableDeclaration(varDecl, enum)
+			return
+		}
+		l.diagnostics.Warnf(l.fileName, varDecl.Value.GetSpan(), CODE_UNQUOTED_STRING, "value of '%s' is taken as a string, quote it or declare the type", varDecl.Name)
+	}
+	variables.Set(varDecl.Name, value)
+	variables.SetType(varDecl.Name, valueType)
+	plog.Debugf("Set %s %s", valueType, varDecl.Name)
+}
+
+// handleEnumVariableDeclaration declares var c: Color = RED, the value must name a member of the enum
+func (l *loader) handleEnumVariableDeclaration(varDecl *VarDecl, enum *Enum) {
+	var member string
+	switch value := varDecl.Value.(type) {
+	case *VarRef:
+		member = value.Name
+	case *Literal:
+		member, _ = value.Value.(string)
+	}
+	if !enum.Has(member) {
+		l.diagnostics.Errorf(l.fileName, varDecl.Value.GetSpan(), CODE_UNKNOWN_MEMBER, "'%s' is not a member of enum %s", varDecl.Value, enum.Name)
+		return
+	}
+	l.builder.variables.Set(varDecl.Name, member)
+	l.builder.variables.SetEnumType(varDecl.Name, enum.Name)
+	plog.Debugf("Set %s %s", enum.Name, varDecl.Name)
+}
+
+// handleEventDeclaration declares event PAYMENT(amount: float). Parameters are variables in generated code,
+// so a parameter shared by several events must have the same type in each.
+func (l *loader) handleEventDeclaration(eventDecl *EventDecl) {
+	variables := &l.builder.variables
+	if _, exists := l.builder.events[eventDecl.Name]; exists {
+		l.diagnostics.Errorf(l.fileName, eventDecl.Span, CODE_DUPLICATE_EVENT, "event %s is already declared", eventDecl.Name)
+		return
+	}
+	parameters := make([]Parameter, 0, len(eventDecl.Parameters))
+	for _, parameterDecl := range eventDecl.Parameters {
+		parameterType, known := ParseVariableType(parameterDecl.Type.Name)
+		if !known {
+			l.diagnostics.Errorf(l.fileName, parameterDecl.Type.Span, CODE_UNKNOWN_TYPE, "unknown type '%s', parameters are int, float, bool or string", parameterDecl.Type.Name)
+			continue
+		}
+		if _, exists := variables.types[parameterDecl.Name]; exists {
+			l.diagnostics.Errorf(l.fileName, parameterDecl.Span, CODE_DUPLICATE_VARIABLE, "parameter '%s' is already declared as a variable", parameterDecl.Name)
+			continue
+		}
+		if _, isMember := variables.memberOf(parameterDecl.Name); isMember || variables.GetEnum(parameterDecl.Name).IsSome() {
+			l.diagnostics.Errorf(l.fileName, parameterDecl.Span, CODE_DUPLICATE_VARIABLE, "parameter '%s' is already declared as an enum or enum member", parameterDecl.Name)
+			continue
+		}
+		if hasParameter(parameters, parameterDecl.Name) {
+			l.diagnostics.Errorf(l.fileName, parameterDecl.Span, CODE_DUPLICATE_VARIABLE, "parameter '%s' is declared twice", parameterDecl.Name)
+			continue
+		}
+		if other, declared := l.parameters[parameterDecl.Name]; declared {
+			for _, otherDecl := range other.Parameters {
+				if otherDecl.Name == parameterDecl.Name && otherDecl.Type.Name != parameterDecl.Type.Name {
+					l.diagnostics.Errorf(l.fileName, parameterDecl.Span, CODE_TYPE_MISMATCH, "parameter '%s' is declared as %s by event %s", parameterDecl.Name, otherDecl.Type.Name, other.Name)
+				}
+			}
+		}
+		l.parameters[parameterDecl.Name] = eventDecl
+		parameters = append(parameters, Parameter{Name: parameterDecl.Name, Type: parameterType})
+	}
+	l.builder.DeclareEvent(eventDecl.Name, parameters...)
+	plog.Debugf("Declared event %s", eventDecl.Name)
+}
+
+// selectInitial picks the state marked init, only the first counts when several are
+func (l *loader) selectInitial(stateDecls []*StateDecl) *StateDecl {
+	var initialState *StateDecl
+	for _, stateDecl := range stateDecls {
+		if !stateDecl.Initial {
+			continue
+		}
+		if initialState != nil {
+			l.diagnostics.Warnf(l.fileName, stateDecl.Span, CODE_MULTIPLE_INITIAL, "multiple initial states, state %s is ignored as state %s on line %d is already initial", stateDecl.Name, initialState.Name, initialState.Start.Line)
+			continue
+		}
+		initialState = stateDecl
+	}
+	return initialState
+}
+
+func (l *loader) handleStateDeclaration(stateDecl *StateDecl) {
+	l.builder.Given(stateDecl.Name, func(sb *StateBuilder) {
+		l.buildState(sb, stateDecl)
+	})
+}
+
+func (l *loader) buildState(sb *StateBuilder, stateDecl *StateDecl) {
+	if l.declared[stateDecl.Name] {
+		l.diagnostics.Errorf(l.fileName, stateDecl.Span, CODE_DUPLICATE_STATE, "state %s is already declared", stateDecl.Name)
+	}
+	l.declared[stateDecl.Name] = true
+	for _, substateDecl := range stateDecl.States {
+		sb.Given(substateDecl.Name, func(substate *StateBuilder) {
+			l.buildState(substate, substateDecl)
+		})
+	}
+	if stateDecl.Parallel {
+		sb.Parallel()
+	} else if len(stateDecl.States) > 0 {
+		if initialState := l.selectInitial(stateDecl.States); initialState != nil {
+			sb.Initial(initialState.Name)
+		} else {
+			l.diagnostics.Errorf(l.fileName, stateDecl.Span, CODE_MISSING_INITIAL, "no initial substate provided for state %s", stateDecl.Name)
+		}
+	}
+	if len(stateDecl.Entry) > 0 {
+		sb.OnEntry(l.buildComputations(stateDecl.Entry))
+	}
+	if len(stateDecl.Exit) > 0 {
+		sb.OnExit(l.buildComputations(stateDecl.Exit))
+	}
+	if len(stateDecl.AutoComputations) > 0 {
+		computations := l.buildComputations(stateDecl.AutoComputations)
+		computations.FuncSignature = "func(event string)"
+		sb.AutoRun(computations)
+	}
+	for _, autoEventDecl := range stateDecl.AutoEvents {
+		var autoRunEvent AutoEvent
+		conditions, wellTyped := l.buildConditions(autoEventDecl.Guard)
+		autoRunEvent.conditions = *conditions
+		autoRunEvent.disabled = !wellTyped
+		if autoEventDecl.Terminate {
+			autoRunEvent.terminate = mode.TERMINATE
+		} else {
+			autoRunEvent.compuatations = *l.buildComputations(autoEventDecl.Updates)
+			autoRunEvent.terminate = mode.CONTINUE
+			autoRunEvent.resultingState = autoEventDecl.Target
+		}
+		autoRunEvent.origin = origin{file: l.fileName, span: autoEventDecl.Span}
+		autoRunEvent.compuatations.FuncSignature = "func()"
+		sb.AutoRunEvent(autoRunEvent)
+	}
+	for _, transitionDecl := range stateDecl.Transitions {
+		checker := l.checker
+		if parameters := l.builder.events[transitionDecl.Event]; len(parameters) > 0 {
+			l.checker.variables = withParameters(&l.builder.variables, parameters)
+		}
+		sb.When(transitionDecl.Event, func(eb *EdgeBuilder) {
+			l.buildEdge(eb, transitionDecl)
+		})
+		l.checker = checker
+		if transitionDecl.Terminate {
+			plog.Debugf("%s on %s terminate ... done", stateDecl.Name, transitionDecl.Event)
+		} else {
+			plog.Debugf("%s on %s goto %s ... done", stateDecl.Name, transitionDecl.Event, transitionDecl.Target)
+		}
+	}
+	for _, timerDecl := range stateDecl.Timers {
+		buildEdge := func(eb *EdgeBuilder) {
+			l.buildEdge(eb, timerDecl)
+		}
+		if timerDecl.Repeat {
+			sb.Every(timerDecl.Delay, buildEdge)
+		} else {
+			sb.After(timerDecl.Delay, buildEdge)
+		}
+	}
+	if len(sb.transitions) == 0 && len(sb.autoEvents) == 0 && len(sb.timers) == 0 && len(sb.children) == 0 {
+		l.diagnostics.Warnf(l.fileName, stateDecl.Span, CODE_EMPTY_STATE, "no transitions or auto-events provided for state %s", stateDecl.Name)
+	}
+}
+
+// handleChoiceDeclaration declares a choice, reporting if it was declared
+func (l *loader) handleChoiceDeclaration(choiceDecl *ChoiceDecl) bool {
+	if l.declared[choiceDecl.Name] {
+		l.diagnostics.Errorf(l.fileName, choiceDecl.Span, CODE_DUPLICATE_STATE, "%s is already declared as a state or choice", choiceDecl.Name)
+		return false
+	}
+	l.declared[choiceDecl.Name] = true
+	l.builder.Choice(choiceDecl.Name, func(cb *ChoiceBuilder) {
+		for _, branchDecl := range choiceDecl.Branches {
+			cb.When(func(eb *EdgeBuilder) {
+				l.buildEdge(eb, branchDecl)
+			})
+		}
+		if choiceDecl.Else != nil {
+			cb.Else(func(eb *EdgeBuilder) {
+				l.buildEdge(eb, choiceDecl.Else)
+			})
+		}
+	})
+	return true
+}
+
+// checkChoiceCycle reports a choice whose branches lead back to it through other choices, it would never reach a state
+func (l *loader) checkChoiceCycle(choiceDecl *ChoiceDecl, choices map[string]*ChoiceDecl) {
+	visited := map[string]bool{}
+	pending := []*ChoiceDecl{choiceDecl}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		for _, branch := range append(append([]*TransitionDecl{}, current.Branches...), current.Else) {
+			if branch == nil || branch.Terminate {
+				continue
+			}
+			if branch.Target == choiceDecl.Name {
+				l.diagnostics.Errorf(l.fileName, choiceDecl.Span, CODE_CHOICE_CYCLE, "choice %s leads back to itself through %s", choiceDecl.Name, current.Name)
+				return
+			}
+			if next, isChoice := choices[branch.Target]; isChoice && !visited[next.Name] {
+				visited[next.Name] = true
+				pending = append(pending, next)
+			}
+		}
+	}
+}
+
+// buildEdge sets the target, guard and update of an event or timed transition
+func (l *loader) buildEdge(eb *EdgeBuilder, transitionDecl *TransitionDecl) {
+	if transitionDecl.Terminate {
+		eb.End()
+	} else {
+		eb.Then(transitionDecl.Target)
+	}
+	eb.declaredAt(l.fileName, transitionDecl.Span)
+	eb.MetaData(transitionDecl.Raw)
+	if len(transitionDecl.Guard) > 0 {
+		conditions, wellTyped := l.buildConditions(transitionDecl.Guard)
+		eb.And2(conditions)
+		eb.AndMeta(transitionDecl.RawGuard)
+		if !wellTyped {
+			// a guard that does not type check never holds, the edge is disabled rather than always enabled
+			eb.disable()
+		}
+	}
+	if len(transitionDecl.Updates) > 0 {
+		eb.Run2(l.buildComputations(transitionDecl.Updates))
+		eb.RunMeta(transitionDecl.RawUpdate)
+	}
+}
+
+func (l *loader) buildComputations(computationDecls []*ComputationDecl) *Computational {
+	computational := Computational{
+		Computations: make([]Computation, 0, len(computationDecls)),
+	}
+	for _, computationDecl := range computationDecls {
+		if computationDecl.Send != nil {
+			computational.Computations = append(computational.Computations, Computation{
+				Send: types.Some(Message{Model: computationDecl.Send.Model, Event: computationDecl.Send.Event}),
+			})
+			continue
+		}
+		valueType, ok := l.checker.checkComputation(computationDecl.Left, computationDecl.Operator, computationDecl.Right, computationDecl.Span)
+		computational.Computations = append(computational.Computations, Computation{
+			Left:       computationDecl.Left,
+			Operator:   computationDecl.Operator,
+			ValueType:  valueType,
+			Expression: computationDecl.Right,
+			// kept so that running it crashes the model, rather than leaving it out
+			invalid: !ok,
+		})
+	}
+	return &computational
+}
+
+// buildConditions returns the guard as written, reporting if every condition of it type checks
+func (l *loader) buildConditions(guard []Expr) (*Conditionals, bool) {
+	conditionals := Conditionals{
+		Conditions: make([]Condition, 0, len(guard)),
+	}
+	wellTyped := true
+	for _, expr := range guard {
+		if !l.checker.checkCondition(expr) {
+			wellTyped = false
+		}
+		conditionals.Conditions = append(conditionals.Conditions, Condition{
+			Expression: expr,
+		})
+	}
+	return &conditionals, wellTyped
+}
+
+func unquote(str string) string {
+	unquoted, err := strconv.Unquote(str)
+	if err != nil {
+		return str
+	}
+	return unquoted
+}
@@ -0,0 +1,178 @@
+package fsm
+
+import (
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/functions"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+// Hook is a point of a step that observers attach to, see FiniteStateMachine.Observe
+type Hook int
+
+const (
+	BEFORE_TRANSITION Hook = 0
+	AFTER_TRANSITION  Hook = 1
+	GUARD_EVALUATED   Hook = 2
+	VARIABLE_CHANGED  Hook = 3
+	DEADLOCKED        Hook = 4
+	CRASHED           Hook = 5
+	TERMINATED        Hook = 6
+)
+
+// Observation is what an observer is told. Source and Edge are the transition taken, or the last one taken in the step
+// when it deadlocked, crashed or terminated. A variable changed by an auto-computation has its state as Source and no Edge.
+// Before and After are copies of the variables, the same copy for a guard.
+// Holds is the outcome of an evaluated guard, Variable names a changed variable and Cause tells why the model stopped.
+type Observation struct {
+	Hook     Hook
+	Source   types.Option[*State]
+	Event    string
+	Edge     types.Option[*Edge]
+	Before   *Variables
+	After    *Variables
+	Holds    bool
+	Variable string
+	Cause    string
+}
+
+// registration is an observer registered with a hook, told apart by its address when it is unregistered
+type registration struct {
+	observer functions.Consumer[Observation]
+}
+
+// Observe registers an observer of the hook, the observers of a hook are told in the order they were registered.
+// Calling the returned function unregisters the observer.
+func (fsm *FiniteStateMachine) Observe(hook Hook, observer functions.Consumer[Observation]) func() {
+	registered := &registration{observer: observer}
+	fsm.observers[hook] = append(fsm.observers[hook], registered)
+	return func() {
+		kept := make([]*registration, 0, len(fsm.observers[hook]))
+		for _, other := range fsm.observers[hook] {
+			if other != registered {
+				kept = append(kept, other)
+			}
+		}
+		fsm.observers[hook] = kept
+	}
+}
+
+func (fsm *FiniteStateMachine) isObserved(hooks ...Hook) bool {
+	for _, hook := range hooks {
+		if len(fsm.observers[hook]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (fsm *FiniteStateMachine) notify(hook Hook, observation Observation) {
+	observation.Hook = hook
+	for _, registered := range fsm.observers[hook] {
+		registered.observer(observation)
+	}
+}
+
+// view copies the variables for the observers, so that later steps do not change what they were told
+func (fsm *FiniteStateMachine) view() *Variables {
+	view := fsm.variables.Copy()
+	return &view
+}
+
+// begin starts a step on the event, settle ends it
+func (fsm *FiniteStateMachine) begin(event string) {
+	fsm.step = Observation{Source: types.None[*State](), Event: event, Edge: types.None[*Edge]()}
+	if fsm.isObserved(DEADLOCKED, CRASHED, TERMINATED) {
+		fsm.step.Before = fsm.view()
+	}
+}
+
+// settle tells the observers if the step deadlocked, crashed or terminated, a model that stopped has its timers disarmed
+func (fsm *FiniteStateMachine) settle() {
+	if fsm.isStopped() {
+		fsm.disarmAll()
+	}
+	hooks := map[mode.Mode]Hook{mode.DEADLOCK: DEADLOCKED, mode.CRASH: CRASHED, mode.TERMINATE: TERMINATED}
+	hook, stopped := hooks[fsm.mode]
+	if !stopped || !fsm.isObserved(hook) {
+		return
+	}
+	observation := fsm.step
+	observation.After = fsm.view()
+	if fsm.mode != mode.TERMINATE {
+		observation.Cause = fsm.cause
+	}
+	fsm.notify(hook, observation)
+}
+
+// take takes the edge from the source on the event. The observers are told before and after it is taken,
+// and of every variable it changed. A terminating edge ends the step instead.
+func (fsm *FiniteStateMachine) take(source *State, event string, edge *Edge) (mode.Mode, error) {
+	fsm.step.Source = types.Some(source)
+	fsm.step.Event = event
+	fsm.step.Edge = types.Some(edge)
+	observed := fsm.isObserved(BEFORE_TRANSITION, AFTER_TRANSITION, VARIABLE_CHANGED)
+	var before *Variables
+	if observed {
+		before = fsm.view()
+		fsm.notify(BEFORE_TRANSITION, Observation{Source: fsm.step.Source, Event: event, Edge: fsm.step.Edge, Before: before, After: before})
+	}
+	if edge.terminate == mode.TERMINATE {
+		return mode.TERMINATE, nil
+	}
+	resultMode, err := fsm.takeEdge(source, edge)
+	if err != nil || resultMode == mode.TERMINATE || !observed {
+		return resultMode, err
+	}
+	transition := Observation{Source: fsm.step.Source, Event: event, Edge: fsm.step.Edge, Before: before, After: fsm.view()}
+	fsm.notify(AFTER_TRANSITION, transition)
+	fsm.changed(transition)
+	return resultMode, nil
+}
+
+// compute runs the auto-computation of the source, the observers are told of every variable it changed
+func (fsm *FiniteStateMachine) compute(source *State, event string) error {
+	if !fsm.isObserved(VARIABLE_CHANGED) {
+		return source.defaultComputations.Run(&fsm.variables, fsm.send)
+	}
+	before := fsm.view()
+	if err := source.defaultComputations.Run(&fsm.variables, fsm.send); err != nil {
+		return err
+	}
+	fsm.changed(Observation{Source: types.Some(source), Event: event, Edge: types.None[*Edge](), Before: before, After: fsm.view()})
+	return nil
+}
+
+// changed tells the observers of every variable that differs between Before and After of the observation
+func (fsm *FiniteStateMachine) changed(observation Observation) {
+	for _, name := range sortedKeys(observation.After.values) {
+		if previous, existed := observation.Before.values[name]; !existed || previous != observation.After.values[name] {
+			observation.Variable = name
+			fsm.notify(VARIABLE_CHANGED, observation)
+		}
+	}
+}
+
+// evaluated tells the observers the outcome of the guards of edges from the source, edges without a guard are left out.
+// The guards that failed are kept for the error of a step that deadlocks.
+func (fsm *FiniteStateMachine) evaluated(source *State, event string) func(edge *Edge, holds bool) {
+	return func(edge *Edge, holds bool) {
+		if !edge.isGuarded() {
+			return
+		}
+		if !holds {
+			fsm.failed = append(fsm.failed, FailedGuard{State: source.name, Guard: edge.GetGuard()})
+		}
+		if !fsm.isObserved(GUARD_EVALUATED) {
+			return
+		}
+		view := fsm.view()
+		fsm.notify(GUARD_EVALUATED, Observation{
+			Source: types.Some(source),
+			Event:  event,
+			Edge:   types.Some(edge),
+			Before: view,
+			After:  view,
+			Holds:  holds,
+		})
+	}
+}
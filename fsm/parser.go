@@ -2,353 +2,1045 @@ package fsm
 
 import (
 	"strconv"
-	"strings"
-
-	"github.com/Wafl97/go_aml/fsm/mode"
-	"github.com/Wafl97/go_aml/util/logger"
-	"github.com/Wafl97/go_aml/util/types"
+	"time"
 )
 
-var plog logger.Logger
-
-func FromString(str string) types.Option[FiniteStateMachine] {
-	plog = logger.New("PARSER")
-	plog.Info("Building model ...")
+type parser struct {
+	fileName    string
+	source      string
+	tokens      []Token
+	current     int
+	diagnostics Diagnostics
+}
 
-	lines := strings.Split(str, "\r\n")
+// ParseFile builds the syntax tree for the source. Syntax errors are reported as diagnostics
+// and the parser skips ahead to the next line, so the tree holds every valid declaration.
+//
+//	file         := { declaration }
+//	declaration  := "syntax" IDENT
+//	              | "model" name [ "{" { declaration } "}" ]
+//	              | ( "include" | "import" ) STRING
+//	              | "enum" IDENT "{" [ IDENT { "," IDENT } [ "," ] ] "}"
+//	              | "var" IDENT [ ":" IDENT ] "=" expression
+//	              | "event" name [ "(" [ IDENT ":" IDENT { "," IDENT ":" IDENT } ] ")" ]
+//	              | [ "init" ] ( "state" | "parallel" ) name "{" { stateItem } "}"
+//	              | "choice" name "{" { "(" conditions ")" target } "else" target "}"
+//	stateItem    := [ "init" ] ( "state" | "parallel" ) name "{" { stateItem } "}"
+//	              | ( "entry" | "exit" ) "{" { computation [ "," ] } "}"
+//	              | ">>" computations
+//	              | "|>" [ conditions ] target
+//	              | ( "after" | "every" ) DURATION [ "(" conditions ")" ] target
+//	              | event [ "(" conditions ")" ] target
+//	target       := "->" name [ "(" computations ")" ] | "-x"
+//	computations := computation { "," computation }
+//	computation  := IDENT ( "=" | "+=" | "-=" | "*=" | "/=" ) expression
+//	              | "send" name "." name
+//	              | "raise" name
+//	conditions   := expression { "," expression }
+//	expression   := and { "||" and }
+//	and          := comparison { "&&" comparison }
+//	comparison   := additive [ ( "==" | "!=" | ">" | ">=" | "<" | "<=" ) additive ]
+//	additive     := term { ( "+" | "-" ) term }
+//	term         := unary { ( "*" | "/" | "%" ) unary }
+//	unary        := ( "!" | "-" ) unary | primary
+//	primary      := INT | FLOAT | STRING | "true" | "false" | IDENT | "(" expression ")"
+func ParseFile(fileName, source string) (*File, Diagnostics) {
+	p := parser{
+		fileName:    fileName,
+		source:      source,
+		tokens:      Tokenize(source),
+		diagnostics: Diagnostics{},
+	}
+	file := p.parseFile()
+	file.FileName = fileName
+	return file, p.diagnostics
+}
 
-	builder := NewFsmBuilder()
-	for lineNumber := 0; lineNumber < len(lines); lineNumber++ {
-		line := strings.TrimSpace(lines[lineNumber])
-		// skip comment lines
-		if strings.HasPrefix(line, "//") {
-			continue
+func (p *parser) parseFile() *File {
+	file := &File{}
+	file.Start = p.peek().Start
+	for p.peek().Kind != TOKEN_EOF {
+		token := p.peek()
+		switch {
+		case token.Kind == TOKEN_RBRACE:
+			p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s, there is no block to close", token)
+			p.next()
+		case token.Kind != TOKEN_KEYWORD:
+			p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s, expected a declaration", token)
+			p.skipLine(token.Start.Line)
+		case token.Text == "syntax":
+			p.parseSyntax(file)
+		case token.Text == "model":
+			p.parseModel(file)
+		default:
+			p.parseDeclaration(&file.Declarations)
 		}
+		p.progress(token)
+	}
+	file.End = p.peek().End
+	return file
+}
 
-		// only attempt to find model name if none is alreay found
-		if len(builder.modelName) == 0 {
-			handleModelName(line, lineNumber, &builder)
+// parseDeclaration reads an enum, variable or state declaration of a model
+func (p *parser) parseDeclaration(declarations *Declarations) {
+	token := p.peek()
+	switch token.Text {
+	case "include", "import":
+		if includeDecl := p.parseInclude(); includeDecl != nil {
+			declarations.Includes = append(declarations.Includes, includeDecl)
 		}
-
-		// cast order: int -> float -> bool -> string
-		handleVariableDeclaration(line, lineNumber, &builder)
-
-		// set the new line number from iterating over the state definition
-		lineNumber = handleStateDef(line, lineNumber, &builder, &lines)
+	case "enum":
+		if enumDecl := p.parseEnum(); enumDecl != nil {
+			declarations.Enums = append(declarations.Enums, enumDecl)
+		}
+	case "var":
+		if varDecl := p.parseVar(); varDecl != nil {
+			declarations.Variables = append(declarations.Variables, varDecl)
+		}
+	case "event":
+		if eventDecl := p.parseEvent(); eventDecl != nil {
+			declarations.Events = append(declarations.Events, eventDecl)
+		}
+	case "init", "state", "parallel":
+		if stateDecl := p.parseState(); stateDecl != nil {
+			declarations.States = append(declarations.States, stateDecl)
+		}
+	case "choice":
+		if choiceDecl := p.parseChoice(); choiceDecl != nil {
+			declarations.Choices = append(declarations.Choices, choiceDecl)
+		}
+	default:
+		p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected keyword %s, expected a declaration", token)
+		p.skipLine(token.Start.Line)
 	}
+}
 
-	if builder.initialState.IsNone() {
-		plog.Error("No initial state provided")
-		return types.None[FiniteStateMachine]()
+func (p *parser) parseSyntax(file *File) {
+	keyword := p.next()
+	name := p.peek()
+	if name.Kind != TOKEN_IDENT {
+		p.errorf(name.Span(), CODE_MISSING_NAME, "no syntax given after 'syntax'")
+		p.skipLine(keyword.Start.Line)
+		return
+	}
+	p.next()
+	file.Syntax = &SyntaxDecl{
+		Span: Span{Start: keyword.Start, End: name.End},
+		Name: name.Text,
 	}
-	plog.Info("Building complete")
-	return types.Some(builder.Build())
 }
 
-func handleVariableDeclaration(line string, lineNumber int, builder *FsmBuilder) {
-	varDef, isVarDef := strings.CutPrefix(line, "var")
-	if !isVarDef {
+func (p *parser) parseModel(file *File) {
+	keyword := p.next()
+	name, ok := p.parseName()
+	if !ok {
+		p.errorf(keyword.Span(), CODE_MISSING_NAME, "no model name given")
+		p.skipLine(keyword.Start.Line)
 		return
 	}
-	varName, varValue, isValidVarDef := strings.Cut(varDef, "=")
-	if !isValidVarDef {
-		plog.Warnf("Bad variable declaration on line %d, invalid declaration ... skipping", lineNumber+1)
-		return
+	modelDecl := &ModelDecl{
+		Span:     Span{Start: keyword.Start, End: p.previous().End},
+		FileName: p.fileName,
+		Name:     name,
 	}
-	varName = strings.TrimSpace(varName)
-	varValue = strings.TrimSpace(varValue)
-	if len(varName) == 0 {
-		plog.Warnf("Bad variable declaration on line %d, missing name ... skipping", lineNumber+1)
+	if p.peek().Kind == TOKEN_LBRACE {
+		p.parseModelBlock(modelDecl)
+		for _, other := range file.GetModels() {
+			if other.Name == name && other.Span != modelDecl.Span {
+				p.errorf(modelDecl.Span, CODE_DUPLICATE_MODEL, "model %s is already declared on line %d", name, other.Start.Line)
+				return
+			}
+		}
+		file.Models = append(file.Models, modelDecl)
 		return
 	}
-	if len(varValue) == 0 {
-		plog.Warnf("Bad variable declaration on line %d, missing value ... skipping", lineNumber+1)
+	if file.Model != nil {
+		p.errorf(modelDecl.Span, CODE_DUPLICATE_MODEL, "model name already declared as '%s' on line %d", file.Model.Name, file.Model.Start.Line)
 		return
 	}
-	// try int first
-	intValue, ierr := strconv.ParseInt(varValue, 10, 32)
-	if ierr == nil {
-		builder.variables.Set(varName, intValue)
-		builder.variables.SetType(varName, INT)
-		plog.Debugf("Set Int")
-		return
+	file.Model = modelDecl
+}
+
+// parseModelBlock reads the declarations of a model declared as model MY_MODEL { ... }
+func (p *parser) parseModelBlock(modelDecl *ModelDecl) {
+	modelDecl.Block = true
+	p.next()
+	for {
+		token := p.peek()
+		switch {
+		case token.Kind == TOKEN_EOF:
+			p.errorf(Span{Start: modelDecl.Start, End: token.End}, CODE_UNCLOSED_BLOCK, "missing '}' for model %s declared on line %d", modelDecl.Name, modelDecl.Start.Line)
+			modelDecl.End = token.End
+			return
+		case token.Kind == TOKEN_RBRACE:
+			p.next()
+			modelDecl.End = token.End
+			return
+		case token.Kind != TOKEN_KEYWORD:
+			p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s in model %s, expected a declaration", token, modelDecl.Name)
+			p.skipLine(token.Start.Line)
+		default:
+			p.parseDeclaration(&modelDecl.Declarations)
+		}
+		p.progress(token)
 	}
-	// then float
-	floatValue, ferr := strconv.ParseFloat(varValue, 32)
-	if ferr == nil {
-		builder.variables.Set(varName, floatValue)
-		builder.variables.SetType(varName, FLOAT)
-		plog.Debugf("Set Float")
-		return
+}
+
+func (p *parser) parseInclude() *IncludeDecl {
+	keyword := p.next()
+	pathToken := p.peek()
+	if pathToken.Kind != TOKEN_STRING {
+		p.errorf(pathToken.Span(), CODE_MISSING_NAME, "no file given after '%s', expected a quoted path", keyword.Text)
+		p.skipLine(keyword.Start.Line)
+		return nil
 	}
-	// then bool
-	boolValue, berr := strconv.ParseBool(varValue)
-	if berr == nil {
-		builder.variables.Set(varName, boolValue)
-		builder.variables.SetType(varName, BOOL)
-		plog.Debugf("Set Bool")
-		return
+	p.next()
+	return &IncludeDecl{
+		Span:   Span{Start: keyword.Start, End: pathToken.End},
+		Path:   unquote(pathToken.Text),
+		Import: keyword.Text == "import",
 	}
-	// if all else fails just have a string
-	//varValue = strings.Trim(varValue, "\"")
-	builder.variables.Set(varName, varValue)
-	builder.variables.SetType(varName, STRING)
-	plog.Debugf("Set String")
 }
 
-func handleModelName(line string, lineNumber int, builder *FsmBuilder) {
-	modelName, containsModelName := strings.CutPrefix(line, "model ")
-	if containsModelName {
-		if len(modelName) == 0 {
-			plog.Warnf("No model name given on line %d", lineNumber+1)
-			return
+func (p *parser) parseEnum() *EnumDecl {
+	keyword := p.next()
+	nameToken := p.peek()
+	if nameToken.Kind != TOKEN_IDENT {
+		p.errorf(nameToken.Span(), CODE_MISSING_NAME, "bad enum declaration, missing name")
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	p.next()
+	enumDecl := &EnumDecl{Name: nameToken.Text}
+	enumDecl.Start = keyword.Start
+	if _, ok := p.expect(TOKEN_LBRACE); !ok {
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	for {
+		token := p.next()
+		switch token.Kind {
+		case TOKEN_EOF:
+			p.errorf(Span{Start: enumDecl.Start, End: token.End}, CODE_UNCLOSED_BLOCK, "missing '}' for enum %s declared on line %d", enumDecl.Name, enumDecl.Start.Line)
+			enumDecl.End = token.End
+			return enumDecl
+		case TOKEN_RBRACE:
+			enumDecl.End = token.End
+			return enumDecl
+		case TOKEN_IDENT:
+			enumDecl.Members = append(enumDecl.Members, &EnumMember{Span: token.Span(), Name: token.Text})
+			switch p.peek().Kind {
+			case TOKEN_COMMA:
+				p.next()
+				continue
+			case TOKEN_RBRACE:
+				continue
+			}
+			token = p.peek()
+		}
+		p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s in enum %s, expected a member", token, enumDecl.Name)
+		p.skipBlock()
+		enumDecl.End = p.previous().End
+		return enumDecl
+	}
+}
+
+func (p *parser) parseVar() *VarDecl {
+	keyword := p.next()
+	nameToken := p.peek()
+	if nameToken.Kind != TOKEN_IDENT {
+		p.errorf(nameToken.Span(), CODE_MISSING_NAME, "bad variable declaration, missing name")
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	p.next()
+	varDecl := &VarDecl{Name: nameToken.Text}
+	varDecl.Start = keyword.Start
+	if p.peek().Kind == TOKEN_COLON {
+		p.next()
+		typeToken := p.peek()
+		if typeToken.Kind != TOKEN_IDENT {
+			p.errorf(typeToken.Span(), CODE_MISSING_NAME, "bad variable declaration, missing type after ':'")
+			p.skipLine(keyword.Start.Line)
+			return nil
+		}
+		p.next()
+		varDecl.Type = &TypeRef{Span: typeToken.Span(), Name: typeToken.Text}
+	}
+	if _, ok := p.expect(TOKEN_ASSIGN); !ok {
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	if varDecl.Type != nil {
+		value, ok := p.parseExpression()
+		if !ok {
+			p.skipLine(keyword.Start.Line)
+			return nil
+		}
+		varDecl.Value = value
+	} else {
+		value, unquoted, ok := p.parseRestOfLine(nameToken.Start.Line)
+		if !ok {
+			return nil
 		}
-		builder.modelName = modelName
+		varDecl.Value = value
+		varDecl.Unquoted = unquoted
 	}
+	varDecl.End = varDecl.Value.GetSpan().End
+	return varDecl
 }
 
-func handleStateDef(line string, lineNumber int, builder *FsmBuilder, lines *[]string) int {
-	init, state, containsState := strings.Cut(line, "state ")
-	if !containsState {
-		return lineNumber
+func (p *parser) parseEvent() *EventDecl {
+	keyword := p.next()
+	name, ok := p.parseName()
+	if !ok {
+		p.errorf(keyword.Span(), CODE_MISSING_NAME, "bad event declaration, missing name")
+		p.skipLine(keyword.Start.Line)
+		return nil
 	}
-	state = strings.TrimSpace(strings.Trim(state, "{"))
-	if len(state) == 0 {
-		plog.Warnf("No name given to state on line %d ... skipping", lineNumber+1)
-		return lineNumber
+	eventDecl := &EventDecl{Name: name}
+	eventDecl.Start = keyword.Start
+	eventDecl.End = p.previous().End
+	if p.peek().Kind != TOKEN_LPAREN {
+		return eventDecl
+	}
+	if _, ok := p.expect(TOKEN_LPAREN); !ok {
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	for p.peek().Kind != TOKEN_RPAREN {
+		nameToken, ok := p.expect(TOKEN_IDENT)
+		if !ok {
+			p.skipLine(keyword.Start.Line)
+			return nil
+		}
+		if _, ok := p.expect(TOKEN_COLON); !ok {
+			p.skipLine(keyword.Start.Line)
+			return nil
+		}
+		typeToken, ok := p.expect(TOKEN_IDENT)
+		if !ok {
+			p.skipLine(keyword.Start.Line)
+			return nil
+		}
+		eventDecl.Parameters = append(eventDecl.Parameters, &ParameterDecl{
+			Span: Span{Start: nameToken.Start, End: typeToken.End},
+			Name: nameToken.Text,
+			Type: &TypeRef{Span: typeToken.Span(), Name: typeToken.Text},
+		})
+		if p.peek().Kind != TOKEN_COMMA {
+			break
+		}
+		p.next()
 	}
-	iterated := 0
-	builder.Given(state, func(sb *StateBuilder) {
-		for iterated = lineNumber + 1; iterated < len(*lines); iterated++ {
-			line = (*lines)[iterated]
-			if line == "}" { // end of state block
-				break
+	closing, ok := p.expect(TOKEN_RPAREN)
+	if !ok {
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	eventDecl.End = closing.End
+	return eventDecl
+}
+
+// parseRestOfLine reads the value of an untyped variable, which runs to the end of the line.
+// A single literal is kept as is, anything else is taken as an unquoted string (var s = some string).
+func (p *parser) parseRestOfLine(line int) (Expr, bool, bool) {
+	first := p.current
+	for p.peek().Kind != TOKEN_EOF && p.peek().Start.Line == line {
+		p.next()
+	}
+	end := p.current
+	tokens := p.tokens[first:end]
+	if len(tokens) == 0 {
+		p.errorf(p.previous().Span(), CODE_MISSING_VALUE, "bad variable declaration, missing value")
+		return nil, false, false
+	}
+	if (len(tokens) == 1 && isValueToken(tokens[0].Kind)) ||
+		(len(tokens) == 2 && tokens[0].Kind == TOKEN_MINUS && isNumberToken(tokens[1].Kind)) {
+		p.current = first
+		value, ok := p.parseUnary()
+		if !ok {
+			p.current = end
+			return nil, false, false
+		}
+		if literal, isLiteral := value.(*Literal); isLiteral {
+			return literal, false, true
+		}
+		p.current = end
+	}
+	span := Span{Start: tokens[0].Start, End: tokens[len(tokens)-1].End}
+	raw := p.source[span.Start.Offset:span.End.Offset]
+	return &Literal{Span: span, Value: raw, Type: STRING}, true, true
+}
+
+func (p *parser) parseState() *StateDecl {
+	stateDecl := &StateDecl{}
+	stateDecl.Start = p.peek().Start
+	if p.peek().Text == "init" {
+		p.next()
+		stateDecl.Initial = true
+		if text := p.peek().Text; text != "state" && text != "parallel" {
+			p.errorf(p.peek().Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s, expected 'state' or 'parallel' after 'init'", p.peek())
+			p.skipLine(stateDecl.Start.Line)
+			return nil
+		}
+	}
+	keyword := p.next()
+	stateDecl.Parallel = keyword.Text == "parallel"
+	name, ok := p.parseName()
+	if !ok {
+		p.errorf(keyword.Span(), CODE_MISSING_NAME, "no name given to state")
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	stateDecl.Name = name
+	if _, ok := p.expect(TOKEN_LBRACE); !ok {
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	for {
+		token := p.peek()
+		switch token.Kind {
+		case TOKEN_EOF:
+			p.errorf(Span{Start: stateDecl.Start, End: token.End}, CODE_UNCLOSED_BLOCK, "missing '}' for state %s declared on line %d", name, stateDecl.Start.Line)
+			stateDecl.End = token.End
+			return stateDecl
+		case TOKEN_RBRACE:
+			p.next()
+			stateDecl.End = token.End
+			return stateDecl
+		}
+		if !p.parseStateItem(stateDecl) {
+			p.skipLine(token.Start.Line)
+		}
+		p.progress(token)
+	}
+}
+
+func (p *parser) parseStateItem(stateDecl *StateDecl) bool {
+	token := p.peek()
+	switch token.Kind {
+	case TOKEN_AUTO_RUN:
+		p.next()
+		computations, ok := parseOptionallyWrapped(p, p.parseComputations)
+		if !ok {
+			return false
+		}
+		stateDecl.AutoComputations = append(stateDecl.AutoComputations, computations...)
+		return true
+	case TOKEN_AUTO_EVENT:
+		p.next()
+		transition := &TransitionDecl{}
+		transition.Start = token.Start
+		if kind := p.peek().Kind; kind != TOKEN_ARROW && kind != TOKEN_TERMINATE {
+			guardStart := p.peek().Start
+			conditions, ok := p.parseConditions()
+			if !ok {
+				return false
 			}
-			line = strings.TrimSpace(line)
-			if len(line) == 0 {
-				continue
+			transition.Guard = conditions
+			transition.RawGuard = p.source[guardStart.Offset:p.previous().End.Offset]
+		}
+		if !p.parseTarget(transition) {
+			return false
+		}
+		stateDecl.AutoEvents = append(stateDecl.AutoEvents, transition)
+		return true
+	case TOKEN_IDENT, TOKEN_STRING:
+		p.next()
+		transition := &TransitionDecl{Event: nameOf(token)}
+		transition.Start = token.Start
+		if p.peek().Kind == TOKEN_LPAREN {
+			p.next()
+			guardStart := p.peek().Start
+			conditions, ok := p.parseConditions()
+			if !ok {
+				return false
 			}
-			if checkLineIsAutoRunTermination(line, lineNumber, sb, builder) {
-				continue
+			transition.Guard = conditions
+			transition.RawGuard = p.source[guardStart.Offset:p.previous().End.Offset]
+			if _, ok := p.expect(TOKEN_RPAREN); !ok {
+				return false
 			}
-			if checkLineIsAutoComputation(line, lineNumber, sb, builder) {
-				continue
+		}
+		if !p.parseTarget(transition) {
+			return false
+		}
+		stateDecl.Transitions = append(stateDecl.Transitions, transition)
+		return true
+	case TOKEN_KEYWORD:
+		switch token.Text {
+		case "init", "state", "parallel":
+			if substate := p.parseState(); substate != nil {
+				stateDecl.States = append(stateDecl.States, substate)
 			}
-			if checkLineIsAutoRunEvent(line, lineNumber, sb, builder) {
-				continue
+			return true
+		case "choice":
+			p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "choices are declared at the top level, not in state %s", stateDecl.Name)
+			return false
+		case "after", "every":
+			transition, ok := p.parseTimer()
+			if !ok {
+				return false
+			}
+			stateDecl.Timers = append(stateDecl.Timers, transition)
+			return true
+		case "entry", "exit":
+			p.next()
+			computations, ok := p.parseActions()
+			if !ok {
+				return false
+			}
+			if token.Text == "entry" {
+				stateDecl.Entry = append(stateDecl.Entry, computations...)
+			} else {
+				stateDecl.Exit = append(stateDecl.Exit, computations...)
+			}
+			return true
+		}
+	}
+	p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s in state %s, expected a transition", token, stateDecl.Name)
+	return false
+}
+
+// parseChoice reads choice CHECK { (guard) -> STATE (update) ... else -> STATE }, the else branch is mandatory and comes last
+func (p *parser) parseChoice() *ChoiceDecl {
+	keyword := p.next()
+	name, ok := p.parseName()
+	if !ok {
+		p.errorf(keyword.Span(), CODE_MISSING_NAME, "no name given to choice")
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	choiceDecl := &ChoiceDecl{Name: name}
+	choiceDecl.Start = keyword.Start
+	if _, ok := p.expect(TOKEN_LBRACE); !ok {
+		p.skipLine(keyword.Start.Line)
+		return nil
+	}
+	for {
+		token := p.peek()
+		switch {
+		case token.Kind == TOKEN_EOF:
+			p.errorf(Span{Start: choiceDecl.Start, End: token.End}, CODE_UNCLOSED_BLOCK, "missing '}' for choice %s declared on line %d", name, choiceDecl.Start.Line)
+			choiceDecl.End = token.End
+			return choiceDecl
+		case token.Kind == TOKEN_RBRACE:
+			p.next()
+			choiceDecl.End = token.End
+			if choiceDecl.Else == nil {
+				p.errorf(choiceDecl.Span, CODE_MISSING_ELSE, "choice %s has no else branch, it is taken when no guard holds", name)
 			}
-			if checkLineIsTermination(line, iterated, sb, state, builder) {
+			return choiceDecl
+		case choiceDecl.Else != nil:
+			p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s, else is the last branch of choice %s", token, name)
+			p.skipLine(token.Start.Line)
+		case token.Kind == TOKEN_KEYWORD && token.Text == "else":
+			p.next()
+			branch := &TransitionDecl{}
+			branch.Start = token.Start
+			if !p.parseTarget(branch) {
+				p.skipLine(token.Start.Line)
 				continue
 			}
-			if checkLineIsTransition(line, iterated, sb, state, builder) {
+			choiceDecl.Else = branch
+		case token.Kind == TOKEN_LPAREN:
+			p.next()
+			branch := &TransitionDecl{}
+			branch.Start = token.Start
+			guardStart := p.peek().Start
+			conditions, ok := p.parseConditions()
+			if ok {
+				branch.Guard = conditions
+				branch.RawGuard = p.source[guardStart.Offset:p.previous().End.Offset]
+				_, ok = p.expect(TOKEN_RPAREN)
+			}
+			if !ok || !p.parseTarget(branch) {
+				p.skipLine(token.Start.Line)
 				continue
 			}
-			plog.Warnf("Bad transition on line %d, invalid declaration ... skipping", iterated+1)
+			choiceDecl.Branches = append(choiceDecl.Branches, branch)
+		default:
+			p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s in choice %s, expected a guarded branch or else", token, name)
+			p.skipLine(token.Start.Line)
 		}
-		if len(sb.transitions) == 0 && len(sb.autoEvents) == 0 {
-			plog.Warnf("No valid transitions or auto-events provided for state %s on line %d", state, lineNumber+1)
+		p.progress(token)
+	}
+}
+
+// parseTimer reads after 500ms (guard) -> STATE (update), every repeats the timer while the state stays active
+func (p *parser) parseTimer() (*TransitionDecl, bool) {
+	keyword := p.next()
+	transition := &TransitionDecl{Repeat: keyword.Text == "every"}
+	transition.Start = keyword.Start
+	token := p.next()
+	if token.Kind != TOKEN_DURATION && token.Kind != TOKEN_INT {
+		p.errorf(token.Span(), CODE_INVALID_DURATION, "bad %s, expected a duration such as 500ms or 1s but got %s", keyword.Text, token)
+		return nil, false
+	}
+	delay, err := time.ParseDuration(token.Text)
+	if err != nil || delay <= 0 {
+		p.errorf(token.Span(), CODE_INVALID_DURATION, "bad %s, %s is not a positive duration, the units are ns, us, ms, s, m and h", keyword.Text, token.Text)
+		return nil, false
+	}
+	transition.Delay = delay
+	if p.peek().Kind == TOKEN_LPAREN {
+		p.next()
+		guardStart := p.peek().Start
+		conditions, ok := p.parseConditions()
+		if !ok {
+			return nil, false
+		}
+		transition.Guard = conditions
+		transition.RawGuard = p.source[guardStart.Offset:p.previous().End.Offset]
+		if _, ok := p.expect(TOKEN_RPAREN); !ok {
+			return nil, false
 		}
-	})
-	if init == "init " {
-		builder.Initial(state)
-		plog.Debugf("setting initial state %s", state)
 	}
-	return iterated
+	return transition, p.parseTarget(transition)
 }
 
-func checkLineIsAutoComputation(line string, lineNumber int, sb *StateBuilder, builder *FsmBuilder) bool {
-	autoComputation, isAutoCompuation := strings.CutPrefix(line, ">>")
-	if !isAutoCompuation {
+func (p *parser) parseTarget(transition *TransitionDecl) bool {
+	defer func() {
+		transition.End = p.previous().End
+		transition.Raw = p.source[transition.Start.Offset:transition.End.Offset]
+	}()
+	token := p.next()
+	switch token.Kind {
+	case TOKEN_TERMINATE:
+		transition.Terminate = true
+		return true
+	case TOKEN_ARROW:
+		target, ok := p.parseName()
+		if !ok {
+			p.errorf(token.Span(), CODE_MISSING_TARGET, "bad transition, no destination state provided")
+			return false
+		}
+		transition.Target = target
+		// the update starts on the line of the target, a '(' on the next line begins the next guarded branch
+		if p.peek().Kind != TOKEN_LPAREN || p.peek().Start.Line != p.previous().End.Line {
+			return true
+		}
+		p.next()
+		updateStart := p.peek().Start
+		computations, ok := p.parseComputations()
+		if !ok {
+			return false
+		}
+		transition.Updates = computations
+		transition.RawUpdate = p.source[updateStart.Offset:p.previous().End.Offset]
+		_, ok = p.expect(TOKEN_RPAREN)
+		return ok
+	default:
+		p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s, expected '->' or '-x'", token)
 		return false
 	}
-	compuations := parseComputation(autoComputation, lineNumber, builder)
-	compuations.FuncSignature = "func(event string)"
-	sb.AutoRun(compuations)
-	return true
 }
 
-func checkLineIsAutoRunTermination(line string, lineNumber int, sb *StateBuilder, builder *FsmBuilder) bool {
-	autoEvent, isAutoEvent := strings.CutPrefix(line, "|>")
-	if !isAutoEvent {
-		return false
+// parseActions reads the block of an entry or exit action, the computations are separated by commas or new lines
+func (p *parser) parseActions() ([]*ComputationDecl, bool) {
+	if _, ok := p.expect(TOKEN_LBRACE); !ok {
+		return nil, false
 	}
-	autoEvent, isTermination := strings.CutSuffix(autoEvent, "-x")
-	if !isTermination {
-		return false
+	computations := []*ComputationDecl{}
+	for p.peek().Kind != TOKEN_RBRACE {
+		computation, ok := p.parseComputation()
+		if !ok {
+			return nil, false
+		}
+		computations = append(computations, computation)
+		if p.peek().Kind == TOKEN_COMMA {
+			p.next()
+		}
 	}
-	var autoRunEvent AutoEvent
-	autoRunEvent.conditions = *parseCondition(autoEvent, lineNumber, builder)
-	autoRunEvent.terminate = mode.TERMINATE
-	autoRunEvent.compuatations.FuncSignature = "func()"
-	sb.AutoRunEvent(autoRunEvent)
-	return true
+	p.next()
+	return computations, true
+}
 
+// parseOptionallyWrapped parses a list that may or may not be wrapped in parentheses
+func parseOptionallyWrapped[T any](p *parser, parse func() ([]T, bool)) ([]T, bool) {
+	if p.peek().Kind != TOKEN_LPAREN {
+		return parse()
+	}
+	p.next()
+	list, ok := parse()
+	if !ok {
+		return nil, false
+	}
+	_, ok = p.expect(TOKEN_RPAREN)
+	return list, ok
 }
 
-func checkLineIsAutoRunEvent(line string, lineNumber int, sb *StateBuilder, builder *FsmBuilder) bool {
-	autoEvent, isAutoEvent := strings.CutPrefix(line, "|>")
-	if !isAutoEvent {
-		return false
+// parseConditions reads a guard, comma separated expressions must all hold
+func (p *parser) parseConditions() ([]Expr, bool) {
+	conditions := []Expr{}
+	for {
+		condition, ok := p.parseExpression()
+		if !ok {
+			return nil, false
+		}
+		conditions = append(conditions, condition)
+		if p.peek().Kind != TOKEN_COMMA {
+			return conditions, true
+		}
+		p.next()
 	}
-	autoEvent, nextState, isValid := strings.Cut(autoEvent, "->")
-	if !isValid {
-		return false
+}
+
+// ParseExpression parses a single expression such as a guard
+func ParseExpression(source string) (Expr, Diagnostics) {
+	p := parser{
+		source:      source,
+		tokens:      Tokenize(source),
+		diagnostics: Diagnostics{},
 	}
-	nextState, computationString, hasComputation := strings.Cut(nextState, "(")
+	expr, ok := p.parseExpression()
+	if ok && p.peek().Kind != TOKEN_EOF {
+		p.errorf(p.peek().Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s after expression", p.peek())
+	}
+	return expr, p.diagnostics
+}
 
-	nextState = strings.TrimSpace(nextState)
-	if len(nextState) == 0 {
-		plog.Warnf("Bad transition on line %d, no destination state provided ... skipping", lineNumber+1)
-		return true
+var comparisonSymbols = map[TokenKind]LogicSymbol{
+	TOKEN_EQ: EQUAL,
+	TOKEN_NE: NOT_EQUAL,
+	TOKEN_GT: GRATER_THAN,
+	TOKEN_GE: GRATER_THAN_OR_EQUAL,
+	TOKEN_LT: LESS_THAN,
+	TOKEN_LE: LESS_THAN_OR_EQUAL,
+}
+
+var arithmeticSymbols = map[TokenKind]ArithmeticSymbol{
+	TOKEN_PLUS:    ADD,
+	TOKEN_MINUS:   SUBTRACT,
+	TOKEN_STAR:    MULTIPLY,
+	TOKEN_SLASH:   DIVIDE,
+	TOKEN_PERCENT: MODULO,
+}
+
+func (p *parser) parseExpression() (Expr, bool) {
+	return p.parseLogic(OR, p.parseAnd)
+}
+
+func (p *parser) parseAnd() (Expr, bool) {
+	return p.parseLogic(AND, p.parseComparison)
+}
+
+func (p *parser) parseLogic(symbol LogicSymbol, parseOperand func() (Expr, bool)) (Expr, bool) {
+	kind := TOKEN_OR
+	if symbol == AND {
+		kind = TOKEN_AND
 	}
-	var autoRunEvent AutoEvent
-	if hasComputation {
-		autoRunEvent.compuatations = *parseComputation(strings.Trim(strings.TrimSpace(computationString), ")"), lineNumber, builder)
+	left, ok := parseOperand()
+	for ok && p.peek().Kind == kind {
+		p.next()
+		var right Expr
+		right, ok = parseOperand()
+		if ok {
+			left = &LogicExpr{Span: spanOf(left, right), Symbol: symbol, Left: left, Right: right}
+		}
 	}
-	autoRunEvent.conditions = *parseCondition(autoEvent, lineNumber, builder)
-	autoRunEvent.terminate = mode.CONTINUE
-	autoRunEvent.resultingState = nextState
-	autoRunEvent.compuatations.FuncSignature = "func()"
-	sb.AutoRunEvent(autoRunEvent)
-	return true
+	return left, ok
 }
 
-func checkLineIsTermination(line string, lineNumber int, sb *StateBuilder, state string, builder *FsmBuilder) bool {
-	event, isTermination := strings.CutSuffix(line, "-x")
-	if !isTermination {
-		return false
+func (p *parser) parseComparison() (Expr, bool) {
+	left, ok := p.parseArithmetic(precedenceAdditive)
+	if !ok {
+		return nil, false
 	}
-	event, conditionsString, isConditional := strings.Cut(event, "(")
-	event = cleanEventString(event)
-	if len(event) == 0 {
-		plog.Warnf("Bad transition on line %d, no event provided ... skipping", lineNumber+1)
-		return true
+	symbol, isComparison := comparisonSymbols[p.peek().Kind]
+	if !isComparison {
+		return left, true
 	}
-	sb.When(event, func(eb *EdgeBuilder) {
-		eb.End().MetaData(line)
-		if isConditional {
-			eb.And2(parseCondition(strings.Trim(strings.TrimSpace(conditionsString), ")"), lineNumber, builder))
-			eb.AndMeta(conditionsString)
-		}
-	})
-	plog.Debugf("%s on %s terminate ... done", state, event)
-	return true
+	p.next()
+	right, ok := p.parseArithmetic(precedenceAdditive)
+	if !ok {
+		return nil, false
+	}
+	return &LogicExpr{Span: spanOf(left, right), Symbol: symbol, Left: left, Right: right}, true
 }
 
-func checkLineIsTransition(line string, lineNumber int, sb *StateBuilder, state string, builder *FsmBuilder) bool {
-	event, nextState, isTransition := strings.Cut(line, "->")
-	if !isTransition {
-		return false
+// parseArithmetic parses the left associative +, - (additive) and *, /, % (multiplicative) levels
+func (p *parser) parseArithmetic(precedence int) (Expr, bool) {
+	parseOperand := p.parseUnary
+	if precedence == precedenceAdditive {
+		parseOperand = func() (Expr, bool) { return p.parseArithmetic(precedenceMultiplicative) }
 	}
-	event, conditionsString, isConditional := strings.Cut(event, "(")
-	nextState, computationString, hasComputation := strings.Cut(nextState, "(")
-	event = cleanEventString(event)
-	nextState = strings.TrimSpace(nextState)
-	if len(event) == 0 {
-		plog.Warnf("Bad transition on line %d, no event provided ... skipping", lineNumber+1)
-		return true
+	left, ok := parseOperand()
+	for ok {
+		symbol, isArithmetic := arithmeticSymbols[p.peek().Kind]
+		if !isArithmetic || symbol.precedence() != precedence {
+			break
+		}
+		p.next()
+		var right Expr
+		right, ok = parseOperand()
+		if ok {
+			left = &ArithmeticExpr{Span: spanOf(left, right), Symbol: symbol, Left: left, Right: right}
+		}
 	}
-	if len(nextState) == 0 {
-		plog.Warnf("Bad transition on line %d, no destination state provided ... skipping", lineNumber+1)
-		return true
+	return left, ok
+}
+
+func (p *parser) parseUnary() (Expr, bool) {
+	token := p.peek()
+	switch token.Kind {
+	case TOKEN_NOT:
+		p.next()
+		operand, ok := p.parseUnary()
+		if !ok {
+			return nil, false
+		}
+		return &NotExpr{Span: Span{Start: token.Start, End: operand.GetSpan().End}, Operand: operand}, true
+	case TOKEN_MINUS:
+		p.next()
+		operand, ok := p.parseUnary()
+		if !ok {
+			return nil, false
+		}
+		span := Span{Start: token.Start, End: operand.GetSpan().End}
+		// fold negative number literals
+		if literal, isLiteral := operand.(*Literal); isLiteral {
+			switch value := literal.Value.(type) {
+			case int64:
+				return &Literal{Span: span, Value: -value, Type: INT}, true
+			case float64:
+				return &Literal{Span: span, Value: -value, Type: FLOAT}, true
+			}
+		}
+		return &NegateExpr{Span: span, Operand: operand}, true
+	default:
+		return p.parsePrimary()
 	}
-	sb.When(event, func(eb *EdgeBuilder) {
-		eb.Then(nextState).MetaData(line)
-		if isConditional {
-			eb.And2(parseCondition(strings.Trim(strings.TrimSpace(conditionsString), ")"), lineNumber, builder))
-			eb.AndMeta(conditionsString)
-		}
-		if hasComputation {
-			eb.Run2(parseComputation(strings.Trim(strings.TrimSpace(computationString), ")"), lineNumber, builder))
-			eb.RunMeta(computationString)
-		}
-	})
-	plog.Debugf("%s on %s goto %s ... done", state, event, nextState)
-	return true
-}
-
-func parseComputation(computationString string, lineNumber int, builder *FsmBuilder) *Computational {
-	subComputations := strings.Split(computationString, ",")
-	computational := Computational{
-		Computations: make([]Computation, 0, len(subComputations)),
-	}
-	for _, subComputation := range subComputations {
-		subComputation = strings.TrimSpace(subComputation)
-		var computation Computation
-		tokens := strings.SplitN(subComputation, " ", 3)
-		if len(tokens) != 3 {
-			plog.Warnf("Bad computation for transition on line %d, cannot infer computation (%s) ... skipping", lineNumber+1, subComputation)
-			continue
-		}
-		computation.Left = tokens[0]
-		if _, isDeclared := builder.variables.values[computation.Left]; !isDeclared {
-			plog.Warnf("Bad computation for transition on line %d, variable '%s' is not declared ... skipping", lineNumber+1, computation.Left)
-			continue
-		}
-		computation.ValueType = builder.variables.types[computation.Left]
-		switch tokens[1] {
-		case "=":
-			computation.Operator = ASSIGN
-		case "+=":
-			computation.Operator = ADD_ASSIGN
-		case "-=":
-			computation.Operator = SUB_ASSIGN
-		case "*=":
-			computation.Operator = MUL_ASSIGN
-		case "/=":
-			computation.Operator = DIV_ASSIGN
-		default:
-			plog.Warnf("Bad computation in transition on line %d, invalid symbol (%s) ... skipping", lineNumber+1, tokens[1])
-			continue
-		}
-		computation.Right = tokens[2]
-		computational.Computations = append(computational.Computations, computation)
-	}
-	return &computational
-}
-
-func parseCondition(conditionString string, lineNumber int, builder *FsmBuilder) *Conditionals {
-	subConditions := strings.Split(conditionString, ",")
-	conditionals := Conditionals{
-		Conditions: make([]Condition, 0, len(subConditions)),
-	}
-	for _, subCondition := range subConditions {
-		subCondition = strings.TrimSpace(subCondition)
-		var condition Condition
-		tokens := strings.SplitN(subCondition, " ", 3)
-		if len(tokens) != 3 {
-			plog.Warnf("Bad condition for transition on line %d, cannot infer condition (%s) ... skipping", lineNumber+1, subCondition)
-			continue
-		}
-		condition.Left = tokens[0]
-		if _, isDeclared := builder.variables.values[condition.Left]; !isDeclared {
-			plog.Warnf("Bad condition for transition on line %d, variable '%s' is not declared ... skipping", lineNumber+1, condition.Left)
-			continue
-		}
-		condition.Right = tokens[2]
-		condition.ValueType = builder.variables.types[condition.Left]
-		switch tokens[1] {
-		case "==":
-			condition.Symbol = EQUAL
-		case "!=":
-			condition.Symbol = NOT_EQUAL
-		case ">=":
-			condition.Symbol = GRATER_THAN_OR_EQUAL
-		case ">":
-			condition.Symbol = GRATER_THAN
-		case "<=":
-			condition.Symbol = LESS_THAN_OR_EQUAL
-		case "<":
-			condition.Symbol = LESS_THAN
+}
+
+func (p *parser) parsePrimary() (Expr, bool) {
+	token := p.next()
+	span := token.Span()
+	switch token.Kind {
+	case TOKEN_INT:
+		value, err := strconv.ParseInt(token.Text, 10, 64)
+		if err != nil {
+			p.errorf(span, CODE_INVALID_VALUE, "invalid int %s, %s", token, err.Error())
+			return nil, false
+		}
+		return &Literal{Span: span, Value: value, Type: INT}, true
+	case TOKEN_FLOAT:
+		value, err := strconv.ParseFloat(token.Text, 64)
+		if err != nil {
+			p.errorf(span, CODE_INVALID_VALUE, "invalid float %s, %s", token, err.Error())
+			return nil, false
+		}
+		return &Literal{Span: span, Value: value, Type: FLOAT}, true
+	case TOKEN_STRING:
+		return &Literal{Span: span, Value: unquote(token.Text), Type: STRING}, true
+	case TOKEN_IDENT:
+		switch token.Text {
+		case "true", "false":
+			return &Literal{Span: span, Value: token.Text == "true", Type: BOOL}, true
 		default:
-			plog.Warnf("Bad condition in transition on line %d, invalid symbol (%s) ... skipping", lineNumber+1, tokens[1])
-			continue
+			return &VarRef{Span: span, Name: token.Text}, true
+		}
+	case TOKEN_LPAREN:
+		expr, ok := p.parseExpression()
+		if !ok {
+			return nil, false
+		}
+		if _, ok := p.expect(TOKEN_RPAREN); !ok {
+			return nil, false
+		}
+		return expr, true
+	default:
+		p.errorf(span, CODE_UNEXPECTED_TOKEN, "unexpected %s, expected an expression", token)
+		return nil, false
+	}
+}
+
+func spanOf(first Node, last Node) Span {
+	return Span{Start: first.GetSpan().Start, End: last.GetSpan().End}
+}
+
+func (p *parser) parseComputations() ([]*ComputationDecl, bool) {
+	computations := []*ComputationDecl{}
+	for {
+		computation, ok := p.parseComputation()
+		if !ok {
+			return nil, false
+		}
+		computations = append(computations, computation)
+		if p.peek().Kind != TOKEN_COMMA {
+			return computations, true
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseComputation() (*ComputationDecl, bool) {
+	if p.peek().Text == "send" && p.peek().Kind == TOKEN_KEYWORD {
+		return p.parseSend()
+	}
+	if p.peek().Text == "raise" && p.peek().Kind == TOKEN_KEYWORD {
+		return p.parseRaise()
+	}
+	left, ok := p.expect(TOKEN_IDENT)
+	if !ok {
+		return nil, false
+	}
+	operator := p.next()
+	var symbol ArithmeticSymbol
+	switch operator.Kind {
+	case TOKEN_ASSIGN:
+		symbol = ASSIGN
+	case TOKEN_ADD_ASSIGN:
+		symbol = ADD_ASSIGN
+	case TOKEN_SUB_ASSIGN:
+		symbol = SUB_ASSIGN
+	case TOKEN_MUL_ASSIGN:
+		symbol = MUL_ASSIGN
+	case TOKEN_DIV_ASSIGN:
+		symbol = DIV_ASSIGN
+	default:
+		p.errorf(operator.Span(), CODE_INVALID_OPERATOR, "bad computation, invalid symbol %s", operator)
+		return nil, false
+	}
+	right, ok := p.parseExpression()
+	if !ok {
+		return nil, false
+	}
+	return &ComputationDecl{
+		Span:     Span{Start: left.Start, End: right.GetSpan().End},
+		Left:     left.Text,
+		Operator: symbol,
+		Right:    right,
+	}, true
+}
+
+// parseSend reads send OTHER.EVENT, the event is delivered to the other model once the current step is done
+func (p *parser) parseSend() (*ComputationDecl, bool) {
+	keyword := p.next()
+	model, ok := p.parseName()
+	if !ok {
+		p.errorf(keyword.Span(), CODE_MISSING_NAME, "bad send, no model given")
+		return nil, false
+	}
+	if _, ok := p.expect(TOKEN_DOT); !ok {
+		return nil, false
+	}
+	event, ok := p.parseName()
+	if !ok {
+		p.errorf(p.previous().Span(), CODE_MISSING_NAME, "bad send, no event given for model %s", model)
+		return nil, false
+	}
+	span := Span{Start: keyword.Start, End: p.previous().End}
+	return &ComputationDecl{
+		Span: span,
+		Send: &SendDecl{Span: span, Model: model, Event: event},
+	}, true
+}
+
+// parseRaise reads raise EVENT, the event is handled by the model itself before any other event
+func (p *parser) parseRaise() (*ComputationDecl, bool) {
+	keyword := p.next()
+	event, ok := p.parseName()
+	if !ok {
+		p.errorf(keyword.Span(), CODE_MISSING_NAME, "bad raise, no event given")
+		return nil, false
+	}
+	span := Span{Start: keyword.Start, End: p.previous().End}
+	return &ComputationDecl{
+		Span: span,
+		Send: &SendDecl{Span: span, Event: event},
+	}, true
+}
+
+func (p *parser) parseName() (string, bool) {
+	token := p.peek()
+	if token.Kind != TOKEN_IDENT && token.Kind != TOKEN_STRING {
+		return "", false
+	}
+	p.next()
+	return nameOf(token), true
+}
+
+func (p *parser) expect(kind TokenKind) (Token, bool) {
+	token := p.peek()
+	if token.Kind != kind {
+		p.errorf(token.Span(), CODE_UNEXPECTED_TOKEN, "unexpected %s, expected %s", token, kind)
+		return token, false
+	}
+	return p.next(), true
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.current]
+}
+
+func (p *parser) previous() Token {
+	if p.current == 0 {
+		return p.tokens[0]
+	}
+	return p.tokens[p.current-1]
+}
+
+func (p *parser) next() Token {
+	token := p.tokens[p.current]
+	if token.Kind != TOKEN_EOF {
+		p.current++
+	}
+	return token
+}
+
+// progress drops the token when recovering from an error read nothing past it, so that every loop moves on
+func (p *parser) progress(token Token) {
+	if p.peek() == token && token.Kind != TOKEN_EOF {
+		p.next()
+	}
+}
+
+// skipLine drops the remaining tokens on the line to recover from a syntax error.
+// A closing brace is left for the enclosing block, an opening brace skips the whole block.
+func (p *parser) skipLine(line int) {
+	for {
+		token := p.peek()
+		if token.Kind == TOKEN_EOF || token.Kind == TOKEN_RBRACE || token.Start.Line != line {
+			return
+		}
+		p.next()
+		if token.Kind == TOKEN_LBRACE {
+			p.skipBlock()
 		}
-		conditionals.Conditions = append(conditionals.Conditions, condition)
 	}
-	return &conditionals
 }
 
-func cleanEventString(event string) string {
-	return strings.Trim(strings.TrimSpace(event), "\"")
+func (p *parser) skipBlock() {
+	depth := 1
+	for depth > 0 {
+		switch p.next().Kind {
+		case TOKEN_EOF:
+			return
+		case TOKEN_LBRACE:
+			depth++
+		case TOKEN_RBRACE:
+			depth--
+		}
+	}
+}
+
+func (p *parser) errorf(span Span, code DiagnosticCode, format string, args ...any) {
+	p.diagnostics.Errorf(p.fileName, span, code, format, args...)
+}
+
+func nameOf(token Token) string {
+	if token.Kind == TOKEN_STRING {
+		return unquote(token.Text)
+	}
+	return token.Text
+}
+
+func isValueToken(kind TokenKind) bool {
+	return kind == TOKEN_IDENT || kind == TOKEN_STRING || isNumberToken(kind)
+}
+
+func isNumberToken(kind TokenKind) bool {
+	return kind == TOKEN_INT || kind == TOKEN_FLOAT
 }
@@ -0,0 +1,85 @@
+package fsm
+
+import (
+	"fmt"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+// MAX_MICROSTEPS bounds the raised events handled for a single event, models that keep raising events crash
+const MAX_MICROSTEPS = 100
+
+// queuedEvent is an external event posted to the model, along with its arguments
+type queuedEvent struct {
+	event     string
+	arguments map[string]any
+}
+
+// MaxMicrosteps sets how many raised events the model handles for a single event before it crashes
+func (fsm *FsmBuilder) MaxMicrosteps(steps int) *FsmBuilder {
+	fsm.maxMicrosteps = steps
+	return fsm
+}
+
+// Post queues an external event, Step handles it once the events posted before it are handled
+func (fsm *FiniteStateMachine) Post(event string) {
+	fsm.PostWith(event, nil)
+}
+
+// PostWith is Post for an event carrying arguments
+func (fsm *FiniteStateMachine) PostWith(event string, arguments map[string]any) {
+	fsm.queue = append(fsm.queue, queuedEvent{event: event, arguments: arguments})
+}
+
+// Step handles the next posted event to completion, it reports false when no event is posted
+func (fsm *FiniteStateMachine) Step() bool {
+	if len(fsm.queue) == 0 {
+		return false
+	}
+	next := fsm.queue[0]
+	fsm.queue = fsm.queue[1:]
+	fsm.FireWith(next.event, next.arguments)
+	return true
+}
+
+// GetPending returns how many posted events are still to be handled
+func (fsm *FiniteStateMachine) GetPending() int {
+	return len(fsm.queue)
+}
+
+// GetInternalSteps returns how many raised events were handled for the last event
+func (fsm *FiniteStateMachine) GetInternalSteps() int {
+	return fsm.internalSteps
+}
+
+// raise queues an internal event, it is handled before any posted event once the current event is handled
+func (fsm *FiniteStateMachine) raise(event string) {
+	fsm.logger.Debugf("Raising %s", event)
+	fsm.raised = append(fsm.raised, event)
+}
+
+// runToCompletion handles the raised events in order until none are left.
+// A raised event no transition reacts to is discarded, the model carries on.
+func (fsm *FiniteStateMachine) runToCompletion() {
+	for len(fsm.raised) > 0 {
+		if fsm.mode == mode.TERMINATE || fsm.mode == mode.CRASH {
+			fsm.raised = nil
+			return
+		}
+		if fsm.internalSteps == fsm.maxMicrosteps {
+			fsm.fail(mode.CRASH, fmt.Errorf("Still raising events after %d microsteps", fsm.maxMicrosteps))
+			fsm.raised = nil
+			return
+		}
+		event := fsm.raised[0]
+		fsm.raised = fsm.raised[1:]
+		fsm.internalSteps++
+		fsm.dispatch(event, nil)
+		if fsm.mode == mode.DEADLOCK {
+			fsm.logger.Debugf("Discarding %s, no transition reacts to it", event)
+			fsm.cause = ""
+			fsm.err = nil
+			fsm.mode = mode.CONTINUE
+		}
+	}
+}
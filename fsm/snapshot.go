@@ -0,0 +1,343 @@
+package fsm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+// SNAPSHOT_MAGIC begins the binary form of a snapshot, it is followed by SNAPSHOT_VERSION
+const SNAPSHOT_MAGIC = "AMLS"
+
+const SNAPSHOT_VERSION byte = 1
+
+// Snapshot is the state of a running model, taken by FiniteStateMachine.Snapshot and resumed by Restore.
+// It encodes as JSON, and in a compact binary form with MarshalBinary.
+type Snapshot struct {
+	Model         string             `json:"model"`
+	Hash          string             `json:"hash"`
+	Configuration []string           `json:"configuration"`
+	Variables     []SnapshotVariable `json:"variables"`
+	Mode          mode.Mode          `json:"mode"`
+	Cause         string             `json:"cause,omitempty"`
+}
+
+// SnapshotVariable is a variable along with its type, Enum names the enum of an ENUM variable
+type SnapshotVariable struct {
+	Name  string
+	Type  VariableType
+	Enum  string
+	Value any
+}
+
+type snapshotVariableJSON struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Enum  string          `json:"enum,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (variable SnapshotVariable) MarshalJSON() ([]byte, error) {
+	value, err := json.Marshal(variable.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(snapshotVariableJSON{Name: variable.Name, Type: variable.Type.String(), Enum: variable.Enum, Value: value})
+}
+
+// UnmarshalJSON reads the value as its type, so that an int stays an int64
+func (variable *SnapshotVariable) UnmarshalJSON(data []byte) error {
+	var decoded snapshotVariableJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	variableType, known := ParseVariableType(decoded.Type)
+	if decoded.Type == ENUM.String() {
+		variableType, known = ENUM, true
+	}
+	if !known {
+		return fmt.Errorf("variable %s has the unknown type %s", decoded.Name, decoded.Type)
+	}
+	var value any
+	switch variableType {
+	case INT:
+		value = new(int64)
+	case FLOAT:
+		value = new(float64)
+	case BOOL:
+		value = new(bool)
+	default:
+		value = new(string)
+	}
+	if err := json.Unmarshal(decoded.Value, value); err != nil {
+		return fmt.Errorf("variable %s is not a %s, %s", decoded.Name, variableType, err.Error())
+	}
+	*variable = SnapshotVariable{Name: decoded.Name, Type: variableType, Enum: decoded.Enum, Value: reflect.ValueOf(value).Elem().Interface()}
+	return nil
+}
+
+// Snapshot takes the state of the model, the events still queued and the progress of the timers are left out
+func (fsm *FiniteStateMachine) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		Model:         fsm.modelName,
+		Hash:          fsm.GetHash(),
+		Configuration: fsm.GetConfiguration(),
+		Variables:     make([]SnapshotVariable, 0, len(fsm.declared.types)),
+		Mode:          fsm.mode,
+		Cause:         fsm.cause,
+	}
+	for _, name := range sortedKeys(fsm.declared.types) {
+		snapshot.Variables = append(snapshot.Variables, SnapshotVariable{
+			Name:  name,
+			Type:  fsm.variables.GetType(name),
+			Enum:  fsm.variables.GetEnumType(name),
+			Value: normalize(fsm.variables.Get(name)),
+		})
+	}
+	return snapshot
+}
+
+// Restore resumes the model from a snapshot taken of the same model, a snapshot of any other model is refused.
+// The timers of the active states start over and the queued events are dropped.
+func (fsm *FiniteStateMachine) Restore(snapshot Snapshot) error {
+	if snapshot.Hash != fsm.GetHash() {
+		return fmt.Errorf("the snapshot of model %s does not match model %s", snapshot.Model, fsm.modelName)
+	}
+	configuration := make([]*State, len(snapshot.Configuration))
+	for i, name := range snapshot.Configuration {
+		state, exists := fsm.states[name]
+		if !exists {
+			return fmt.Errorf("the snapshot is in state %s, which is not declared", name)
+		}
+		configuration[i] = state
+	}
+	variables := fsm.declared.Copy()
+	for _, variable := range snapshot.Variables {
+		declaredType, declared := fsm.declared.types[variable.Name]
+		if !declared || declaredType != variable.Type {
+			return fmt.Errorf("the snapshot has the %s variable %s, which is not declared as such", variable.Type, variable.Name)
+		}
+		value, err := convert(normalize(variable.Value), variable.Type)
+		if err != nil {
+			return fmt.Errorf("the snapshot has a bad value for %s, %s", variable.Name, err.Error())
+		}
+		variables.Set(variable.Name, value)
+	}
+	fsm.configuration = configuration
+	fsm.variables = variables
+	fsm.mode = snapshot.Mode
+	fsm.cause = snapshot.Cause
+	fsm.outbox = nil
+	fsm.raised = nil
+	fsm.queue = nil
+	fsm.internalSteps = 0
+	fsm.SetClock(fsm.clock)
+	return nil
+}
+
+// ReadSnapshot reads a snapshot in either form, the binary form is told apart by SNAPSHOT_MAGIC
+func ReadSnapshot(data []byte) (Snapshot, error) {
+	var snapshot Snapshot
+	var err error
+	if bytes.HasPrefix(data, []byte(SNAPSHOT_MAGIC)) {
+		err = snapshot.UnmarshalBinary(data)
+	} else {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	return snapshot, err
+}
+
+// MarshalBinary writes the snapshot as SNAPSHOT_MAGIC and SNAPSHOT_VERSION followed by the fields in order.
+// Strings and counts are prefixed by their length as uvarints, ints are varints and floats their IEEE 754 bits.
+func (snapshot Snapshot) MarshalBinary() ([]byte, error) {
+	buffer := bytes.NewBufferString(SNAPSHOT_MAGIC)
+	buffer.WriteByte(SNAPSHOT_VERSION)
+	writeUvarint := func(n uint64) {
+		buffer.Write(binary.AppendUvarint(nil, n))
+	}
+	writeString := func(s string) {
+		writeUvarint(uint64(len(s)))
+		buffer.WriteString(s)
+	}
+	writeString(snapshot.Model)
+	writeString(snapshot.Hash)
+	writeUvarint(uint64(len(snapshot.Configuration)))
+	for _, state := range snapshot.Configuration {
+		writeString(state)
+	}
+	writeUvarint(uint64(len(snapshot.Variables)))
+	for _, variable := range snapshot.Variables {
+		writeString(variable.Name)
+		buffer.WriteByte(byte(variable.Type))
+		value, err := convert(normalize(variable.Value), variable.Type)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s, %s", variable.Name, err.Error())
+		}
+		switch v := value.(type) {
+		case int64:
+			buffer.Write(binary.AppendVarint(nil, v))
+		case float64:
+			buffer.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+		case bool:
+			if v {
+				buffer.WriteByte(1)
+			} else {
+				buffer.WriteByte(0)
+			}
+		case string:
+			writeString(v)
+		}
+		if variable.Type == ENUM {
+			writeString(variable.Enum)
+		}
+	}
+	buffer.WriteByte(byte(snapshot.Mode))
+	writeString(snapshot.Cause)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary reads the form written by MarshalBinary
+func (snapshot *Snapshot) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(SNAPSHOT_MAGIC)) {
+		return fmt.Errorf("not a snapshot")
+	}
+	reader := bytes.NewReader(data[len(SNAPSHOT_MAGIC):])
+	if version, err := reader.ReadByte(); err != nil || version != SNAPSHOT_VERSION {
+		return fmt.Errorf("unsupported snapshot version")
+	}
+	var err error
+	readUvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var n uint64
+		n, err = binary.ReadUvarint(reader)
+		return n
+	}
+	readByte := func() byte {
+		if err != nil {
+			return 0
+		}
+		var b byte
+		b, err = reader.ReadByte()
+		return b
+	}
+	readString := func() string {
+		length := readUvarint()
+		if err != nil {
+			return ""
+		}
+		if length > uint64(reader.Len()) {
+			err = fmt.Errorf("truncated snapshot")
+			return ""
+		}
+		s := make([]byte, length)
+		reader.Read(s)
+		return string(s)
+	}
+	decoded := Snapshot{Model: readString(), Hash: readString()}
+	count := readUvarint()
+	for i := uint64(0); i < count && err == nil; i++ {
+		decoded.Configuration = append(decoded.Configuration, readString())
+	}
+	count = readUvarint()
+	for i := uint64(0); i < count && err == nil; i++ {
+		variable := SnapshotVariable{Name: readString(), Type: VariableType(readByte())}
+		switch variable.Type {
+		case INT:
+			var v int64
+			if err == nil {
+				v, err = binary.ReadVarint(reader)
+			}
+			variable.Value = v
+		case FLOAT:
+			bits := make([]byte, 8)
+			if err == nil {
+				_, err = io.ReadFull(reader, bits)
+			}
+			variable.Value = math.Float64frombits(binary.LittleEndian.Uint64(bits))
+		case BOOL:
+			variable.Value = readByte() == 1
+		case STRING, ENUM:
+			variable.Value = readString()
+		default:
+			err = fmt.Errorf("variable %s has an unknown type", variable.Name)
+		}
+		if variable.Type == ENUM {
+			variable.Enum = readString()
+		}
+		decoded.Variables = append(decoded.Variables, variable)
+	}
+	decoded.Mode = mode.Mode(readByte())
+	decoded.Cause = readString()
+	if err != nil {
+		return fmt.Errorf("bad snapshot, %s", err.Error())
+	}
+	*snapshot = decoded
+	return nil
+}
+
+// GetHash identifies the model by its states, transitions, variables and events, the values of the variables are left out.
+// A snapshot can only be restored by a model with the same hash.
+func (fsm *FiniteStateMachine) GetHash() string {
+	if cached, contains := fsm.cache["hash"]; contains {
+		return cached.(string)
+	}
+	// only while the model is built, the hash is cached from then on
+	hash := sha256.Sum256([]byte(fsm.describe()))
+	return hex.EncodeToString(hash[:])
+}
+
+// describe writes out the model in a canonical form, the same model is described the same way every time
+func (fsm *FiniteStateMachine) describe() string {
+	var description strings.Builder
+	fmt.Fprintf(&description, "model %s\n", fsm.modelName)
+	for _, enum := range fsm.declared.GetEnums() {
+		fmt.Fprintf(&description, "enum %s %s\n", enum.Name, strings.Join(enum.Members, ","))
+	}
+	for _, name := range sortedKeys(fsm.declared.types) {
+		fmt.Fprintf(&description, "var %s %s %s\n", name, fsm.declared.GetType(name), fsm.declared.GetEnumType(name))
+	}
+	for _, event := range sortedKeys(fsm.events) {
+		fmt.Fprintf(&description, "event %s %v\n", event, fsm.events[event])
+	}
+	describeEdge := func(prefix string, edge *Edge) {
+		fmt.Fprintf(&description, "\t%s %s %s %s\n", prefix, edge.condition2.Generate(), generateResultingState(edge), edge.computation2.Generate())
+	}
+	for _, name := range sortedKeys(fsm.states) {
+		state := fsm.states[name]
+		fmt.Fprintf(&description, "state %s %s %s %t %v\n", name, state.parent, state.initial, state.parallel, state.children)
+		fmt.Fprintf(&description, "\tentry %s\n\texit %s\n\t>> %s\n", state.entry.Generate(), state.exit.Generate(), state.defaultComputations.Generate())
+		for _, autoEvent := range state.autoEvents {
+			describeEdge("|>", autoEvent.edge())
+		}
+		for _, event := range sortedKeys(state.transitions) {
+			for _, edge := range state.transitions[event] {
+				describeEdge(event, edge)
+			}
+		}
+		for _, timer := range state.timers {
+			describeEdge(timer.String(), timer.edge)
+		}
+	}
+	for _, name := range sortedKeys(fsm.choices) {
+		choice := fsm.choices[name]
+		fmt.Fprintf(&description, "choice %s\n", name)
+		for _, branch := range choice.branches {
+			describeEdge("when", branch)
+		}
+		choice.otherwise.HasValue(func(otherwise *Edge) {
+			describeEdge("else", otherwise)
+		})
+	}
+	return description.String()
+}
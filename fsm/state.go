@@ -12,14 +12,40 @@ type AutoEvent struct {
 	compuatations  Computational
 	resultingState string
 	terminate      mode.Mode
+	disabled       bool
+	origin         origin
+}
+
+// edge returns the auto-event as an edge, so that it is taken like a transition
+func (autoEvent *AutoEvent) edge() *Edge {
+	edge := Edge{
+		terminate:      autoEvent.terminate,
+		resultingState: types.None[string](),
+		computation:    types.None[functions.Consumer[*Variables]](),
+		computation2:   autoEvent.compuatations,
+		condition:      types.None[functions.Predicate[*Variables]](),
+		condition2:     autoEvent.conditions,
+		disabled:       autoEvent.disabled,
+	}
+	if autoEvent.terminate != mode.TERMINATE {
+		edge.resultingState = types.Some(autoEvent.resultingState)
+	}
+	return &edge
 }
 
 type State struct {
 	logger              logger.Logger
 	name                string
+	parent              string
+	children            []string
+	initial             string
+	parallel            bool
+	entry               Computational
+	exit                Computational
 	defaultComputations Computational
 	autoEvents          []AutoEvent
 	transitions         map[string][]*Edge
+	timers              []*Timer
 	cache               map[string]any
 }
 
@@ -27,53 +53,87 @@ func (state *State) GetTransitions() map[string][]*Edge {
 	return state.transitions
 }
 
-func (state *State) fire(event string, variables *Variables) (types.Option[string], mode.Mode) {
+// fire returns the first edge for the event whose guard holds, a terminating edge included.
+// The outcome of every guard checked is passed to evaluated.
+func (state *State) fire(event string, variables *Variables, evaluated func(edge *Edge, holds bool)) (types.Option[*Edge], error) {
 	arr, containsEvent := state.transitions[event]
 	if !containsEvent {
-		return types.None[string](), mode.DEADLOCK
+		return types.None[*Edge](), nil
 	}
 	state.logger.Debugf("Checking %d edge(s) ...", len(arr))
 	for _, edge := range arr {
-		res, newMode := edge.checkCondition(variables)
-		if res.IsSome() {
-			return res, mode.CONTINUE
+		res, newMode, err := edge.checkCondition(variables)
+		if err != nil {
+			return types.None[*Edge](), err
 		}
-		if newMode == mode.TERMINATE {
-			return res, newMode
+		holds := res.IsSome() || newMode == mode.TERMINATE
+		evaluated(edge, holds)
+		if holds {
+			return types.Some(edge), nil
 		}
 	}
-	return types.None[string](), mode.DEADLOCK
+	return types.None[*Edge](), nil
 }
 
+// GetEdgeTriggers returns the events the state has transitions for, they are listed once when the state is built
 func (state *State) GetEdgeTriggers() []string {
-	cached, contains := state.cache["edge-triggers"]
-	if contains {
-		return cached.([]string)
-	}
-	cache := make([]string, 0, len(state.transitions))
-	for k := range state.transitions {
-		cache = append(cache, k)
-	}
-	state.cache["edge-triggers"] = cache
-	return cache
+	return state.cache["edge-triggers"].([]string)
 }
 
 func (state *State) GetName() string {
 	return state.name
 }
 
+// GetParent is the state containing this state, none for top level states
+func (state *State) GetParent() types.Option[string] {
+	if len(state.parent) == 0 {
+		return types.None[string]()
+	}
+	return types.Some(state.parent)
+}
+
+func (state *State) GetChildren() []string {
+	return state.children
+}
+
+// IsParallel reports if the substates are regions that are all active at the same time
+func (state *State) IsParallel() bool {
+	return state.parallel
+}
+
+// GetInitial is the substate entered when this state is entered, none for states without substates
+func (state *State) GetInitial() types.Option[string] {
+	if len(state.initial) == 0 {
+		return types.None[string]()
+	}
+	return types.Some(state.initial)
+}
+
 type StateBuilder struct {
 	logger              logger.Logger
 	name                string
+	children            []string
+	initial             string
+	parallel            bool
+	descendants         []*State
+	entry               Computational
+	exit                Computational
 	defaultComputations Computational
 	autoEvents          []AutoEvent
 	transitions         map[string][]*Edge
+	timers              []*Timer
 }
 
 func newStateBuilder(state string) StateBuilder {
 	return StateBuilder{
 		logger: logger.New(state + "(Builder)"),
 		name:   state,
+		entry: Computational{
+			FuncSignature: "func()",
+		},
+		exit: Computational{
+			FuncSignature: "func()",
+		},
 		defaultComputations: Computational{
 			FuncSignature: "func(event string)",
 		},
@@ -82,16 +142,52 @@ func newStateBuilder(state string) StateBuilder {
 }
 
 func (builder *StateBuilder) build() State {
+	initial := builder.initial
+	if builder.parallel {
+		initial = ""
+	} else if len(initial) == 0 && len(builder.children) > 0 {
+		initial = builder.children[0]
+	}
 	return State{
 		logger:              logger.New(builder.name),
 		name:                builder.name,
+		children:            builder.children,
+		initial:             initial,
+		parallel:            builder.parallel,
+		entry:               builder.entry,
+		exit:                builder.exit,
 		defaultComputations: builder.defaultComputations,
 		autoEvents:          builder.autoEvents,
 		transitions:         builder.transitions,
-		cache:               map[string]any{},
+		timers:              builder.timers,
+		cache:               map[string]any{"edge-triggers": sortedKeys(builder.transitions)},
 	}
 }
 
+// Given declares a substate, transitions of this state also apply while in the substate
+func (builder *StateBuilder) Given(state string, f functions.Consumer[*StateBuilder]) *StateBuilder {
+	sb := newStateBuilder(state)
+	f(&sb)
+	st := sb.build()
+	st.parent = builder.name
+	builder.children = append(builder.children, state)
+	builder.descendants = append(builder.descendants, &st)
+	builder.descendants = append(builder.descendants, sb.descendants...)
+	return builder
+}
+
+// Initial sets the substate entered when this state is entered, defaults to the first substate
+func (builder *StateBuilder) Initial(state string) *StateBuilder {
+	builder.initial = state
+	return builder
+}
+
+// Parallel makes the substates regions, entering the state enters all of them
+func (builder *StateBuilder) Parallel() *StateBuilder {
+	builder.parallel = true
+	return builder
+}
+
 func (builder *StateBuilder) When(event string, f functions.Consumer[*EdgeBuilder]) *StateBuilder {
 	edgeBuilder := newEdgeBuilder()
 	f(&edgeBuilder)
@@ -106,6 +202,20 @@ func (builder *StateBuilder) When(event string, f functions.Consumer[*EdgeBuilde
 	return builder
 }
 
+// OnEntry sets the computations run when the state is entered
+func (builder *StateBuilder) OnEntry(computations *Computational) *StateBuilder {
+	builder.entry = *computations
+	builder.entry.FuncSignature = "func()"
+	return builder
+}
+
+// OnExit sets the computations run when the state is left
+func (builder *StateBuilder) OnExit(computations *Computational) *StateBuilder {
+	builder.exit = *computations
+	builder.exit.FuncSignature = "func()"
+	return builder
+}
+
 func (builder *StateBuilder) AutoRun(computations *Computational) *StateBuilder {
 	builder.defaultComputations = *computations
 	return builder
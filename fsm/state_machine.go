@@ -1,62 +1,238 @@
 package fsm
 
 import (
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/Wafl97/go_aml/fsm/mode"
 	"github.com/Wafl97/go_aml/util/functions"
 	"github.com/Wafl97/go_aml/util/logger"
 	"github.com/Wafl97/go_aml/util/types"
 )
 
+// FiniteStateMachine is a running model. It is not safe for concurrent use,
+// run it as a runners.Actor to fire events from several goroutines.
 type FiniteStateMachine struct {
-	cause        string
-	mode         mode.Mode
-	logger       logger.Logger
-	modelName    string
-	states       map[string]*State
-	currentState types.Option[*State]
-	variables    Variables
-	cache        map[string]any
+	cause         string
+	mode          mode.Mode
+	logger        logger.Logger
+	definition    *Definition
+	modelName     string
+	states        map[string]*State
+	choices       map[string]*Choice
+	initial       *State
+	configuration []*State
+	variables     Variables
+	declared      Variables
+	events        map[string][]Parameter
+	outbox        []Message
+	clock         Clock
+	now           time.Time
+	armed         map[*Timer]time.Time
+	raised        []string
+	queue         []queuedEvent
+	maxMicrosteps int
+	internalSteps int
+	observers     map[Hook][]*registration
+	step          Observation
+	err           error
+	failed        []FailedGuard
+	cache         map[string]any
+}
+
+// Fire lets every active region react to the event, in the order the regions are declared,
+// and then handles the events raised meanwhile, see MaxMicrosteps. The transitions of a state holding parallel regions
+// are only tried when none of its regions took the event.
+// The error tells why the model deadlocked or crashed on the event, see ErrNoEnabledTransition.
+func (fsm *FiniteStateMachine) Fire(event string) error {
+	return fsm.FireWith(event, nil)
 }
 
-func (fsm *FiniteStateMachine) Fire(event string) {
+func (fsm *FiniteStateMachine) fire(event string) {
 	fsm.logger.Debugf("Firing %s", event)
-	maybeState := fsm.currentState
-	if maybeState.IsNone() {
-		fsm.cause = "No current state"
-		fsm.mode = mode.DEADLOCK
+	fsm.now = fsm.clock.Now()
+	fsm.failed = nil
+	if len(fsm.configuration) == 0 {
+		fsm.fail(mode.DEADLOCK, fmt.Errorf("No current state, %w", ErrNoEnabledTransition))
 		return
 	}
-	currentState := maybeState.Get()
-	fsm.logger.Debugf("Checking %s ...", currentState.GetName())
-	state, currentMode := currentState.fire(event, &fsm.variables)
-	fsm.mode = currentMode
-	if state.IsNone() {
-		fsm.cause = "No resulting state from transition"
-		fsm.mode = mode.DEADLOCK
-		return
+	fired := false
+	sources := []*State{}
+	pending := append([]*State{}, fsm.configuration...)
+	for len(pending) > 0 {
+		deferred := []*State{}
+		for _, state := range pending {
+			if !fsm.IsIn(state.name) || fsm.anyWithin(sources, state) {
+				// left by a transition of an earlier region, or one of its regions took the event
+				continue
+			}
+			if fsm.anyWithin(pending, state) {
+				// a shared state is tried once the regions within it had their turn
+				deferred = appendOnce(deferred, state)
+				continue
+			}
+			source, edge, shared, err := fsm.fireFrom(state, event)
+			if err != nil {
+				fsm.fail(mode.CRASH, err)
+				return
+			}
+			shared.HasValue(func(shared *State) {
+				deferred = appendOnce(deferred, shared)
+			})
+			if edge.IsNone() {
+				continue
+			}
+			fsm.logger.Debugf("Transition [%s] -> [%s]", source.GetName(), generateResultingState(edge.Get()))
+			resultMode, err := fsm.take(source, event, edge.Get())
+			if err != nil {
+				fsm.fail(mode.CRASH, err)
+				return
+			}
+			if resultMode == mode.TERMINATE {
+				fsm.mode = mode.TERMINATE
+				return
+			}
+			sources = append(sources, source)
+			fired = true
+		}
+		pending = deferred
 	}
-	newStateName := state.Get()
-	fsm.logger.Debugf("Transition [%s] -> [%s]", fsm.GetCurrentState().Get().GetName(), newStateName)
-	newState, hasState := fsm.states[newStateName]
-	if !hasState {
-		fsm.cause = "State not found from transition"
-		fsm.mode = mode.CRASH
-		fsm.currentState = types.None[*State]()
+	if !fired {
+		ran, resultMode, err := fsm.runAutoEvents(event)
+		switch {
+		case err != nil:
+			fsm.fail(mode.CRASH, err)
+			return
+		case resultMode == mode.TERMINATE:
+			fsm.mode = mode.TERMINATE
+			return
+		case !ran && !fsm.isKnown(event):
+			fsm.fail(mode.DEADLOCK, &UnknownEventError{Event: event})
+			return
+		case !ran:
+			fsm.fail(mode.DEADLOCK, &NoEnabledTransitionError{Event: event, Configuration: fsm.GetConfiguration(), Guards: fsm.failed})
+			return
+		}
 	}
-	fsm.currentState = types.Some(newState)
+	fsm.mode = mode.CONTINUE
 }
 
-func (fsm *FiniteStateMachine) GetRegisteredStates() []string {
-	cached, contains := fsm.cache["states-keys"]
-	if contains {
-		return cached.([]string)
+// runAutoEvents runs the auto-computation and then the auto-events of the active states, innermost first,
+// like the generated code does for an event no transition reacts to. A state stops once one of its auto-events leaves it.
+// It reports if an auto-computation ran or an auto-event was taken.
+func (fsm *FiniteStateMachine) runAutoEvents(event string) (bool, mode.Mode, error) {
+	ran := false
+	visited := map[string]bool{}
+	for _, leaf := range append([]*State{}, fsm.configuration...) {
+		for state := leaf; state != nil && !visited[state.name]; state = fsm.states[state.parent] {
+			visited[state.name] = true
+			if !fsm.IsIn(state.name) {
+				break
+			}
+			if len(state.defaultComputations.Computations) > 0 {
+				if err := fsm.compute(state, event); err != nil {
+					return ran, mode.CRASH, err
+				}
+				ran = true
+			}
+			for i := range state.autoEvents {
+				if !fsm.IsIn(state.name) {
+					break
+				}
+				edge := state.autoEvents[i].edge()
+				holds, err := edge.holds(&fsm.variables)
+				if err != nil {
+					return ran, mode.CRASH, err
+				}
+				fsm.evaluated(state, event)(edge, holds)
+				if !holds {
+					continue
+				}
+				ran = true
+				fsm.logger.Debugf("Auto-event [%s] -> [%s]", state.name, generateResultingState(edge))
+				resultMode, err := fsm.take(state, event, edge)
+				if err != nil || resultMode == mode.TERMINATE {
+					return ran, resultMode, err
+				}
+			}
+		}
+	}
+	return ran, mode.CONTINUE, nil
+}
+
+// fireFrom tries the transitions of the state and then those of its ancestors, innermost first.
+// The state owning the enabled edge is returned as the source. The ancestors holding other active regions are shared,
+// the first one is returned instead of being tried, so that fire only tries it once none of its regions took the event.
+func (fsm *FiniteStateMachine) fireFrom(state *State, event string) (*State, types.Option[*Edge], types.Option[*State], error) {
+	for {
+		fsm.logger.Debugf("Checking %s ...", state.GetName())
+		edge, err := state.fire(event, &fsm.variables, fsm.evaluated(state, event))
+		if err != nil || edge.IsSome() {
+			return state, edge, types.None[*State](), err
+		}
+		parent, hasParent := fsm.states[state.parent]
+		if !hasParent {
+			return state, edge, types.None[*State](), err
+		}
+		if fsm.hasOtherRegions(parent, state) {
+			return state, edge, types.Some(parent), err
+		}
+		state = parent
 	}
-	cache := make([]string, 0, len(fsm.states))
-	for k := range fsm.states {
-		cache = append(cache, k)
+}
+
+// hasOtherRegions reports if an active state within the ancestor lies outside of the state
+func (fsm *FiniteStateMachine) hasOtherRegions(ancestor *State, state *State) bool {
+	for _, leaf := range fsm.configuration {
+		if fsm.isDescendant(leaf, ancestor) && !fsm.isDescendant(leaf, state) {
+			return true
+		}
 	}
-	fsm.cache["states-keys"] = cache
-	return cache
+	return false
+}
+
+// anyWithin reports if one of the states is a substate of the ancestor
+func (fsm *FiniteStateMachine) anyWithin(states []*State, ancestor *State) bool {
+	for _, state := range states {
+		if state != ancestor && fsm.isDescendant(state, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendOnce(states []*State, state *State) []*State {
+	if slices.Contains(states, state) {
+		return states
+	}
+	return append(states, state)
+}
+
+// send queues a message in the outbox, a System delivers it once the current step is done.
+// A raised message is queued for the model itself instead.
+func (fsm *FiniteStateMachine) send(message Message) {
+	if message.IsRaised() {
+		fsm.raise(message.Event)
+		return
+	}
+	fsm.logger.Debugf("Sending %s", message)
+	fsm.outbox = append(fsm.outbox, message)
+}
+
+// GetOutbox returns the messages sent by the last step, or by the initial entry actions before the first event
+func (fsm *FiniteStateMachine) GetOutbox() []Message {
+	return fsm.outbox
+}
+
+// isKnown reports if the event is declared or any transition of the model is on it
+func (fsm *FiniteStateMachine) isKnown(event string) bool {
+	return fsm.cache["events"].(map[string]bool)[event]
+}
+
+// GetRegisteredStates returns the names of the states, they are listed once when the model is built
+func (fsm *FiniteStateMachine) GetRegisteredStates() []string {
+	return fsm.cache["states-keys"].([]string)
 }
 
 func (fsm *FiniteStateMachine) GetMode() mode.Mode {
@@ -67,30 +243,48 @@ func (fsm *FiniteStateMachine) GetCause() string {
 	return fsm.cause
 }
 
+func (fsm *FiniteStateMachine) GetVariables() *Variables {
+	return &fsm.variables
+}
+
 func (fsm *FiniteStateMachine) GetModelName() string {
 	return fsm.modelName
 }
 
+// GetCurrentState returns the innermost active state, the one of the first region when there are parallel regions
 func (fsm *FiniteStateMachine) GetCurrentState() types.Option[*State] {
-	return fsm.currentState
+	if len(fsm.configuration) == 0 {
+		return types.None[*State]()
+	}
+	return types.Some(fsm.configuration[0])
 }
 
 type FsmBuilder struct {
-	logger       logger.Logger
-	modelName    string
-	states       map[string]*State
-	initialState types.Option[*State]
-	variables    Variables
+	logger        logger.Logger
+	modelName     string
+	states        map[string]*State
+	choices       map[string]*Choice
+	initialState  types.Option[*State]
+	initialName   string
+	duplicates    []string
+	variables     Variables
+	events        map[string][]Parameter
+	clock         Clock
+	maxMicrosteps int
 }
 
 func NewFsmBuilder() FsmBuilder {
 	builderLogger := logger.New("FSM (Builder)")
 	return FsmBuilder{
-		logger:       builderLogger,
-		states:       map[string]*State{},
-		modelName:    "",
-		initialState: types.None[*State](),
-		variables:    NewVariables(),
+		logger:        builderLogger,
+		states:        map[string]*State{},
+		choices:       map[string]*Choice{},
+		modelName:     "",
+		initialState:  types.None[*State](),
+		variables:     NewVariables(),
+		events:        map[string][]Parameter{},
+		clock:         NewSystemClock(),
+		maxMicrosteps: MAX_MICROSTEPS,
 	}
 }
 
@@ -99,8 +293,29 @@ func (fsm *FsmBuilder) Name(modelName string) *FsmBuilder {
 	return fsm
 }
 
+// DeclareVar declares a variable, the type is inferred from the value
 func (fsm *FsmBuilder) DeclareVar(key string, value any) *FsmBuilder {
 	fsm.variables.Set(key, value)
+	fsm.variables.SetType(key, NewLiteral(value).Type)
+	return fsm
+}
+
+// DeclareEnum declares an enum, variables of it are declared with DeclareEnumVar
+func (fsm *FsmBuilder) DeclareEnum(name string, members ...string) *FsmBuilder {
+	fsm.variables.DeclareEnum(&Enum{Name: name, Members: members})
+	return fsm
+}
+
+func (fsm *FsmBuilder) DeclareEnumVar(key string, enumName string, member string) *FsmBuilder {
+	fsm.variables.Set(key, member)
+	fsm.variables.SetEnumType(key, enumName)
+	return fsm
+}
+
+// DeclareEvent declares the parameters carried by the event, see FireWith. A parameter must not have the name of a variable,
+// Validate reports it and the event crashes the model instead of overwriting the variable.
+func (fsm *FsmBuilder) DeclareEvent(event string, parameters ...Parameter) *FsmBuilder {
+	fsm.events[event] = parameters
 	return fsm
 }
 
@@ -108,31 +323,37 @@ func (fsm *FsmBuilder) Given(state string, f functions.Consumer[*StateBuilder])
 	sb := newStateBuilder(state)
 	f(&sb)
 	st := sb.build()
-	fsm.states[state] = &st
+	fsm.declare(&st)
+	for _, substate := range sb.descendants {
+		fsm.declare(substate)
+	}
 	return fsm
 }
 
+// declare adds the state, a state declared twice replaces the earlier one and is reported by Validate
+func (fsm *FsmBuilder) declare(state *State) {
+	_, isState := fsm.states[state.name]
+	_, isChoice := fsm.choices[state.name]
+	if isState || isChoice {
+		fsm.duplicates = append(fsm.duplicates, state.name)
+	}
+	fsm.states[state.name] = state
+}
+
+// Initial sets the state the model begins in, it may be declared later on. An undeclared state is reported by Validate.
 func (fsm *FsmBuilder) Initial(state string) *FsmBuilder {
+	fsm.initialName = state
 	st, contains := fsm.states[state]
 	if !contains {
-		//fsm.logger.Error("Initial state '" + state + "' is invalid")
 		return fsm
 	}
 	fsm.initialState = types.Some(st)
 	return fsm
 }
 
-func (fsm *FsmBuilder) Build() FiniteStateMachine {
-	if len(fsm.modelName) == 0 {
-		fsm.modelName = "Default (FSM)"
-	}
-	return FiniteStateMachine{
-		mode:         mode.CONTINUE,
-		logger:       logger.New(fsm.modelName),
-		modelName:    fsm.modelName,
-		currentState: fsm.initialState,
-		states:       fsm.states,
-		variables:    fsm.variables,
-		cache:        map[string]any{},
-	}
+// Build returns a machine of the model along with the problems Validate found, see Define for making several machines
+// of one model. The machine of an invalid model may deadlock or crash where the problems are.
+func (fsm *FsmBuilder) Build() (FiniteStateMachine, error) {
+	definition, err := fsm.Define()
+	return definition.NewInstance(), err
 }
@@ -18,13 +18,19 @@ var (
 	LT                   LogicSymbol = 4 // <
 	LESS_THAN_OR_EQUAL   LogicSymbol = 5 // <=
 	LE                   LogicSymbol = 5 // <=
+	AND                  LogicSymbol = 6 // &&
+	OR                   LogicSymbol = 7 // ||
 
 	ASSIGN     ArithmeticSymbol = 0 // =
 	ADD_ASSIGN ArithmeticSymbol = 1 // +=
 	SUB_ASSIGN ArithmeticSymbol = 2 // -=
 	MUL_ASSIGN ArithmeticSymbol = 3 // *=
 	DIV_ASSIGN ArithmeticSymbol = 4 // /=
-
+	ADD        ArithmeticSymbol = 5 // +
+	SUBTRACT   ArithmeticSymbol = 6 // -
+	MULTIPLY   ArithmeticSymbol = 7 // *
+	DIVIDE     ArithmeticSymbol = 8 // /
+	MODULO     ArithmeticSymbol = 9 // %
 )
 
 func (symbol LogicSymbol) LSToString() string {
@@ -41,6 +47,10 @@ func (symbol LogicSymbol) LSToString() string {
 		return "<"
 	case LE, LESS_THAN_OR_EQUAL:
 		return "<="
+	case AND:
+		return "&&"
+	case OR:
+		return "||"
 	default:
 		return ""
 	}
@@ -58,6 +68,16 @@ func (symbol ArithmeticSymbol) ASToString() string {
 		return "*="
 	case DIV_ASSIGN:
 		return "/="
+	case ADD:
+		return "+"
+	case SUBTRACT:
+		return "-"
+	case MULTIPLY:
+		return "*"
+	case DIVIDE:
+		return "/"
+	case MODULO:
+		return "%"
 	default:
 		return ""
 	}
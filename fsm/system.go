@@ -0,0 +1,272 @@
+package fsm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/functions"
+	"github.com/Wafl97/go_aml/util/logger"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+// MAX_DELIVERIES bounds the messages delivered for a single event, models that keep sending to each other crash
+const MAX_DELIVERIES = 1000
+
+// System composes models that communicate by sending events to each other.
+// Sent events are queued and delivered in order once the current step is done.
+type System struct {
+	cause    string
+	mode     mode.Mode
+	err      error
+	logger   logger.Logger
+	machines map[string]*FiniteStateMachine
+	names    []string
+	queue    []Message
+	// internalSteps counts the raised events the models handled for the last event
+	internalSteps int
+}
+
+// NewSystem composes the models, in the given order. The events sent by the initial entry actions are delivered right away.
+func NewSystem(machines ...*FiniteStateMachine) System {
+	system := System{
+		mode:     mode.CONTINUE,
+		logger:   logger.New("SYSTEM"),
+		machines: make(map[string]*FiniteStateMachine, len(machines)),
+		names:    make([]string, 0, len(machines)),
+	}
+	for _, machine := range machines {
+		system.machines[machine.GetModelName()] = machine
+		system.names = append(system.names, machine.GetModelName())
+	}
+	for _, machine := range system.GetMachines() {
+		system.queue = append(system.queue, machine.GetOutbox()...)
+	}
+	system.deliver()
+	return system
+}
+
+// Fire delivers an event given as MODEL.EVENT, and then every event sent while handling it.
+// The mode of the system is the mode the model reached on the event, unless a delivery crashes a model.
+// The error is the one the model returned, or the one of the delivery that crashed.
+func (system *System) Fire(event string) error {
+	return system.FireWith(event, nil)
+}
+
+// FireWith is Fire for an event carrying arguments, see FiniteStateMachine.FireWith
+func (system *System) FireWith(event string, arguments map[string]any) error {
+	message, ok := ParseMessage(event)
+	if !ok {
+		system.fail(mode.DEADLOCK, fmt.Errorf("Event %s does not name a model, expected MODEL.EVENT, %w", event, ErrUnknownEvent))
+		return system.err
+	}
+	return system.sendWith(message, arguments)
+}
+
+// Send delivers the message, and then every event sent while handling it
+func (system *System) Send(message Message) error {
+	return system.sendWith(message, nil)
+}
+
+func (system *System) sendWith(message Message, arguments map[string]any) error {
+	system.internalSteps = 0
+	machine, exists := system.machines[message.Model]
+	if !exists {
+		system.fail(mode.DEADLOCK, fmt.Errorf("Unknown model %s, %w", message.Model, ErrUnknownEvent))
+		return system.err
+	}
+	system.err = machine.FireWith(message.Event, arguments)
+	system.internalSteps += machine.GetInternalSteps()
+	system.cause = machine.GetCause()
+	system.mode = machine.GetMode()
+	system.queue = append(system.queue, machine.GetOutbox()...)
+	if system.mode != mode.CRASH {
+		system.deliver()
+	}
+	return system.err
+}
+
+// fail stops the system in the mode, the error is returned by Fire and its text is the cause
+func (system *System) fail(stop mode.Mode, err error) {
+	system.err = err
+	system.cause = err.Error()
+	system.mode = stop
+}
+
+// deliver hands the queued messages to their models in order, a model without a transition on the event ignores it
+func (system *System) deliver() {
+	for delivered := 0; len(system.queue) > 0; delivered++ {
+		if delivered == MAX_DELIVERIES {
+			system.fail(mode.CRASH, fmt.Errorf("Still sending events after %d deliveries", MAX_DELIVERIES))
+			system.queue = nil
+			return
+		}
+		message := system.queue[0]
+		system.queue = system.queue[1:]
+		machine, exists := system.machines[message.Model]
+		if !exists {
+			system.fail(mode.CRASH, fmt.Errorf("Sent %s to an unknown model", message))
+			system.queue = nil
+			return
+		}
+		system.logger.Debugf("Delivering %s", message)
+		err := machine.Fire(message.Event)
+		system.internalSteps += machine.GetInternalSteps()
+		if machine.GetMode() == mode.CRASH {
+			system.fail(mode.CRASH, fmt.Errorf("%s: %w", message.Model, err))
+			system.queue = nil
+			return
+		}
+		system.queue = append(system.queue, machine.GetOutbox()...)
+	}
+}
+
+// Observe registers the observer with every model, see FiniteStateMachine.Observe
+func (system *System) Observe(hook Hook, observer functions.Consumer[Observation]) func() {
+	unobserves := make([]func(), 0, len(system.names))
+	for _, machine := range system.GetMachines() {
+		unobserves = append(unobserves, machine.Observe(hook, observer))
+	}
+	return func() {
+		for _, unobserve := range unobserves {
+			unobserve()
+		}
+	}
+}
+
+// SetClock drives the timed transitions of every model with the clock
+func (system *System) SetClock(clock Clock) {
+	for _, machine := range system.GetMachines() {
+		machine.SetClock(clock)
+	}
+}
+
+// GetClock returns the clock of the first model, SetClock gives every model the same one
+func (system *System) GetClock() Clock {
+	if len(system.names) == 0 {
+		return NewSystemClock()
+	}
+	return system.machines[system.names[0]].GetClock()
+}
+
+// Tick takes the timed transitions that are due across the models in the order they fell due,
+// the events sent by each are delivered before the next one is taken. Models that terminated or crashed are left out.
+// It reports whether a model took a transition, or crashed checking a guard.
+func (system *System) Tick() bool {
+	system.internalSteps = 0
+	changed := false
+	for system.mode != mode.CRASH {
+		var next *FiniteStateMachine
+		var nextDue time.Time
+		for _, machine := range system.GetMachines() {
+			if machine.isStopped() {
+				continue
+			}
+			machine.GetNextTimeout().HasValue(func(due time.Time) {
+				if !due.After(machine.clock.Now()) && (next == nil || due.Before(nextDue)) {
+					next, nextDue = machine, due
+				}
+			})
+		}
+		if next == nil {
+			return changed
+		}
+		next.outbox = nil
+		next.internalSteps = 0
+		next.begin("")
+		_, took := next.fireNextTimer(nextDue)
+		changed = changed || took
+		next.runToCompletion()
+		next.settle()
+		system.internalSteps += next.GetInternalSteps()
+		system.cause = next.GetCause()
+		system.mode = next.GetMode()
+		system.queue = append(system.queue, next.GetOutbox()...)
+		if system.mode != mode.CRASH {
+			system.deliver()
+		}
+	}
+	return changed
+}
+
+// GetNextTimeout returns when the next timer of any model falls due
+func (system *System) GetNextTimeout() types.Option[time.Time] {
+	next := types.None[time.Time]()
+	for _, machine := range system.GetMachines() {
+		machine.GetNextTimeout().HasValue(func(due time.Time) {
+			if next.IsNone() || due.Before(next.Get()) {
+				next = types.Some(due)
+			}
+		})
+	}
+	return next
+}
+
+// GetInternalSteps returns how many raised events the models handled for the last event, across the deliveries
+func (system *System) GetInternalSteps() int {
+	return system.internalSteps
+}
+
+func (system *System) GetMode() mode.Mode {
+	return system.mode
+}
+
+func (system *System) GetCause() string {
+	return system.cause
+}
+
+// GetMachine returns the model with the name
+func (system *System) GetMachine(name string) types.Option[*FiniteStateMachine] {
+	machine, exists := system.machines[name]
+	if !exists {
+		return types.None[*FiniteStateMachine]()
+	}
+	return types.Some(machine)
+}
+
+// GetMachines returns the models in the order they were composed
+func (system *System) GetMachines() []*FiniteStateMachine {
+	machines := make([]*FiniteStateMachine, len(system.names))
+	for i, name := range system.names {
+		machines[i] = system.machines[name]
+	}
+	return machines
+}
+
+// GetConfiguration returns the active innermost states of every model as MODEL.STATE
+func (system *System) GetConfiguration() Configuration {
+	configuration := Configuration{}
+	for _, machine := range system.GetMachines() {
+		for _, state := range machine.GetConfiguration() {
+			configuration = append(configuration, qualify(machine, state))
+		}
+	}
+	return configuration
+}
+
+// GetActiveTriggers returns the events the models have transitions for as MODEL.EVENT
+func (system *System) GetActiveTriggers() []string {
+	triggers := []string{}
+	for _, machine := range system.GetMachines() {
+		for _, trigger := range machine.GetActiveTriggers() {
+			triggers = append(triggers, qualify(machine, trigger))
+		}
+	}
+	return triggers
+}
+
+// GetRegisteredStates returns the states of every model as MODEL.STATE
+func (system *System) GetRegisteredStates() []string {
+	states := []string{}
+	for _, machine := range system.GetMachines() {
+		for _, state := range machine.GetRegisteredStates() {
+			states = append(states, qualify(machine, state))
+		}
+	}
+	return states
+}
+
+// qualify prefixes the name with the model, MODEL.NAME
+func qualify(machine *FiniteStateMachine, name string) string {
+	return machine.GetModelName() + "." + name
+}
@@ -0,0 +1,62 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+const actionsModel = "syntax fsm\n" +
+	"model ACTIONS\n" +
+	"var log = \"\"\n" +
+	"init state OUTER {\n" +
+	"    entry { log = log + \"+outer \" }\n" +
+	"    exit { log = log + \"-outer \" }\n" +
+	"    GO -> OTHER (log = log + \"go \")\n" +
+	"    init state INNER {\n" +
+	"        entry {\n" +
+	"            log = log + \"+inner \"\n" +
+	"        }\n" +
+	"        exit { log = log + \"-inner \" }\n" +
+	"        SELF -> INNER (log = log + \"self \")\n" +
+	"    }\n" +
+	"}\n" +
+	"parallel OTHER {\n" +
+	"    entry { log = log + \"+other \" }\n" +
+	"    exit { log = log + \"-other \" }\n" +
+	"    BACK -> OUTER\n" +
+	"    state LEFT { entry { log = log + \"+left \" } exit { log = log + \"-left \" } }\n" +
+	"    state RIGHT { entry { log = log + \"+right \" } exit { log = log + \"-right \" } }\n" +
+	"}\n"
+
+func TestEntryAndExitActions(t *testing.T) {
+	model, diagnostics := fsm.Load("actions.aml", actionsModel)
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	variables := machine.GetVariables()
+	steps := []struct {
+		event string
+		log   string
+	}{
+		{"SELF", "-inner self +inner "},
+		{"GO", "-inner -outer go +other +left +right "},
+		{"BACK", "-right -left -other +outer +inner "},
+	}
+	for _, step := range steps {
+		variables.Set("log", "")
+		machine.Fire(step.event)
+		if log := variables.Get("log"); log != step.log {
+			t.Errorf("%s ran %q, expected %q", step.event, log, step.log)
+		}
+	}
+}
+
+func TestInitialEntryActions(t *testing.T) {
+	model, _ := fsm.Load("actions.aml", actionsModel)
+	machine := model.Get()
+	if log := machine.GetVariables().Get("log"); log != "+outer +inner " {
+		t.Errorf("entering the initial state ran %q", log)
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/runners"
+)
+
+func TestActorFromManyGoroutines(t *testing.T) {
+	model, _ := fsm.Load("counter.aml", "syntax fsm\n"+
+		"var i = 0\n"+
+		"init state A { INC -> A (i += 1) }\n")
+	machine := model.Get()
+	ctx, cancel := context.WithCancel(context.Background())
+	actor := runners.NewActor(ctx, &machine)
+	changes := actor.Subscribe(100)
+	var group sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for n := 0; n < 10; n++ {
+				if _, err := actor.Fire(ctx, "INC"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	group.Wait()
+	var i any
+	actor.Inspect(ctx, func(model runners.Runnable) {
+		i = model.(*fsm.FiniteStateMachine).GetVariables().Get("i")
+	})
+	if i != int64(100) {
+		t.Errorf("i is %v after 100 events", i)
+	}
+	cancel()
+	<-actor.Done()
+	published := 0
+	for range changes {
+		published++
+	}
+	if published != 100 {
+		t.Errorf("%d changes published for 100 events", published)
+	}
+	if _, err := actor.Fire(context.Background(), "INC"); !errors.Is(err, runners.ErrActorStopped) {
+		t.Errorf("fired at a stopped actor: %v", err)
+	}
+}
+
+func TestActorTimers(t *testing.T) {
+	model, _ := fsm.Load("timer.aml", "syntax fsm\n"+
+		"init state A { after 10ms -> B }\n"+
+		"state B { BACK -> A }\n")
+	machine := model.Get()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	actor := runners.NewActor(ctx, &machine)
+	changes := actor.Subscribe(1)
+	select {
+	case change := <-changes:
+		if !reflect.DeepEqual(change.Configuration, fsm.Configuration{"B"}) || change.Event != "" {
+			t.Errorf("unexpected change %+v", change)
+		}
+	case <-time.After(time.Second):
+		t.Error("the timer did not fall due")
+	}
+}
+
+func TestActorReportsErrors(t *testing.T) {
+	model, _ := fsm.Load("counter.aml", "syntax fsm\n"+
+		"init state A { INC -> A }\n")
+	machine := model.Get()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	actor := runners.NewActor(ctx, &machine)
+	changes := actor.Subscribe(1)
+	change, err := actor.Fire(ctx, "JUMP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(change.Err, fsm.ErrUnknownEvent) {
+		t.Errorf("expected an unknown event, got %v", change.Err)
+	}
+	if published := <-changes; !errors.Is(published.Err, fsm.ErrUnknownEvent) {
+		t.Errorf("expected subscribers to see the unknown event, got %v", published.Err)
+	}
+}
+
+func TestIdleActorPublishesNothing(t *testing.T) {
+	model, _ := fsm.Load("timer.aml", "syntax fsm\n"+
+		"var i = 0\n"+
+		"init state A { every 5ms (i > 0) -> A }\n")
+	machine := model.Get()
+	// the virtual clock does not move, its timers never fall due
+	machine.SetClock(fsm.NewVirtualClock())
+	ctx, cancel := context.WithCancel(context.Background())
+	actor := runners.NewActor(ctx, &machine)
+	changes := actor.Subscribe(100)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-actor.Done()
+	published := 0
+	for range changes {
+		published++
+	}
+	if published != 0 {
+		t.Errorf("an idle actor published %d changes", published)
+	}
+}
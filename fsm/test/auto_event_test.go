@@ -0,0 +1,82 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+const counterModel = "syntax fsm\n" +
+	"var i = 0\n" +
+	"init state COUNTING {\n" +
+	"    >> i += 1\n" +
+	"    |> i >= 3 -> FULL (i = 0)\n" +
+	"}\n" +
+	"state FULL {\n" +
+	"    |> i < 0 -x\n" +
+	"    |> -> COUNTING\n" +
+	"    DRAIN -> FULL (i -= 1)\n" +
+	"}\n"
+
+func TestAutoEvents(t *testing.T) {
+	model, diagnostics := fsm.Load("counter.aml", counterModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	steps := []struct {
+		event         string
+		mode          mode.Mode
+		configuration fsm.Configuration
+		i             int64
+	}{
+		{"TICK", mode.CONTINUE, fsm.Configuration{"COUNTING"}, 1},
+		{"TICK", mode.CONTINUE, fsm.Configuration{"COUNTING"}, 2},
+		{"TICK", mode.CONTINUE, fsm.Configuration{"FULL"}, 0},
+		// a transition reacts to the event, so the auto-events are not run
+		{"DRAIN", mode.CONTINUE, fsm.Configuration{"FULL"}, -1},
+		{"TICK", mode.TERMINATE, fsm.Configuration{"FULL"}, -1},
+	}
+	for _, step := range steps {
+		machine.Fire(step.event)
+		if machine.GetMode() != step.mode {
+			t.Errorf("mode is %v after %s, expected %v: %s", machine.GetMode(), step.event, step.mode, machine.GetCause())
+		}
+		if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, step.configuration) {
+			t.Errorf("configuration is %v after %s, expected %v", configuration, step.event, step.configuration)
+		}
+		if i := machine.GetVariables().Get("i"); i != step.i {
+			t.Errorf("i is %v after %s, expected %d", i, step.event, step.i)
+		}
+	}
+}
+
+func TestAutoEventToChoice(t *testing.T) {
+	model, diagnostics := fsm.Load("auto.aml", "syntax fsm\n"+
+		"var i = 0\n"+
+		"init state A {\n"+
+		"    |> -> CHECK (i += 1)\n"+
+		"    STAY -> A\n"+
+		"}\n"+
+		"choice CHECK {\n"+
+		"    (i > 1) -> B\n"+
+		"    else -> A\n"+
+		"}\n"+
+		"state B { STAY -> B }\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	for _, event := range []string{"STAY", "OTHER", "OTHER"} {
+		machine.Fire(event)
+	}
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"B"}) {
+		t.Errorf("configuration is %v, expected the auto-event to pass the choice to B", configuration)
+	}
+	machine.Fire("OTHER")
+	if machine.GetMode() != mode.DEADLOCK {
+		t.Errorf("an event nothing reacts to did not deadlock, mode is %v", machine.GetMode())
+	}
+}
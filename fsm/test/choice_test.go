@@ -0,0 +1,187 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+const bankModel = "syntax fsm\n" +
+	"model BANK\n" +
+	"var balance = 0\n" +
+	"event PAY(amount: int)\n" +
+	"init state OPEN {\n" +
+	"    PAY -> CHECK (balance -= amount)\n" +
+	"    DEPOSIT -> OPEN (balance += 10)\n" +
+	"}\n" +
+	"choice CHECK {\n" +
+	"    (balance < -100) -x\n" +
+	"    (balance < 0) -> OVERDRAWN\n" +
+	"    else -> OPEN\n" +
+	"}\n" +
+	"state OVERDRAWN {\n" +
+	"    entry { balance -= 1 }\n" +
+	"    DEPOSIT -> CHECK (balance += 10)\n" +
+	"}\n"
+
+func TestChoice(t *testing.T) {
+	model, diagnostics := fsm.Load("bank.aml", bankModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	steps := []struct {
+		event         string
+		arguments     map[string]any
+		configuration fsm.Configuration
+		balance       int64
+	}{
+		{"DEPOSIT", nil, fsm.Configuration{"OPEN"}, 10},
+		{"PAY", map[string]any{"amount": 5}, fsm.Configuration{"OPEN"}, 5},
+		{"PAY", map[string]any{"amount": 10}, fsm.Configuration{"OVERDRAWN"}, -6},
+		{"DEPOSIT", nil, fsm.Configuration{"OPEN"}, 4},
+	}
+	for _, step := range steps {
+		machine.FireWith(step.event, step.arguments)
+		if machine.GetMode() != mode.CONTINUE {
+			t.Fatalf("%s stopped the model: %s", step.event, machine.GetCause())
+		}
+		if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, step.configuration) {
+			t.Errorf("configuration is %v after %s, expected %v", configuration, step.event, step.configuration)
+		}
+		if balance := machine.GetVariables().Get("balance"); balance != step.balance {
+			t.Errorf("balance is %v after %s, expected %d", balance, step.event, step.balance)
+		}
+	}
+	machine.FireWith("PAY", map[string]any{"amount": 500})
+	if machine.GetMode() != mode.TERMINATE {
+		t.Errorf("the terminating branch was not taken, mode is %v", machine.GetMode())
+	}
+}
+
+func TestChoiceBuilder(t *testing.T) {
+	guard, _ := fsm.ParseExpression("i > 1")
+	builder := fsm.NewFsmBuilder()
+	machine, err := builder.
+		DeclareVar("i", 0).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("BRANCH").Run(func(v *fsm.Variables) {
+					v.Set("i", v.Get("i").(int)+1)
+				})
+			})
+		}).
+		Choice("BRANCH", func(cb *fsm.ChoiceBuilder) {
+			cb.When(func(eb *fsm.EdgeBuilder) {
+				eb.Then("B").And2(&fsm.Conditionals{Conditions: []fsm.Condition{{Expression: guard}}})
+			})
+			cb.Else(func(eb *fsm.EdgeBuilder) {
+				eb.Then("A")
+			})
+		}).
+		Given("B", func(sb *fsm.StateBuilder) {}).
+		Initial("A").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.Fire("GO")
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"A"}) {
+		t.Errorf("configuration is %v after the first GO", configuration)
+	}
+	machine.Fire("GO")
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"B"}) {
+		t.Errorf("configuration is %v after the second GO", configuration)
+	}
+}
+
+func TestChoiceDiagnostics(t *testing.T) {
+	_, diagnostics := fsm.Load("bad.aml", "syntax fsm\n"+
+		"var i = 0\n"+
+		"init state A {\n"+
+		"    GO -> FIRST\n"+
+		"    choice INNER { else -> A }\n"+
+		"}\n"+
+		"choice FIRST {\n"+
+		"    (i > 0) -> SECOND\n"+
+		"    else -> A\n"+
+		"}\n"+
+		"choice SECOND {\n"+
+		"    (i > 1) -> A\n"+
+		"    else -> FIRST\n"+
+		"}\n"+
+		"choice NO_ELSE {\n"+
+		"    (i > 0) -> A\n"+
+		"}\n"+
+		"choice A { else -> A }\n")
+	if len(diagnostics.WithCode(fsm.CODE_MISSING_ELSE)) != 1 {
+		t.Errorf("missing else not reported: %v", diagnostics)
+	}
+	if unexpected := diagnostics.WithCode(fsm.CODE_UNEXPECTED_TOKEN); len(unexpected) != 1 || unexpected[0].Span.Start.Line != 5 {
+		t.Errorf("choice within a state not reported: %v", diagnostics)
+	}
+	if len(diagnostics.WithCode(fsm.CODE_CHOICE_CYCLE)) != 2 {
+		t.Errorf("choices leading back to themselves not reported: %v", diagnostics)
+	}
+	if duplicates := diagnostics.WithCode(fsm.CODE_DUPLICATE_STATE); len(duplicates) != 1 || duplicates[0].Span.Start.Line != 18 {
+		t.Errorf("choice named as a state not reported: %v", diagnostics)
+	}
+}
+
+func TestChoiceBranchesWithoutUpdates(t *testing.T) {
+	model, diagnostics := fsm.Load("branches.aml", "syntax fsm\n"+
+		"var i = 2\n"+
+		"init state S { GO -> C }\n"+
+		"choice C {\n"+
+		"    (i > 1) -> A\n"+
+		"    (i > 0) -> B\n"+
+		"    else -> A\n"+
+		"}\n"+
+		"state A { GO -> C (i -= 1) }\n"+
+		"state B { GO -> C (i -= 1) }\n")
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	for _, expected := range []fsm.Configuration{{"A"}, {"B"}, {"A"}} {
+		machine.Fire("GO")
+		if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, expected) {
+			t.Fatalf("expected %v, got %v", expected, configuration)
+		}
+	}
+}
+
+func TestChoiceInRegion(t *testing.T) {
+	model, diagnostics := fsm.Load("regions.aml", "syntax fsm\n"+
+		"var n = 0\n"+
+		"var entered = 0\n"+
+		"init parallel ACTIVE {\n"+
+		"    entry { entered += 1 }\n"+
+		"    state A {\n"+
+		"        init state A1 { GO -> CHECK (n += 1) }\n"+
+		"        state A2 { GO -> A1 }\n"+
+		"    }\n"+
+		"    state B {\n"+
+		"        init state B1 { NEXT -> B2 }\n"+
+		"        state B2 { NEXT -> B1 }\n"+
+		"    }\n"+
+		"}\n"+
+		"choice CHECK {\n"+
+		"    (n > 0) -> A2\n"+
+		"    else -> A1\n"+
+		"}\n")
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	machine.Fire("NEXT")
+	machine.Fire("GO")
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"A2", "B2"}) {
+		t.Errorf("the choice reset the other region, the configuration is %v", configuration)
+	}
+	if entered := machine.GetVariables().Get("entered"); entered != int64(1) {
+		t.Errorf("the choice left the parallel state, it was entered %v times", entered)
+	}
+}
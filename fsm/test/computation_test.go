@@ -0,0 +1,67 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+const computationModel = "syntax fsm\n" +
+	"var price = 2.5\n" +
+	"var qty = 4\n" +
+	"var tax = 1\n" +
+	"var total = 0.0\n" +
+	"var i = 1\n" +
+	"var j = 7\n" +
+	"var s = \"a\"\n" +
+	"init state A {\n" +
+	"    BUY -> B (total = price * qty + tax, i = j, s = s + \"b\", j /= 2)\n" +
+	"}\n" +
+	"state B {\n" +
+	"    BUY -> A (total -= qty, s += s)\n" +
+	"}\n"
+
+func TestComputationExpressions(t *testing.T) {
+	model, diagnostics := fsm.Load("computation.aml", computationModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	machine.Fire("BUY")
+	vars := machine.GetVariables()
+	if total := vars.Get("total"); total != 11.0 {
+		t.Errorf("total is %v, expected 11", total)
+	}
+	if i := vars.Get("i"); i != int64(7) {
+		t.Errorf("i is %v, expected 7", i)
+	}
+	if j := vars.Get("j"); j != int64(3) {
+		t.Errorf("j is %v, expected 3", j)
+	}
+	machine.Fire("BUY")
+	if total := vars.Get("total"); total != 7.0 {
+		t.Errorf("total is %v, expected 7", total)
+	}
+	if s := vars.Get("s"); s != "abab" {
+		t.Errorf("s is %v, expected abab", s)
+	}
+
+	edge := machine.GetCurrentState().Get().GetTransitions()["BUY"][0]
+	expected := "func() { total = price * float64(qty) + float64(tax); i = j; s = s + \"b\"; j /= 2 }"
+	if generated := edge.GetComputations().Generate(); generated != expected {
+		t.Errorf("generated %s", generated)
+	}
+}
+
+func TestComputationTypeMismatch(t *testing.T) {
+	_, diagnostics := fsm.Load("mismatch.aml", "syntax fsm\n"+
+		"var b = true\n"+
+		"var i = 1\n"+
+		"var s = \"a\"\n"+
+		"init state A {\n"+
+		"    E -> A (b += 1, i = 0.5, s -= \"a\", i = i * 2)\n"+
+		"}\n")
+	if mismatches := diagnostics.WithCode(fsm.CODE_TYPE_MISMATCH); len(mismatches) != 3 {
+		t.Errorf("expected 3 type mismatches, got %v", diagnostics)
+	}
+}
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+func TestInstancesAreIndependent(t *testing.T) {
+	definition, diagnostics := fsm.LoadDefinition("lights.aml", lightsModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	first := definition.Get().NewInstance()
+	second := definition.Get().NewInstance()
+	first.Fire("SWITCH")
+	if n := first.GetVariables().Get("n"); n != int64(1) {
+		t.Fatalf("expected n = 1 in the first instance, got %v", n)
+	}
+	if n := second.GetVariables().Get("n"); n != int64(0) {
+		t.Fatalf("expected n = 0 in the second instance, got %v", n)
+	}
+	if !reflect.DeepEqual(first.GetConfiguration(), fsm.Configuration{"ON"}) || !reflect.DeepEqual(second.GetConfiguration(), fsm.Configuration{"OFF"}) {
+		t.Fatalf("unexpected configurations: %v and %v", first.GetConfiguration(), second.GetConfiguration())
+	}
+	if first.GetHash() != definition.Get().GetHash() {
+		t.Fatal("expected the instance to have the hash of its definition")
+	}
+}
+
+func TestReset(t *testing.T) {
+	model, _ := fsm.Load("lights.aml", lightsModel)
+	machine := model.Get()
+	machine.Fire("SWITCH")
+	machine.Fire("UNKNOWN")
+	if machine.GetMode() != mode.DEADLOCK {
+		t.Fatalf("expected a deadlock, got %v", machine.GetMode())
+	}
+	machine.Reset()
+	if machine.GetMode() != mode.CONTINUE || machine.GetCause() != "" {
+		t.Fatalf("expected the mode to be reset, got %v (%s)", machine.GetMode(), machine.GetCause())
+	}
+	if !reflect.DeepEqual(machine.GetConfiguration(), fsm.Configuration{"OFF"}) {
+		t.Fatalf("expected to be back in OFF, got %v", machine.GetConfiguration())
+	}
+	if n, c := machine.GetVariables().Get("n"), machine.GetVariables().Get("c"); n != int64(0) || c != "RED" {
+		t.Fatalf("expected the declared values, got n = %v and c = %v", n, c)
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+func TestEnums(t *testing.T) {
+	model, diagnostics := fsm.Load("enum.aml", "syntax fsm\n"+
+		"model LIGHTS\n"+
+		"enum Color { RED, GREEN, BLUE }\n"+
+		"var c: Color = RED\n"+
+		"var d = BLUE\n"+
+		"init state A {\n"+
+		"    GO (c == RED, d != c) -> B (c = GREEN)\n"+
+		"}\n"+
+		"state B { BACK (GREEN == c) -> A (c = d) }\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	variables := machine.GetVariables()
+	if variables.GetType("d") != fsm.ENUM || variables.GetEnumType("d") != "Color" {
+		t.Errorf("d is not inferred as a Color")
+	}
+	machine.Fire("GO")
+	if variables.Get("c") != "GREEN" {
+		t.Errorf("c is %v, expected GREEN", variables.Get("c"))
+	}
+	machine.Fire("BACK")
+	if variables.Get("c") != "BLUE" || machine.GetCurrentState().Get().GetName() != "A" {
+		t.Errorf("c is %v, expected BLUE", variables.Get("c"))
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	_, diagnostics := fsm.Load("enum.aml", "syntax fsm\n"+
+		"model LIGHTS\n"+
+		"enum Color { RED, GREEN }\n"+
+		"enum Size { SMALL, RED }\n"+
+		"var c: Color = PURPLE\n"+
+		"var d: Color = GREEN\n"+
+		"var s: Size = SMALL\n"+
+		"init state A {\n"+
+		"    GO (d == GREN) -> A\n"+
+		"    STOP (d > GREEN) -> A (d = SMALL)\n"+
+		"    RUN (d == s) -> A (d += GREEN)\n"+
+		"}\n")
+	if duplicates := diagnostics.WithCode(fsm.CODE_DUPLICATE_ENUM); len(duplicates) != 1 || duplicates[0].Span.Start.Line != 4 {
+		t.Errorf("member declared in two enums not reported: %v", diagnostics)
+	}
+	if unknown := diagnostics.WithCode(fsm.CODE_UNKNOWN_MEMBER); len(unknown) != 3 || unknown[0].Span.Start.Line != 5 || unknown[1].Span.Start.Line != 9 || unknown[2].Span.Start.Line != 10 {
+		t.Errorf("unknown members not reported: %v", diagnostics)
+	}
+	if mismatches := diagnostics.WithCode(fsm.CODE_TYPE_MISMATCH); len(mismatches) != 3 {
+		t.Errorf("expected 3 type mismatches, got %v", diagnostics)
+	}
+}
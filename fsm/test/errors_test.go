@@ -0,0 +1,67 @@
+package test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+func TestFireErrors(t *testing.T) {
+	model, _ := fsm.Load("guarded.aml", guardedModel)
+	machine := model.Get()
+	err := machine.Fire("JUMP")
+	if !errors.Is(err, fsm.ErrUnknownEvent) || machine.GetMode() != mode.DEADLOCK {
+		t.Fatalf("expected an unknown event and a deadlock, got %v in %v", err, machine.GetMode())
+	}
+	err = machine.Fire("STOP")
+	var noTransition *fsm.NoEnabledTransitionError
+	if !errors.Is(err, fsm.ErrNoEnabledTransition) || !errors.As(err, &noTransition) {
+		t.Fatalf("expected no enabled transition, got %v", err)
+	}
+	if expected := []fsm.FailedGuard{{State: "A", Guard: "i > 5"}}; !reflect.DeepEqual(noTransition.Guards, expected) {
+		t.Fatalf("expected the failed guards %v, got %v", expected, noTransition.Guards)
+	}
+	if err = machine.Fire("GO"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	machine.Fire("GO")
+	machine.Fire("GO")
+	if err = machine.Fire("STOP"); err != nil || machine.GetMode() != mode.TERMINATE {
+		t.Fatalf("expected to terminate, got %v in %v", err, machine.GetMode())
+	}
+	if err = machine.Fire("GO"); !errors.Is(err, fsm.ErrTerminated) {
+		t.Fatalf("expected the model to have terminated, got %v", err)
+	}
+}
+
+func TestUnknownTargetState(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	machine, _ := builder.
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("NOWHERE")
+			})
+		}).
+		Initial("A").
+		Build()
+	err := machine.Fire("GO")
+	var unknown *fsm.UnknownTargetStateError
+	if !errors.Is(err, fsm.ErrUnknownTargetState) || !errors.As(err, &unknown) || machine.GetMode() != mode.CRASH {
+		t.Fatalf("expected an unknown target state and a crash, got %v in %v", err, machine.GetMode())
+	}
+	if unknown.Source != "A" || unknown.Target != "NOWHERE" {
+		t.Fatalf("unexpected error: %+v", unknown)
+	}
+}
+
+func TestNoEnabledTransitionMessage(t *testing.T) {
+	model, _ := fsm.Load("guarded.aml", guardedModel)
+	machine := model.Get()
+	err := machine.Fire("STOP")
+	if expected := `no enabled transition for event "STOP" in A, the guards failed: [A] i > 5`; err == nil || err.Error() != expected {
+		t.Errorf("expected the message %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+const shopModel = "syntax fsm\n" +
+	"model SHOP\n" +
+	"var balance: float = 0\n" +
+	"var note = \"\"\n" +
+	"event PAYMENT(amount: float, memo: string)\n" +
+	"event REFUND(amount: float)\n" +
+	"init state OPEN {\n" +
+	"    PAYMENT -> PAID (balance += amount, note = memo)\n" +
+	"}\n" +
+	"state PAID {\n" +
+	"    REFUND -> OPEN (balance -= amount)\n" +
+	"}\n"
+
+func TestFireWithArguments(t *testing.T) {
+	model, diagnostics := fsm.Load("shop.aml", shopModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	if parameters := machine.GetParameters("PAYMENT"); len(parameters) != 2 || parameters[1].Name != "memo" {
+		t.Errorf("parameters of PAYMENT are %v", parameters)
+	}
+	machine.FireWith("PAYMENT", map[string]any{"amount": 12.5, "memo": "thanks"})
+	if balance := machine.GetVariables().Get("balance"); balance != 12.5 {
+		t.Errorf("balance is %v, expected 12.5", balance)
+	}
+	if note := machine.GetVariables().Get("note"); note != "thanks" {
+		t.Errorf("note is %v, expected thanks", note)
+	}
+	if machine.GetVariables().Get("amount") != nil {
+		t.Errorf("the parameter outlived the event")
+	}
+	// a missing argument is the zero value of its type
+	machine.Fire("REFUND")
+	if balance := machine.GetVariables().Get("balance"); balance != 12.5 {
+		t.Errorf("balance is %v after refunding nothing", balance)
+	}
+	machine.FireWith("PAYMENT", map[string]any{"price": 1})
+	if machine.GetMode() != mode.CRASH {
+		t.Errorf("an unknown argument is accepted, mode is %v", machine.GetMode())
+	}
+}
+
+func TestEventDiagnostics(t *testing.T) {
+	_, diagnostics := fsm.Load("shop.aml", "syntax fsm\n"+
+		"var amount = 0\n"+
+		"event PAYMENT(amount: float)\n"+
+		"event PAYMENT\n"+
+		"event REFUND(total: money)\n"+
+		"event TIP(tip: int)\n"+
+		"event BONUS(tip: float)\n"+
+		"init state OPEN { TIP -> OPEN (amount += tip) }\n")
+	if len(diagnostics.WithCode(fsm.CODE_DUPLICATE_EVENT)) != 1 {
+		t.Errorf("duplicate event not reported: %v", diagnostics)
+	}
+	if len(diagnostics.WithCode(fsm.CODE_UNKNOWN_TYPE)) != 1 {
+		t.Errorf("unknown parameter type not reported: %v", diagnostics)
+	}
+	if len(diagnostics.WithCode(fsm.CODE_DUPLICATE_VARIABLE)) != 1 {
+		t.Errorf("parameter shadowing a variable not reported: %v", diagnostics)
+	}
+	if mismatches := diagnostics.WithCode(fsm.CODE_TYPE_MISMATCH); len(mismatches) != 1 || mismatches[0].Span.Start.Line != 7 {
+		t.Errorf("parameter declared with another type not reported: %v", diagnostics)
+	}
+	_, diagnostics = fsm.Load("shop.aml", "syntax fsm\n"+
+		"var count = 0\n"+
+		"event ADD(by: int)\n"+
+		"init state A {\n"+
+		"    ADD -> A (count += by)\n"+
+		"    GO -> A (count += by)\n"+
+		"}\n")
+	if unknown := diagnostics.WithCode(fsm.CODE_UNDECLARED_VARIABLE); len(unknown) != 1 || unknown[0].Span.Start.Line != 6 {
+		t.Errorf("parameter used outside of its event not reported: %v", diagnostics)
+	}
+}
+
+func TestParameterNamedLikeVariable(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	machine, _ := builder.
+		DeclareVar("amount", 5).
+		DeclareEvent("PAY", fsm.Parameter{Name: "amount", Type: fsm.INT}).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("PAY", func(eb *fsm.EdgeBuilder) { eb.Then("A") })
+		}).
+		Initial("A").
+		Build()
+	machine.FireWith("PAY", map[string]any{"amount": 1})
+	if machine.GetMode() != mode.CRASH {
+		t.Errorf("expected the event to crash the model, mode is %v", machine.GetMode())
+	}
+	if amount := machine.GetVariables().Get("amount"); amount != 5 {
+		t.Errorf("expected the variable to keep its value 5, got %v", amount)
+	}
+}
+
+func TestBadArgumentUnbindsParameters(t *testing.T) {
+	model, _ := fsm.Load("shop.aml", shopModel)
+	machine := model.Get()
+	err := machine.FireWith("PAYMENT", map[string]any{"amount": 12.5, "memo": 42})
+	if err == nil || machine.GetMode() != mode.CRASH {
+		t.Fatalf("expected the bad argument to crash the model, got %v in %v", err, machine.GetMode())
+	}
+	if amount := machine.GetVariables().Get("amount"); amount != nil {
+		t.Errorf("the parameter bound before the bad argument outlived the event, amount is %v", amount)
+	}
+}
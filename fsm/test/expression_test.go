@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+func expressionVariables() fsm.Variables {
+	vars := fsm.NewVariables()
+	vars.Set("i", int64(2))
+	vars.SetType("i", fsm.INT)
+	vars.Set("j", int64(3))
+	vars.SetType("j", fsm.INT)
+	vars.Set("f", 0.5)
+	vars.SetType("f", fsm.FLOAT)
+	vars.Set("b", false)
+	vars.SetType("b", fsm.BOOL)
+	vars.Set("s", "on")
+	vars.SetType("s", fsm.STRING)
+	return vars
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	vars := expressionVariables()
+	tests := map[string]bool{
+		"(i + j) * 2 > 9":          true,
+		"(i + j) * 2 > 10":         false,
+		"i < j && !b":              true,
+		"b || s == \"off\"":        false,
+		"!(b || s == \"off\")":     true,
+		"i + f == 2.5":             true,
+		"j / i == 1 && j % i == 1": true,
+		"-i < 0 || b":              true,
+		"s + \"!\" != \"on!\"":     false,
+	}
+	for source, expected := range tests {
+		expr, diagnostics := fsm.ParseExpression(source)
+		if len(diagnostics) != 0 {
+			t.Errorf("%s: unexpected diagnostics %v", source, diagnostics)
+			continue
+		}
+		result, err := vars.EvaluateBool(expr)
+		if err != nil {
+			t.Errorf("%s: %s", source, err.Error())
+			continue
+		}
+		if result != expected {
+			t.Errorf("%s evaluated to %t", source, result)
+		}
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	vars := expressionVariables()
+	for _, source := range []string{"i / 0 == 1", "b > true", "s", "unknown == 1", "s - \"a\" == \"\""} {
+		expr, diagnostics := fsm.ParseExpression(source)
+		if len(diagnostics) != 0 {
+			t.Errorf("%s: unexpected diagnostics %v", source, diagnostics)
+			continue
+		}
+		if _, err := vars.EvaluateBool(expr); err == nil {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
+
+func TestGenerateExpression(t *testing.T) {
+	model := fsm.FromString("syntax fsm\n" +
+		"var i = 1\n" +
+		"var f = 0.5\n" +
+		"var b = true\n" +
+		"init state A {\n" +
+		"    E (i * 2 > f || !b, (i - (i - 1)) == 1) -> A\n" +
+		"}\n")
+	if model.IsNone() {
+		t.Fatal("model not built")
+	}
+	machine := model.Get()
+	edge := machine.GetCurrentState().Get().GetTransitions()["E"][0]
+	expected := "func() bool { return (float64(i * 2) > f || !b) && i - (i - 1) == 1 }"
+	if generated := edge.GetConditions().Generate(); generated != expected {
+		t.Errorf("generated %s", generated)
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+const nestedModel = "syntax fsm\n" +
+	"model PLAYER\n" +
+	"init state ON {\n" +
+	"    OFF -> OFF_STATE\n" +
+	"    init state STOPPED { PLAY -> PLAYING }\n" +
+	"    state PLAYING {\n" +
+	"        PAUSE -> PAUSED\n" +
+	"        init state NORMAL { FAST -> FASTER }\n" +
+	"        state FASTER { FAST -> NORMAL }\n" +
+	"    }\n" +
+	"    state PAUSED {\n" +
+	"        PLAY -> PLAYING\n" +
+	"        OFF -> STOPPED\n" +
+	"    }\n" +
+	"}\n" +
+	"state OFF_STATE { ON -> ON }\n"
+
+func TestNestedStates(t *testing.T) {
+	model, diagnostics := fsm.Load("nested.aml", nestedModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	steps := []struct {
+		event  string
+		active []string
+	}{
+		{"", []string{"ON", "STOPPED"}},
+		{"PLAY", []string{"ON", "PLAYING", "NORMAL"}},
+		{"FAST", []string{"ON", "PLAYING", "FASTER"}},
+		{"PAUSE", []string{"ON", "PAUSED"}}, // from the parent PLAYING
+		{"OFF", []string{"ON", "STOPPED"}},  // PAUSED overrides ON
+		{"OFF", []string{"OFF_STATE"}},      // from the parent ON
+		{"ON", []string{"ON", "STOPPED"}},   // enters the initial substate
+		{"FAST", []string{"ON", "STOPPED"}}, // no transition
+	}
+	for _, step := range steps {
+		if len(step.event) > 0 {
+			machine.Fire(step.event)
+		}
+		if active := machine.GetActiveStates(); !reflect.DeepEqual(active, step.active) {
+			t.Errorf("after %s active states are %v, expected %v", step.event, active, step.active)
+		}
+	}
+	if !machine.IsIn("ON") || machine.IsIn("PLAYING") {
+		t.Error("IsIn does not follow the active states")
+	}
+}
+
+func TestNestedStatesBuilder(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	builder.
+		Given("PARENT", func(sb *fsm.StateBuilder) {
+			sb.When("RESET", func(eb *fsm.EdgeBuilder) { eb.Then("PARENT") })
+			sb.Given("FIRST", func(sb *fsm.StateBuilder) {
+				sb.When("NEXT", func(eb *fsm.EdgeBuilder) { eb.Then("SECOND") })
+			})
+			sb.Given("SECOND", func(sb *fsm.StateBuilder) {})
+		}).
+		Initial("PARENT")
+	machine, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.Fire("NEXT")
+	if machine.GetCurrentState().Get().GetName() != "SECOND" {
+		t.Fatalf("expected SECOND, got %s", machine.GetCurrentState().Get().GetName())
+	}
+	if parent := machine.GetCurrentState().Get().GetParent(); parent.IsNone() || parent.Get() != "PARENT" {
+		t.Error("parent of SECOND is not PARENT")
+	}
+	machine.Fire("RESET")
+	if machine.GetCurrentState().Get().GetName() != "FIRST" {
+		t.Errorf("expected the default initial substate FIRST, got %s", machine.GetCurrentState().Get().GetName())
+	}
+}
+
+func TestNestedStatesMissingInitial(t *testing.T) {
+	_, diagnostics := fsm.Load("nested.aml", "syntax fsm\n"+
+		"init state A {\n"+
+		"    state B { GO -> C }\n"+
+		"    state C { GO -> B }\n"+
+		"}\n")
+	if missing := diagnostics.WithCode(fsm.CODE_MISSING_INITIAL); len(missing) != 1 || missing[0].Span.Start.Line != 2 {
+		t.Errorf("missing initial substate not reported: %v", diagnostics)
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+var includeFiles = fstest.MapFS{
+	"models/main.aml": {Data: []byte("syntax fsm\n" +
+		"model MAIN\n" +
+		"include \"common/states.aml\"\n" +
+		"import \"common/vars.aml\"\n" +
+		"init state IDLE { FAIL -> ERROR }\n")},
+	"models/common/states.aml": {Data: []byte("syntax fsm\n" +
+		"import \"vars.aml\"\n" +
+		"state ERROR { RESET -> IDLE (errors += 1) }\n")},
+	"models/common/vars.aml": {Data: []byte("syntax fsm\n" +
+		"var errors: int = 0\n")},
+	"models/twice.aml": {Data: []byte("syntax fsm\n" +
+		"include \"common/vars.aml\"\n" +
+		"include \"common/vars.aml\"\n" +
+		"init state A { GO -> A (errors += \"x\") }\n")},
+	"models/cycle.aml": {Data: []byte("syntax fsm\n" +
+		"include \"loop.aml\"\n" +
+		"init state A { GO -> A }\n")},
+	"models/loop.aml": {Data: []byte("syntax fsm\n" +
+		"include \"cycle.aml\"\n")},
+	"models/system.aml": {Data: []byte("syntax fsm\n" +
+		"model MAIN {\n" +
+		"    import \"main.aml\"\n" +
+		"}\n" +
+		"model OTHER {\n" +
+		"    import \"common/vars.aml\"\n" +
+		"    init state B { GO -> B (errors += 1, send MAIN.FAIL) }\n" +
+		"}\n")},
+}
+
+func TestInclude(t *testing.T) {
+	model, diagnostics := fsm.LoadFS(includeFiles, "models/main.aml")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	machine.Fire("FAIL")
+	machine.Fire("RESET")
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"IDLE"}) {
+		t.Errorf("configuration is %v", configuration)
+	}
+	if errors := machine.GetVariables().Get("errors"); errors != int64(1) {
+		t.Errorf("errors is %v, expected 1", errors)
+	}
+}
+
+func TestIncludeDiagnostics(t *testing.T) {
+	_, diagnostics := fsm.LoadFS(includeFiles, "models/twice.aml")
+	if duplicates := diagnostics.WithCode(fsm.CODE_DUPLICATE_VARIABLE); len(duplicates) != 1 || duplicates[0].File != "models/common/vars.aml" {
+		t.Errorf("the second include is not reported in the included file: %v", diagnostics)
+	}
+	if mismatches := diagnostics.WithCode(fsm.CODE_TYPE_MISMATCH); len(mismatches) != 1 || mismatches[0].File != "models/twice.aml" {
+		t.Errorf("the mismatch is not reported in the including file: %v", diagnostics)
+	}
+	_, diagnostics = fsm.LoadFS(includeFiles, "models/cycle.aml")
+	if cycles := diagnostics.WithCode(fsm.CODE_INCLUDE_CYCLE); len(cycles) != 1 || cycles[0].File != "models/loop.aml" {
+		t.Errorf("cycle not reported: %v", diagnostics)
+	}
+	_, diagnostics = fsm.LoadFS(includeFiles, "models/missing.aml")
+	if len(diagnostics.WithCode(fsm.CODE_INCLUDE_NOT_FOUND)) != 1 {
+		t.Errorf("missing file not reported: %v", diagnostics)
+	}
+	_, diagnostics = fsm.Load("main.aml", "syntax fsm\ninclude \"common/states.aml\"\ninit state A { GO -> A }\n")
+	if len(diagnostics.WithCode(fsm.CODE_INCLUDE_NOT_FOUND)) != 1 {
+		t.Errorf("include without a file system not reported: %v", diagnostics)
+	}
+}
+
+func TestImportIntoSystem(t *testing.T) {
+	system, diagnostics := fsm.LoadSystemFS(includeFiles, "models/system.aml")
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	composed := system.Get()
+	composed.Fire("OTHER.GO")
+	if configuration := composed.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"MAIN.ERROR", "OTHER.B"}) {
+		t.Errorf("configuration is %v", configuration)
+	}
+}
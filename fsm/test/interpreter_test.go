@@ -0,0 +1,72 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+const guardedModel = "syntax fsm\n" +
+	"var i = 0\n" +
+	"init state A {\n" +
+	"    GO (i < 2) -> A (i += 1)\n" +
+	"    GO -> B\n" +
+	"    STOP (i > 5) -x\n" +
+	"}\n" +
+	"state B { STOP -x }\n"
+
+func TestGuardsAreEvaluated(t *testing.T) {
+	model, diagnostics := fsm.Load("guarded.aml", guardedModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	steps := []struct {
+		event         string
+		mode          mode.Mode
+		configuration fsm.Configuration
+		i             int64
+	}{
+		{"GO", mode.CONTINUE, fsm.Configuration{"A"}, 1},
+		{"GO", mode.CONTINUE, fsm.Configuration{"A"}, 2},
+		// the guard of the terminating edge does not hold
+		{"STOP", mode.DEADLOCK, fsm.Configuration{"A"}, 2},
+		{"GO", mode.CONTINUE, fsm.Configuration{"B"}, 2},
+		{"STOP", mode.TERMINATE, fsm.Configuration{"B"}, 2},
+	}
+	for _, step := range steps {
+		machine.Fire(step.event)
+		if machine.GetMode() != step.mode {
+			t.Errorf("mode is %v after %s, expected %v", machine.GetMode(), step.event, step.mode)
+		}
+		if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, step.configuration) {
+			t.Errorf("configuration is %v after %s, expected %v", configuration, step.event, step.configuration)
+		}
+		if i := machine.GetVariables().Get("i"); i != step.i {
+			t.Errorf("i is %v after %s, expected %d", i, step.event, step.i)
+		}
+	}
+}
+
+func TestGuardErrorCrashes(t *testing.T) {
+	guard, _ := fsm.ParseExpression("i / 0 > 1")
+	builder := fsm.NewFsmBuilder()
+	machine, err := builder.
+		DeclareVar("i", 1).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A").And2(&fsm.Conditionals{Conditions: []fsm.Condition{{Expression: guard}}})
+			})
+		}).
+		Initial("A").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.Fire("GO")
+	if machine.GetMode() != mode.CRASH {
+		t.Errorf("a guard that cannot be evaluated did not crash the model, mode is %v", machine.GetMode())
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+func TestObservers(t *testing.T) {
+	model, _ := fsm.Load("guarded.aml", guardedModel)
+	machine := model.Get()
+	observed := []string{}
+	record := func(observation fsm.Observation) {
+		source := observation.Source.GetOrElse(nil)
+		name := ""
+		if source != nil {
+			name = source.GetName()
+		}
+		entry := fmt.Sprintf("%d %s %s", observation.Hook, name, observation.Event)
+		switch observation.Hook {
+		case fsm.GUARD_EVALUATED:
+			entry += fmt.Sprintf(" %t", observation.Holds)
+		case fsm.VARIABLE_CHANGED:
+			entry += fmt.Sprintf(" %s %v->%v", observation.Variable, observation.Before.Get(observation.Variable), observation.After.Get(observation.Variable))
+		case fsm.DEADLOCKED, fsm.CRASHED:
+			entry += " " + observation.Cause
+		}
+		observed = append(observed, entry)
+	}
+	for _, hook := range []fsm.Hook{fsm.BEFORE_TRANSITION, fsm.AFTER_TRANSITION, fsm.GUARD_EVALUATED, fsm.VARIABLE_CHANGED, fsm.DEADLOCKED, fsm.CRASHED, fsm.TERMINATED} {
+		machine.Observe(hook, record)
+	}
+	machine.Fire("GO")
+	machine.Fire("GO")
+	machine.Fire("STOP")
+	machine.Fire("GO")
+	machine.Fire("STOP")
+	expected := []string{
+		"2 A GO true", "0 A GO", "1 A GO", "3 A GO i 0->1",
+		"2 A GO true", "0 A GO", "1 A GO", "3 A GO i 1->2",
+		"2 A STOP false", "4  STOP no enabled transition for event \"STOP\" in A, the guards failed: [A] i > 5",
+		"2 A GO false", "0 A GO", "1 A GO",
+		"0 B STOP", "6 B STOP",
+	}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Errorf("observed\n%v\nexpected\n%v", observed, expected)
+	}
+}
+
+func TestObserveCrash(t *testing.T) {
+	guard, _ := fsm.ParseExpression("i / 0 > 1")
+	builder := fsm.NewFsmBuilder()
+	machine, err := builder.
+		DeclareVar("i", 1).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A").And2(&fsm.Conditionals{Conditions: []fsm.Condition{{Expression: guard}}})
+			})
+		}).
+		Initial("A").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashes := []fsm.Observation{}
+	machine.Observe(fsm.CRASHED, func(observation fsm.Observation) {
+		crashes = append(crashes, observation)
+	})
+	machine.Fire("GO")
+	if len(crashes) != 1 || crashes[0].Event != "GO" || len(crashes[0].Cause) == 0 || crashes[0].After.Get("i") != 1 {
+		t.Errorf("the crash was not observed: %+v", crashes)
+	}
+}
+
+func TestObserveAutoComputation(t *testing.T) {
+	model, _ := fsm.Load("counter.aml", counterModel)
+	machine := model.Get()
+	observed := []string{}
+	machine.Observe(fsm.VARIABLE_CHANGED, func(observation fsm.Observation) {
+		observed = append(observed, fmt.Sprintf("%s %s %v->%v", observation.Source.Get().GetName(), observation.Variable,
+			observation.Before.Get(observation.Variable), observation.After.Get(observation.Variable)))
+	})
+	machine.Fire("TICK")
+	if expected := []string{"COUNTING i 0->1"}; !reflect.DeepEqual(observed, expected) {
+		t.Errorf("observed %v, expected %v", observed, expected)
+	}
+}
+
+func TestUnobserve(t *testing.T) {
+	model, _ := fsm.Load("guarded.aml", guardedModel)
+	machine := model.Get()
+	told := 0
+	unobserve := machine.Observe(fsm.AFTER_TRANSITION, func(observation fsm.Observation) {
+		told++
+	})
+	machine.Fire("GO")
+	unobserve()
+	machine.Fire("GO")
+	if told != 1 {
+		t.Errorf("expected the observer to be told once, it was told %d times", told)
+	}
+}
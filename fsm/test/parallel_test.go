@@ -0,0 +1,113 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/runners"
+)
+
+const parallelModel = "syntax fsm\n" +
+	"model KEYBOARD\n" +
+	"var typed = 0\n" +
+	"init parallel ACTIVE {\n" +
+	"    UNPLUG -> OFF\n" +
+	"    state CAPS {\n" +
+	"        init state CAPS_OFF { CAPS_LOCK -> CAPS_ON }\n" +
+	"        state CAPS_ON {\n" +
+	"            CAPS_LOCK -> CAPS_OFF\n" +
+	"            RESET -> CAPS_OFF\n" +
+	"        }\n" +
+	"    }\n" +
+	"    state NUM {\n" +
+	"        init state NUM_OFF { NUM_LOCK -> NUM_ON }\n" +
+	"        state NUM_ON {\n" +
+	"            NUM_LOCK -> NUM_OFF\n" +
+	"            RESET -> NUM_OFF (typed = 0)\n" +
+	"            KEY -> NUM_ON (typed += 1)\n" +
+	"            JUMP -> CAPS_ON\n" +
+	"        }\n" +
+	"    }\n" +
+	"}\n" +
+	"state OFF { PLUG -> NUM_ON }\n"
+
+func TestParallelRegions(t *testing.T) {
+	model, diagnostics := fsm.Load("parallel.aml", parallelModel)
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	steps := []struct {
+		event         string
+		configuration fsm.Configuration
+	}{
+		{"", fsm.Configuration{"CAPS_OFF", "NUM_OFF"}},
+		{"CAPS_LOCK", fsm.Configuration{"CAPS_ON", "NUM_OFF"}},
+		{"NUM_LOCK", fsm.Configuration{"CAPS_ON", "NUM_ON"}},
+		{"KEY", fsm.Configuration{"CAPS_ON", "NUM_ON"}},
+		{"RESET", fsm.Configuration{"CAPS_OFF", "NUM_OFF"}}, // both regions react
+		{"UNPLUG", fsm.Configuration{"OFF"}},                // leaves every region
+		{"PLUG", fsm.Configuration{"CAPS_OFF", "NUM_ON"}},   // the other region is entered as usual
+		{"JUMP", fsm.Configuration{"CAPS_ON", "NUM_OFF"}},   // between regions, so the parallel state is re-entered
+	}
+	for _, step := range steps {
+		if len(step.event) > 0 {
+			machine.Fire(step.event)
+		}
+		if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, step.configuration) {
+			t.Errorf("after %s the configuration is %v, expected %v", step.event, configuration, step.configuration)
+		}
+	}
+	if machine.GetVariables().Get("typed") != int64(0) {
+		t.Errorf("typed is %v, expected the reset to 0", machine.GetVariables().Get("typed"))
+	}
+	if !machine.IsIn("ACTIVE") || !machine.IsIn("CAPS") || !machine.IsIn("NUM") {
+		t.Error("the parallel state and its regions are not active")
+	}
+}
+
+func TestRegionTakesPriorityOverParent(t *testing.T) {
+	model, diagnostics := fsm.Load("priority.aml", "syntax fsm\n"+
+		"var n = 0\n"+
+		"init parallel ACTIVE {\n"+
+		"    E -> OFF (n += 10)\n"+
+		"    F -> OFF (n += 100)\n"+
+		"    state A {\n"+
+		"        init state A1 { E -> A2 (n += 1) }\n"+
+		"        state A2 { F -> A2 }\n"+
+		"    }\n"+
+		"    state B {\n"+
+		"        init state B1 { G -> B1 }\n"+
+		"    }\n"+
+		"}\n"+
+		"state OFF { G -> OFF }\n")
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	machine.Fire("E")
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"A2", "B1"}) {
+		t.Errorf("the parent took the event a region took, the configuration is %v", configuration)
+	}
+	if n := machine.GetVariables().Get("n"); n != int64(1) {
+		t.Errorf("n is %v, expected only the transition of the region to run", n)
+	}
+	machine.Reset()
+	machine.Fire("F")
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"OFF"}) {
+		t.Errorf("the parent did not take the event no region took, the configuration is %v", configuration)
+	}
+}
+
+func TestParallelSummary(t *testing.T) {
+	model, _ := fsm.Load("parallel.aml", parallelModel)
+	machine := model.Get()
+	summary := runners.RunAsRandom(&machine, 50)
+	if summary.Occurences["CAPS_OFF, NUM_OFF"] == 0 {
+		t.Errorf("the initial configuration is not recorded: %v", summary.Occurences)
+	}
+	if summary.DeadlockState.IsSome() {
+		t.Errorf("unexpected deadlock in %v", summary.DeadlockState.Get())
+	}
+}
@@ -1,7 +1,161 @@
 package test
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+const parserModel = "syntax fsm\n" +
+	"model PARSER_MODEL // trailing comment\n" +
+	"var i = 10\n" +
+	"var s = some string\n" +
+	"init state STATE_1 {\n" +
+	"    EVENT_1 -> mystate // goes to a state with 'state' in its name\n" +
+	"    EVENT_2 (i == 10) -> STATE_3 (i += 10)\n" +
+	"}\n" +
+	"state mystate { EVENT_1 -> STATE_1 }\r\n" +
+	"state STATE_3 {\r\n" +
+	"    EVENT_3 -x\r\n" +
+	"}\r\n"
 
 func TestParser(t *testing.T) {
+	file, diagnostics := fsm.ParseFile("parser.aml", parserModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	if file.Model == nil || file.Model.Name != "PARSER_MODEL" {
+		t.Error("model name not parsed")
+	}
+	if len(file.Variables) != 2 {
+		t.Fatal("variables not parsed")
+	}
+	if value, isLiteral := file.Variables[1].Value.(*fsm.Literal); !isLiteral || value.Value != "some string" || !file.Variables[1].Unquoted {
+		t.Error("unquoted string variable not parsed")
+	}
+	if len(file.States) != 3 {
+		t.Fatalf("expected 3 states, got %d", len(file.States))
+	}
+	if !file.States[0].Initial || file.States[1].Initial {
+		t.Error("initial state not parsed")
+	}
+	guarded := file.States[0].Transitions[1]
+	if guarded.Event != "EVENT_2" || guarded.Target != "STATE_3" || len(guarded.Guard) != 1 || len(guarded.Updates) != 1 {
+		t.Error("guarded transition not parsed")
+	}
+	if guarded.Start.Line != 7 || guarded.Start.Column != 5 {
+		t.Errorf("transition position is %s, expected 7:5", guarded.Start)
+	}
+	if !file.States[2].Transitions[0].Terminate {
+		t.Error("termination not parsed")
+	}
+
+	model := fsm.FromString(parserModel)
+	if model.IsNone() {
+		t.Fatal("model not built")
+	}
+	machine := model.Get()
+	machine.Fire("EVENT_1")
+	if machine.GetCurrentState().Get().GetName() != "mystate" {
+		t.Error("EVENT_1 did not lead to mystate")
+	}
+}
+
+func TestParserRecovers(t *testing.T) {
+	source := "syntax fsm\n" +
+		"var = 1\n" +
+		"init state A {\n" +
+		"    EVENT_1 (i ~ 1) -> B\n" +
+		"    EVENT_2 -> B\n" +
+		"}\n" +
+		"state B { EVENT_1 -> }\n"
+	file, diagnostics := fsm.ParseFile("recover.aml", source)
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected 3 syntax errors, got %v", diagnostics)
+	}
+	if len(file.States) != 2 || len(file.States[0].Transitions) != 1 {
+		t.Error("valid declarations were not kept")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	source := "syntax fsm\n" +
+		"var i = 1\n" +
+		"init state A {\n" +
+		"    EVENT_1 (j == 1) -> B\n" +
+		"    EVENT_2 (i ~ 1) -> B\n" +
+		"}\n" +
+		"state B {\n" +
+		"}\n"
+	model, diagnostics := fsm.Load("diagnostics.aml", source)
+	if model.IsSome() {
+		t.Error("no model should be returned for a model with errors")
+	}
+	if !diagnostics.HasErrors() || !diagnostics.HasWarnings() {
+		t.Errorf("expected both errors and warnings, got %v", diagnostics)
+	}
+	undeclared := diagnostics.WithCode(fsm.CODE_UNDECLARED_VARIABLE)
+	if len(undeclared) != 1 {
+		t.Fatalf("expected 1 undeclared variable, got %v", diagnostics)
+	}
+	if undeclared[0].File != "diagnostics.aml" || undeclared[0].Span.Start.Line != 4 || undeclared[0].Span.Start.Column != 14 {
+		t.Errorf("undeclared variable reported at %s", undeclared[0])
+	}
+	invalid := diagnostics.WithCode(fsm.CODE_UNEXPECTED_TOKEN)
+	if len(invalid) != 1 || invalid[0].Severity != fsm.SEVERITY_ERROR || invalid[0].Span.Start.Line != 5 {
+		t.Errorf("expected an error for '~' on line 5, got %v", diagnostics)
+	}
+	empty := diagnostics.WithCode(fsm.CODE_EMPTY_STATE)
+	if len(empty) != 1 || empty[0].Severity != fsm.SEVERITY_WARNING {
+		t.Errorf("expected a warning for the empty state B, got %v", diagnostics)
+	}
+
+	model, diagnostics = fsm.Load("diagnostics.aml", "syntax fsm\nstate A { E -> A }\n")
+	if model.IsSome() || len(diagnostics.WithCode(fsm.CODE_MISSING_INITIAL)) != 1 {
+		t.Errorf("expected a missing initial state error, got %v", diagnostics)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := fsm.Tokenize("state A {\n\tE (x >= -1) -x\n}")
+	expected := []fsm.TokenKind{
+		fsm.TOKEN_KEYWORD, fsm.TOKEN_IDENT, fsm.TOKEN_LBRACE,
+		fsm.TOKEN_IDENT, fsm.TOKEN_LPAREN, fsm.TOKEN_IDENT, fsm.TOKEN_GE, fsm.TOKEN_MINUS, fsm.TOKEN_INT, fsm.TOKEN_RPAREN, fsm.TOKEN_TERMINATE,
+		fsm.TOKEN_RBRACE, fsm.TOKEN_EOF,
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, token := range tokens {
+		if token.Kind != expected[i] {
+			t.Errorf("token %d is %s, expected %s", i, token.Kind, expected[i])
+		}
+	}
+	if tokens[3].Start.Line != 2 || tokens[3].Start.Column != 2 {
+		t.Errorf("token position is %s, expected 2:2", tokens[3].Start)
+	}
+}
 
+func TestParserRecoversFromStrayBraces(t *testing.T) {
+	sources := []string{
+		"}",
+		"syntax fsm\ninit state A { GO -> A }}\n",
+		"syntax fsm\nenum Color { R, G }\nvar c: Color = R\ninit state A {\n    etry { c = G }\n    GO -> A\n}\n",
+	}
+	for _, source := range sources {
+		done := make(chan fsm.Diagnostics, 1)
+		go func() {
+			_, diagnostics := fsm.ParseFile("braces.aml", source)
+			done <- diagnostics
+		}()
+		select {
+		case diagnostics := <-done:
+			if !diagnostics.HasErrors() {
+				t.Errorf("expected an error for %q", source)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("parsing %q did not finish", source)
+		}
+	}
 }
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/runners"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+const doorModel = "syntax fsm\n" +
+	"model DOOR\n" +
+	"var knocks = 0\n" +
+	"init state CLOSED { OPEN -> OPENING (raise DONE) }\n" +
+	"state OPENING {\n" +
+	"    DONE -> OPENED\n" +
+	"    KNOCK -> CLOSED\n" +
+	"}\n" +
+	"state OPENED {\n" +
+	"    KNOCK -> OPENED (knocks += 1, raise IGNORED)\n" +
+	"    PING -> OPENED (raise PING)\n" +
+	"}\n"
+
+func TestRaisedEventsGoFirst(t *testing.T) {
+	model, diagnostics := fsm.Load("door.aml", doorModel)
+	if unhandled := diagnostics.WithCode(fsm.CODE_UNHANDLED_EVENT); len(diagnostics) != 1 || len(unhandled) != 1 || unhandled[0].Span.Start.Line != 10 {
+		t.Fatalf("expected only the raised event without a transition to be reported: %v", diagnostics)
+	}
+	machine := model.Get()
+	machine.Post("OPEN")
+	machine.Post("KNOCK")
+	if machine.GetPending() != 2 {
+		t.Fatalf("expected 2 pending events, got %d", machine.GetPending())
+	}
+	machine.Step()
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"OPENED"}) || machine.GetInternalSteps() != 1 {
+		t.Errorf("the raised event was not handled before the posted one, configuration is %v", configuration)
+	}
+	machine.Step()
+	if machine.GetMode() != mode.CONTINUE || machine.GetVariables().Get("knocks") != int64(1) {
+		t.Errorf("a raised event without a transition stopped the model, mode is %v: %s", machine.GetMode(), machine.GetCause())
+	}
+	if machine.Step() {
+		t.Error("stepped without a posted event")
+	}
+}
+
+func TestMaxMicrosteps(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	echo := fsm.Computation{Send: types.Some(fsm.Message{Event: "PING"})}
+	machine, err := builder.
+		MaxMicrosteps(5).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("PING", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A").Run2(&fsm.Computational{Computations: []fsm.Computation{echo}})
+			})
+		}).
+		Initial("A").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.Fire("PING")
+	if machine.GetMode() != mode.CRASH || machine.GetInternalSteps() != 5 {
+		t.Errorf("a model raising events forever was not stopped after 5 microsteps, mode is %v after %d", machine.GetMode(), machine.GetInternalSteps())
+	}
+}
+
+func TestSummaryCountsInternalSteps(t *testing.T) {
+	model, _ := fsm.Load("door.aml", "syntax fsm\n"+
+		"init state A { GO -> B (raise BACK) }\n"+
+		"state B { BACK -> A }\n")
+	machine := model.Get()
+	summary := runners.RunAsRandom(&machine, 11)
+	if summary.ExternalSteps != 10 || summary.InternalSteps != 10 {
+		t.Errorf("expected 10 external and 10 internal steps, got %d and %d", summary.ExternalSteps, summary.InternalSteps)
+	}
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/runners"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+const switchModel = "syntax fsm\n" +
+	"init state A { LEFT -> A\n RIGHT -> B }\n" +
+	"state B { LEFT -> A\n RIGHT -> B }\n"
+
+func runSwitch(t *testing.T, options runners.RandomOptions) runners.Summary {
+	model, diagnostics := fsm.Load("switch.aml", switchModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	return runners.RunAsRandomWith(&machine, options)
+}
+
+func TestSeedReplaysRun(t *testing.T) {
+	first := runSwitch(t, runners.RandomOptions{Iterations: 50})
+	replayed := runSwitch(t, runners.RandomOptions{Iterations: 50, Seed: first.Seed})
+	if replayed.Seed != first.Seed || !reflect.DeepEqual(replayed.Path, first.Path) {
+		t.Fatalf("the run was not replayed by its seed %v:\n%v\n%v", first.Seed, first.Path, replayed.Path)
+	}
+	if given := runSwitch(t, runners.RandomOptions{Iterations: 5, Source: rand.NewSource(1)}); given.Seed.IsSome() {
+		t.Errorf("a run from a given source recorded the seed %d", given.Seed.Get())
+	}
+}
+
+func TestRandomRunRestoresClock(t *testing.T) {
+	model, _ := fsm.Load("blink.aml", "syntax fsm\n"+
+		"init state ON { after 1s -> OFF }\n"+
+		"state OFF { after 2s -> ON }\n")
+	machine := model.Get()
+	clock := machine.GetClock()
+	runners.RunAsRandom(&machine, 10)
+	if machine.GetClock() != clock {
+		t.Errorf("the run left the model with the clock %v", machine.GetClock())
+	}
+	if due := machine.GetNextTimeout(); due.IsSome() && due.Get().Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("the timers still fall due by the virtual clock, at %v", due.Get())
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	weighted := runSwitch(t, runners.RandomOptions{Iterations: 20, Seed: types.Some(int64(7)), Strategy: runners.NewWeighted(map[string]float64{"RIGHT": 0})})
+	if weighted.Occurences["B"] != 0 {
+		t.Errorf("an event weighing nothing was chosen %d times", weighted.Occurences["B"])
+	}
+	strategy := runners.NewRoundRobin()
+	expected := []fsm.Configuration{{"A"}, {"A"}, {"B"}, {"A"}, {"B"}}
+	for run := 0; run < 2; run++ {
+		// the strategy starts over, the second run takes the same turns
+		roundRobin := runSwitch(t, runners.RandomOptions{Iterations: 5, Strategy: strategy})
+		if !reflect.DeepEqual(roundRobin.Path, expected) {
+			t.Errorf("expected the events to be chosen in turn in run %d, got %v", run, roundRobin.Path)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+const lightsModel = "syntax fsm\n" +
+	"model LIGHTS\n" +
+	"enum Color { RED, GREEN }\n" +
+	"var c: Color = RED\n" +
+	"var n = 0\n" +
+	"var level = 0.5\n" +
+	"var on = false\n" +
+	"var label = \"hall\"\n" +
+	"init state OFF { SWITCH -> ON (c = GREEN, n += 1, level *= 3, on = true) }\n" +
+	"state ON { SWITCH -> OFF (c = RED, on = false) }\n"
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	model, diagnostics := fsm.Load("lights.aml", lightsModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	machine.Fire("SWITCH")
+	snapshot := machine.Snapshot()
+	if snapshot.Model != "LIGHTS" || !reflect.DeepEqual(snapshot.Configuration, []string{"ON"}) || len(snapshot.Variables) != 5 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := snapshot.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(binary) >= len(encoded) {
+		t.Errorf("the binary form (%d bytes) is not more compact than JSON (%d bytes)", len(binary), len(encoded))
+	}
+	for name, data := range map[string][]byte{"json": encoded, "binary": binary} {
+		read, err := fsm.ReadSnapshot(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(read, snapshot) {
+			t.Errorf("%s: read %+v, expected %+v", name, read, snapshot)
+		}
+		fresh, _ := fsm.Load("lights.aml", lightsModel)
+		restored := fresh.Get()
+		if err := restored.Restore(read); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, variable := range []string{"c", "n", "level", "on", "label"} {
+			if restored.GetVariables().Get(variable) != machine.GetVariables().Get(variable) {
+				t.Errorf("%s: %s is %v after the restore, expected %v", name, variable, restored.GetVariables().Get(variable), machine.GetVariables().Get(variable))
+			}
+		}
+		restored.Fire("SWITCH")
+		if configuration := restored.GetConfiguration(); restored.GetMode() != mode.CONTINUE || !reflect.DeepEqual(configuration, fsm.Configuration{"OFF"}) {
+			t.Errorf("%s: the restored model did not carry on, configuration is %v", name, configuration)
+		}
+	}
+}
+
+func TestRestoreOtherModel(t *testing.T) {
+	model, _ := fsm.Load("lights.aml", lightsModel)
+	machine := model.Get()
+	snapshot := machine.Snapshot()
+	other, _ := fsm.Load("lights.aml", lightsModel+"state BROKEN { SWITCH -> OFF }\n")
+	changed := other.Get()
+	if changed.GetHash() == machine.GetHash() {
+		t.Fatal("a changed model has the same hash")
+	}
+	if err := changed.Restore(snapshot); err == nil {
+		t.Error("restored a snapshot of another model")
+	}
+	if _, err := fsm.ReadSnapshot([]byte(fsm.SNAPSHOT_MAGIC + "\x01\x05LI")); err == nil {
+		t.Error("read a truncated snapshot")
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/runners"
+)
+
+const pingModel = "syntax fsm\n" +
+	"model PING {\n" +
+	"    var count: int = 0\n" +
+	"    init state IDLE {\n" +
+	"        START -> WAITING (count += 1, send PONG.PING)\n" +
+	"    }\n" +
+	"    state WAITING {\n" +
+	"        PONG -> AGAIN (count += 1, send PONG.PING)\n" +
+	"    }\n" +
+	"    state AGAIN {\n" +
+	"        PONG -> IDLE\n" +
+	"    }\n" +
+	"}\n"
+
+const pongModel = "syntax fsm\n" +
+	"model PONG\n" +
+	"var received = 0\n" +
+	"init state READY {\n" +
+	"    PING -> READY (received += 1, send PING.PONG)\n" +
+	"}\n"
+
+func TestSystemDelivers(t *testing.T) {
+	system, diagnostics := fsm.LoadSystem(
+		fsm.Source{Name: "ping.aml", Contents: pingModel},
+		fsm.Source{Name: "pong.aml", Contents: pongModel},
+	)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	composed := system.Get()
+	composed.Fire("PING.START")
+	if composed.GetMode() != mode.CONTINUE {
+		t.Fatalf("system stopped: %s", composed.GetCause())
+	}
+	if configuration := composed.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"PING.IDLE", "PONG.READY"}) {
+		t.Errorf("configuration is %v after the exchange", configuration)
+	}
+	pong := composed.GetMachine("PONG").Get()
+	if received := pong.GetVariables().Get("received"); received != int64(2) {
+		t.Errorf("PONG received %v pings, expected 2", received)
+	}
+}
+
+func TestSystemModelBlocks(t *testing.T) {
+	system, diagnostics := fsm.LoadSystem(fsm.Source{Name: "system.aml", Contents: pingModel + "model PONG {\n" +
+		"    init state READY {\n" +
+		"        entry { send PING.HELLO }\n" +
+		"        PING -> READY (send PING.PONG)\n" +
+		"    }\n" +
+		"}\n"})
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	if unhandled := diagnostics.WithCode(fsm.CODE_UNHANDLED_EVENT); len(unhandled) != 1 || unhandled[0].Span.Start.Line != 16 {
+		t.Errorf("HELLO is not reported as unhandled: %v", diagnostics)
+	}
+	composed := system.Get()
+	if len(composed.GetMachines()) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(composed.GetMachines()))
+	}
+	summary := runners.RunAsRandom(&composed, 20)
+	if summary.Occurences["PING.IDLE, PONG.READY"] == 0 {
+		t.Errorf("the initial configuration is not recorded: %v", summary.Occurences)
+	}
+}
+
+func TestSystemErrors(t *testing.T) {
+	_, diagnostics := fsm.LoadSystem(
+		fsm.Source{Name: "ping.aml", Contents: pingModel},
+		fsm.Source{Name: "other.aml", Contents: "syntax fsm\nmodel PING\ninit state A { GO -> A (send NOBODY.GO) }\n"},
+	)
+	if duplicates := diagnostics.WithCode(fsm.CODE_DUPLICATE_MODEL); len(duplicates) != 1 || duplicates[0].File != "other.aml" {
+		t.Errorf("duplicate model not reported: %v", diagnostics)
+	}
+	if unknown := diagnostics.WithCode(fsm.CODE_UNKNOWN_MODEL); len(unknown) != 2 || unknown[0].File != "ping.aml" {
+		t.Errorf("send to the missing PONG not reported: %v", diagnostics)
+	}
+	_, diagnostics = fsm.Load("ping.aml", pingModel+"model PONG {\n    init state A { GO -> A }\n}\n")
+	if len(diagnostics.WithCode(fsm.CODE_MULTIPLE_MODELS)) != 1 {
+		t.Errorf("Load accepted several models: %v", diagnostics)
+	}
+}
+
+func TestSendOutsideSystem(t *testing.T) {
+	model, _ := fsm.Load("ping.aml", pingModel)
+	machine := model.Get()
+	machine.Fire("START")
+	if outbox := machine.GetOutbox(); !reflect.DeepEqual(outbox, []fsm.Message{{Model: "PONG", Event: "PING"}}) {
+		t.Errorf("outbox is %v", outbox)
+	}
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/runners"
+)
+
+const linkModel = "syntax fsm\n" +
+	"model LINK\n" +
+	"var beats = 0\n" +
+	"init state CONNECTING {\n" +
+	"    OPEN -> CONNECTED\n" +
+	"    after 500ms -x\n" +
+	"}\n" +
+	"state CONNECTED {\n" +
+	"    every 1s -> CONNECTED (beats += 1)\n" +
+	"    CLOSE -> CONNECTING\n" +
+	"}\n"
+
+func loadLink(t *testing.T) (*fsm.FiniteStateMachine, *fsm.VirtualClock) {
+	model, diagnostics := fsm.Load("link.aml", linkModel)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	clock := fsm.NewVirtualClock()
+	machine.SetClock(clock)
+	return &machine, clock
+}
+
+func TestAfter(t *testing.T) {
+	machine, clock := loadLink(t)
+	clock.Advance(499 * time.Millisecond)
+	machine.Tick()
+	if machine.GetMode() != mode.CONTINUE {
+		t.Fatalf("the timer fell due early, mode is %v", machine.GetMode())
+	}
+	clock.Advance(time.Millisecond)
+	machine.Tick()
+	if machine.GetMode() != mode.TERMINATE {
+		t.Errorf("the timer did not fall due, mode is %v", machine.GetMode())
+	}
+}
+
+func TestTimerStopsWhenStateIsLeft(t *testing.T) {
+	machine, clock := loadLink(t)
+	machine.Fire("OPEN")
+	clock.Advance(time.Second)
+	machine.Tick()
+	if machine.GetMode() != mode.CONTINUE {
+		t.Fatalf("the timer of CONNECTING fell due in CONNECTED: %s", machine.GetCause())
+	}
+	machine.Fire("CLOSE")
+	if due := machine.GetNextTimeout(); due.IsNone() || !due.Get().Equal(clock.Now().Add(500*time.Millisecond)) {
+		t.Errorf("the timer did not start over when CONNECTING was entered again: %v", due)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	machine, clock := loadLink(t)
+	machine.Fire("OPEN")
+	clock.Advance(3500 * time.Millisecond)
+	machine.Tick()
+	if beats := machine.GetVariables().Get("beats"); beats != int64(3) {
+		t.Errorf("beats is %v after 3.5s, expected 3", beats)
+	}
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"CONNECTED"}) {
+		t.Errorf("configuration is %v", configuration)
+	}
+}
+
+func TestTimerBuilder(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	clock := fsm.NewVirtualClock()
+	machine, err := builder.
+		Clock(clock).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.After(time.Minute, func(eb *fsm.EdgeBuilder) {
+				eb.Then("B")
+			})
+		}).
+		Given("B", func(sb *fsm.StateBuilder) {
+			sb.When("BACK", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A")
+			})
+		}).
+		Initial("A").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	machine.Tick()
+	if configuration := machine.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"B"}) {
+		t.Errorf("configuration is %v", configuration)
+	}
+}
+
+func TestTimedRandomRun(t *testing.T) {
+	model, _ := fsm.Load("blink.aml", "syntax fsm\n"+
+		"init state ON { after 1s -> OFF }\n"+
+		"state OFF { after 2s -> ON }\n")
+	machine := model.Get()
+	summary := runners.RunAsRandom(&machine, 10)
+	if summary.DeadlockState.IsSome() || summary.Occurences["OFF"] == 0 {
+		t.Errorf("the timers were not taken: %v", summary.Occurences)
+	}
+}
+
+func TestSystemTick(t *testing.T) {
+	system, diagnostics := fsm.LoadSystem(fsm.Source{Name: "system.aml", Contents: "syntax fsm\n" +
+		"model A {\n" +
+		"    init state WAIT { after 2s -> DONE (send B.GO) }\n" +
+		"    state DONE { RESET -> WAIT }\n" +
+		"}\n" +
+		"model B {\n" +
+		"    init state IDLE { GO -> BUSY }\n" +
+		"    state BUSY { after 1s -> IDLE }\n" +
+		"}\n"})
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	composed := system.Get()
+	clock := fsm.NewVirtualClock()
+	composed.SetClock(clock)
+	clock.Advance(2 * time.Second)
+	composed.Tick()
+	if configuration := composed.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"A.DONE", "B.BUSY"}) {
+		t.Errorf("configuration is %v", configuration)
+	}
+	clock.Advance(time.Second)
+	composed.Tick()
+	if configuration := composed.GetConfiguration(); !reflect.DeepEqual(configuration, fsm.Configuration{"A.DONE", "B.IDLE"}) {
+		t.Errorf("the timer of B did not start on delivery: %v", configuration)
+	}
+}
+
+func TestTimerDiagnostics(t *testing.T) {
+	_, diagnostics := fsm.ParseFile("bad.aml", "syntax fsm\n"+
+		"init state A {\n"+
+		"    after 5 -> A\n"+
+		"    every 0s -> A\n"+
+		"    after soon -> A\n"+
+		"}\n")
+	if invalid := diagnostics.WithCode(fsm.CODE_INVALID_DURATION); len(invalid) != 3 {
+		t.Errorf("bad durations not reported: %v", diagnostics)
+	}
+}
+
+func TestSystemTickSkipsStoppedModels(t *testing.T) {
+	system, diagnostics := fsm.LoadSystem(fsm.Source{Name: "system.aml", Contents: "syntax fsm\n" +
+		"model A {\n" +
+		"    init state WAIT { after 1s -> DONE\n STOP -x }\n" +
+		"    state DONE { RESET -> WAIT }\n" +
+		"}\n"})
+	if diagnostics.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	composed := system.Get()
+	clock := fsm.NewVirtualClock()
+	composed.SetClock(clock)
+	composed.Fire("A.STOP")
+	if due := composed.GetNextTimeout(); due.IsSome() {
+		t.Errorf("the timers of a terminated model are still armed: %v", due.Get())
+	}
+	clock.Advance(2 * time.Second)
+	if composed.Tick() || composed.GetMode() != mode.TERMINATE || !reflect.DeepEqual(composed.GetConfiguration(), fsm.Configuration{"A.WAIT"}) {
+		t.Errorf("a terminated model took its timer, %v in %v", composed.GetConfiguration(), composed.GetMode())
+	}
+}
+
+func TestNonPositiveDelays(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	clock := fsm.NewVirtualClock()
+	machine, err := builder.
+		Clock(clock).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.Every(0, func(eb *fsm.EdgeBuilder) {
+				eb.Then("A")
+			})
+			sb.After(-time.Second, func(eb *fsm.EdgeBuilder) {
+				eb.Then("B")
+			})
+		}).
+		Given("B", func(sb *fsm.StateBuilder) {
+			sb.When("BACK", func(eb *fsm.EdgeBuilder) { eb.Then("A") })
+		}).
+		Initial("A").
+		Build()
+	var invalid *fsm.ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 2 {
+		t.Errorf("expected both delays to be reported, got %v", err)
+	}
+	clock.Advance(time.Minute)
+	if machine.Tick() || !reflect.DeepEqual(machine.GetConfiguration(), fsm.Configuration{"A"}) {
+		t.Errorf("a timer without a positive delay fell due, configuration is %v", machine.GetConfiguration())
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/runners"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+func TestTraceReplay(t *testing.T) {
+	definition, _ := fsm.LoadDefinition("lights.aml", lightsModel)
+	machine := definition.Get().NewInstance()
+	summary := runners.RunAsRandomWith(&machine, runners.RandomOptions{Iterations: 10, Seed: types.Some(int64(1))})
+	if len(summary.Trace) != 9 || len(summary.Path) != 10 || !reflect.DeepEqual(summary.Path[0], fsm.Configuration{"OFF"}) {
+		t.Fatalf("expected 9 steps after the initial configuration, got %d steps and the path %v", len(summary.Trace), summary.Path)
+	}
+	if changes := summary.Trace[0].Changes; len(changes) != 4 || changes[0].Name != "c" || changes[0].After != "GREEN" {
+		t.Fatalf("unexpected changes of the first step: %+v", changes)
+	}
+	var buffer bytes.Buffer
+	if _, err := summary.Trace.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	trace, err := runners.ReadTrace(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := definition.Get().NewInstance()
+	if err := runners.Replay(&replayed, trace); err != nil {
+		t.Fatalf("the replay diverged: %v", err)
+	}
+	trace[3].Target = fsm.Configuration{"BROKEN"}
+	diverging := definition.Get().NewInstance()
+	var divergence *runners.Divergence
+	if err := runners.Replay(&diverging, trace); !errors.As(err, &divergence) || divergence.Index != 3 {
+		t.Fatalf("expected the replay to diverge at step 3, got %v", err)
+	}
+}
+
+func TestTraceGuards(t *testing.T) {
+	model, _ := fsm.Load("guarded.aml", guardedModel)
+	machine := model.Get()
+	err := runners.Replay(&machine, runners.Trace{
+		{Event: "STOP", Source: fsm.Configuration{"A"}, Target: fsm.Configuration{"A"}, Mode: mode.DEADLOCK},
+	})
+	var divergence *runners.Divergence
+	if !errors.As(err, &divergence) {
+		t.Fatalf("expected the guards to diverge, got %v", err)
+	}
+	if expected := []runners.GuardResult{{State: "A", Guard: "i > 5", Holds: false}}; !reflect.DeepEqual(divergence.Actual.Guards, expected) {
+		t.Fatalf("expected the guards %v, got %v", expected, divergence.Actual.Guards)
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+func TestTypedVariables(t *testing.T) {
+	model, diagnostics := fsm.Load("typed.aml", "syntax fsm\n"+
+		"model TYPED\n"+
+		"var i: int = 10\n"+
+		"var r: float = 1\n"+
+		"var b: bool = false\n"+
+		"var s: string = \"text\"\n"+
+		"var n = -2\n"+
+		"init state A { GO (!b && r < i) -> A (r += n, s = s + \"!\") }\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+	machine := model.Get()
+	variables := machine.GetVariables()
+	expectedTypes := map[string]fsm.VariableType{"i": fsm.INT, "r": fsm.FLOAT, "b": fsm.BOOL, "s": fsm.STRING, "n": fsm.INT}
+	for name, expected := range expectedTypes {
+		if variables.GetType(name) != expected {
+			t.Errorf("%s is %s, expected %s", name, variables.GetType(name), expected)
+		}
+	}
+	if r, isFloat := variables.Get("r").(float64); !isFloat || r != 1 {
+		t.Errorf("r is %#v, expected 1.0", variables.Get("r"))
+	}
+	machine.Fire("GO")
+	if variables.Get("r") != -1.0 || variables.Get("s") != "text!" {
+		t.Errorf("computations gave r=%v s=%v", variables.Get("r"), variables.Get("s"))
+	}
+}
+
+func TestTypeCheckErrors(t *testing.T) {
+	_, diagnostics := fsm.Load("bad.aml", "syntax fsm\n"+
+		"model BAD\n"+
+		"var i: int = 0.5\n"+
+		"var c: colour = 1\n"+
+		"var b = ture\n"+
+		"var f = 1.5\n"+
+		"var f = 2.5\n"+
+		"init state A {\n"+
+		"    GO (f) -> A\n"+
+		"    STOP (f > \"x\") -> A (f += 1)\n"+
+		"    RUN -> A (b -= 1)\n"+
+		"}\n")
+	mismatches := diagnostics.WithCode(fsm.CODE_TYPE_MISMATCH)
+	if len(mismatches) != 4 {
+		t.Fatalf("expected 4 type mismatches, got %v", diagnostics)
+	}
+	if mismatches[0].Span.Start.Line != 3 || mismatches[1].Span.Start.Line != 9 || mismatches[2].Span.Start.Line != 10 || mismatches[3].Span.Start.Line != 11 {
+		t.Errorf("type mismatches reported at the wrong lines: %v", mismatches)
+	}
+	if len(diagnostics.WithCode(fsm.CODE_UNKNOWN_TYPE)) != 1 {
+		t.Errorf("unknown type not reported: %v", diagnostics)
+	}
+	if warnings := diagnostics.WithCode(fsm.CODE_UNQUOTED_STRING); len(warnings) != 1 || warnings[0].Severity != fsm.SEVERITY_WARNING {
+		t.Errorf("unquoted string not reported: %v", diagnostics)
+	}
+	if len(diagnostics.WithCode(fsm.CODE_DUPLICATE_VARIABLE)) != 1 {
+		t.Errorf("duplicate variable not reported: %v", diagnostics)
+	}
+}
+
+func TestTypeCheckBuiltModel(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	builder.
+		DeclareVar("count", 0).
+		DeclareVar("on", true).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A")
+				eb.And2(&fsm.Conditionals{Conditions: []fsm.Condition{{Left: "count", Symbol: fsm.GT, Right: "on"}}})
+				eb.Run2(&fsm.Computational{FuncSignature: "func()", Computations: []fsm.Computation{{Left: "on", Operator: fsm.ADD_ASSIGN, Right: "1"}}})
+			})
+		}).
+		Initial("A")
+	machine, _ := builder.Build()
+	if diagnostics := machine.TypeCheck(); len(diagnostics.WithCode(fsm.CODE_TYPE_MISMATCH)) != 2 {
+		t.Errorf("expected 2 type mismatches, got %v", diagnostics)
+	}
+}
+
+func TestIllTypedEdgesDoNotRunAsWritten(t *testing.T) {
+	file, _ := fsm.ParseFile("illtyped.aml", "syntax fsm\n"+
+		"var i = 0\n"+
+		"init state A {\n"+
+		"    GO (j == 1) -> B\n"+
+		"    SET -> A (i = \"one\")\n"+
+		"}\n"+
+		"state B { GO -> A }\n")
+	builder := fsm.NewFsmBuilder()
+	if diagnostics := fsm.FromFile("illtyped.aml", file, &builder); !diagnostics.HasErrors() {
+		t.Fatalf("expected type errors, got %v", diagnostics)
+	}
+	machine, _ := builder.Build()
+	err := machine.Fire("GO")
+	if machine.GetMode() != mode.DEADLOCK {
+		t.Errorf("expected the ill typed guard to never hold, mode is %v in %v", machine.GetMode(), machine.GetConfiguration())
+	}
+	var noTransition *fsm.NoEnabledTransitionError
+	if !errors.As(err, &noTransition) || len(noTransition.Guards) != 1 || noTransition.Guards[0].Guard != "j == 1" {
+		t.Errorf("expected the guard to be reported as written, got %v", err)
+	}
+	machine.Fire("SET")
+	if machine.GetMode() != mode.CRASH || machine.GetVariables().Get("i") != int64(0) {
+		t.Errorf("expected the ill typed update to crash the model, mode is %v with i = %v", machine.GetMode(), machine.GetVariables().Get("i"))
+	}
+}
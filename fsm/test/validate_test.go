@@ -0,0 +1,147 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Wafl97/go_aml/fsm"
+)
+
+func TestValidate(t *testing.T) {
+	guard, _ := fsm.ParseExpression("missing > 1")
+	builder := fsm.NewFsmBuilder()
+	builder.
+		Name("BROKEN").
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("NOWHERE")
+			})
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A")
+			})
+			sb.When("CHECK", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A").And2(&fsm.Conditionals{Conditions: []fsm.Condition{{Expression: guard}}})
+			})
+		}).
+		Given("A", func(sb *fsm.StateBuilder) {}).
+		Initial("START")
+	err := builder.Validate()
+	var invalid *fsm.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	// the second A replaced the first, so only the duplicate and the initial state are left
+	if len(invalid.Problems) != 2 || invalid.Model != "BROKEN" {
+		t.Errorf("unexpected problems: %v", err)
+	}
+
+	builder = fsm.NewFsmBuilder()
+	builder.
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("NOWHERE")
+			})
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A")
+			})
+			sb.When("CHECK", func(eb *fsm.EdgeBuilder) {
+				eb.Then("A").And2(&fsm.Conditionals{Conditions: []fsm.Condition{{Expression: guard}}})
+			})
+		}).
+		Initial("A")
+	if !errors.As(builder.Validate(), &invalid) || len(invalid.Problems) != 3 {
+		t.Errorf("expected the dangling target, the shadowed edge and the undeclared variable: %v", invalid)
+	}
+
+	builder = fsm.NewFsmBuilder()
+	builder.
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) {
+				eb.End()
+			})
+		}).
+		Initial("A")
+	if err := builder.Validate(); err != nil {
+		t.Errorf("valid model rejected: %v", err)
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	model, diagnostics := fsm.Load("bad.aml", "syntax fsm\n"+
+		"init state A {\n"+
+		"    GO -> B\n"+
+		"    GO -> A\n"+
+		"    after 1s -> NOWHERE\n"+
+		"}\n"+
+		"state B { BACK -> A }\n"+
+		"state B { BACK -> A }\n")
+	if model.IsSome() {
+		t.Error("a model with errors was returned")
+	}
+	if unknown := diagnostics.WithCode(fsm.CODE_UNKNOWN_STATE); len(unknown) != 1 || unknown[0].Span.Start.Line != 5 {
+		t.Errorf("transition to an undeclared state not reported: %v", diagnostics)
+	}
+	if unreachable := diagnostics.WithCode(fsm.CODE_UNREACHABLE_EDGE); len(unreachable) != 1 || unreachable[0].Span.Start.Line != 4 {
+		t.Errorf("shadowed transition not reported: %v", diagnostics)
+	}
+	if duplicates := diagnostics.WithCode(fsm.CODE_DUPLICATE_STATE); len(duplicates) != 1 || duplicates[0].Severity != fsm.SEVERITY_ERROR {
+		t.Errorf("duplicate state not reported as an error: %v", diagnostics)
+	}
+}
+
+func TestBuildReportsProblems(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	builder.
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) { eb.Then("NOWHERE") })
+		}).
+		Initial("A")
+	machine, err := builder.Build()
+	var invalid *fsm.ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 {
+		t.Fatalf("expected the dangling target to be reported, got %v", err)
+	}
+	if configuration := machine.GetConfiguration(); len(configuration) != 1 || configuration[0] != "A" {
+		t.Errorf("expected the invalid model to be built all the same, got %v", configuration)
+	}
+	if _, err := builder.Define(); !errors.As(err, &invalid) {
+		t.Errorf("expected Define to report the dangling target, got %v", err)
+	}
+	if fsm.FromString("syntax fsm\ninit state A { GO -> NOWHERE }\n").IsSome() {
+		t.Error("FromString returned a model with errors")
+	}
+}
+
+func TestValidateParameterNamedLikeVariable(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	builder.
+		DeclareEvent("PAY", fsm.Parameter{Name: "amount", Type: fsm.INT}).
+		DeclareVar("amount", 5).
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("PAY", func(eb *fsm.EdgeBuilder) { eb.Then("A") })
+		}).
+		Initial("A")
+	var invalid *fsm.ValidationError
+	if err := builder.Validate(); !errors.As(err, &invalid) || len(invalid.Problems) != 1 {
+		t.Errorf("expected the parameter amount to be reported, got %v", err)
+	}
+}
+
+func TestInitialBeforeState(t *testing.T) {
+	builder := fsm.NewFsmBuilder()
+	builder.
+		Initial("A").
+		Given("A", func(sb *fsm.StateBuilder) {
+			sb.When("GO", func(eb *fsm.EdgeBuilder) { eb.Then("A") })
+		})
+	if err := builder.Validate(); err != nil {
+		t.Fatalf("unexpected problems: %v", err)
+	}
+	machine, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration := machine.GetConfiguration(); len(configuration) != 1 || configuration[0] != "A" {
+		t.Errorf("expected to begin in A, got %v", configuration)
+	}
+}
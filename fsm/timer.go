@@ -0,0 +1,239 @@
+package fsm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/functions"
+	"github.com/Wafl97/go_aml/util/types"
+)
+
+// Clock tells the time to the timed transitions of a model
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewSystemClock returns the wall clock, the default of every model
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+// VirtualClock only moves when it is told to, so that timed transitions can be run without waiting
+type VirtualClock struct {
+	now time.Time
+}
+
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{now: time.Unix(0, 0).UTC()}
+}
+
+func (clock *VirtualClock) Now() time.Time {
+	return clock.now
+}
+
+// Advance moves the clock forward by the duration
+func (clock *VirtualClock) Advance(duration time.Duration) {
+	clock.now = clock.now.Add(duration)
+}
+
+// AdvanceTo moves the clock forward to the time, a time in the past leaves the clock as it is
+func (clock *VirtualClock) AdvanceTo(now time.Time) {
+	if now.After(clock.now) {
+		clock.now = now
+	}
+}
+
+// Timer is a transition taken once its state has been active for the delay.
+// A repeating timer is started again every time the delay passes while the state stays active.
+type Timer struct {
+	delay  time.Duration
+	repeat bool
+	edge   *Edge
+}
+
+func (timer *Timer) GetDelay() time.Duration {
+	return timer.delay
+}
+
+func (timer *Timer) IsRepeating() bool {
+	return timer.repeat
+}
+
+func (timer *Timer) GetEdge() *Edge {
+	return timer.edge
+}
+
+// String is the trigger of the timer as written in a model, after 500ms or every 1s
+func (timer *Timer) String() string {
+	if timer.repeat {
+		return fmt.Sprintf("every %s", timer.delay)
+	}
+	return fmt.Sprintf("after %s", timer.delay)
+}
+
+func (state *State) GetTimers() []*Timer {
+	return state.timers
+}
+
+// After declares a transition taken once the state has been active for the delay.
+// The delay must be positive, Validate reports it otherwise and the timer never falls due.
+func (builder *StateBuilder) After(delay time.Duration, f functions.Consumer[*EdgeBuilder]) *StateBuilder {
+	return builder.addTimer(delay, false, f)
+}
+
+// Every declares a transition checked every time the delay passes while the state is active.
+// The delay must be positive, Validate reports it otherwise and the timer never falls due.
+func (builder *StateBuilder) Every(delay time.Duration, f functions.Consumer[*EdgeBuilder]) *StateBuilder {
+	return builder.addTimer(delay, true, f)
+}
+
+func (builder *StateBuilder) addTimer(delay time.Duration, repeat bool, f functions.Consumer[*EdgeBuilder]) *StateBuilder {
+	edgeBuilder := newEdgeBuilder()
+	f(&edgeBuilder)
+	edgeBuilder.computation2.FuncSignature = "func()"
+	edge := edgeBuilder.build()
+	builder.timers = append(builder.timers, &Timer{delay: delay, repeat: repeat, edge: &edge})
+	return builder
+}
+
+// Clock sets the clock driving the timed transitions, models use the wall clock by default
+func (fsm *FsmBuilder) Clock(clock Clock) *FsmBuilder {
+	fsm.clock = clock
+	return fsm
+}
+
+// SetClock drives the timed transitions with the clock from now on, the timers of the active states start over
+// unless the model has terminated or crashed
+func (fsm *FiniteStateMachine) SetClock(clock Clock) {
+	fsm.clock = clock
+	fsm.now = clock.Now()
+	fsm.armed = map[*Timer]time.Time{}
+	if fsm.isStopped() {
+		return
+	}
+	for _, stateName := range fsm.GetActiveStates() {
+		fsm.armTimers(fsm.states[stateName])
+	}
+}
+
+// GetClock returns the clock driving the timed transitions
+func (fsm *FiniteStateMachine) GetClock() Clock {
+	return fsm.clock
+}
+
+// Tick takes the timed transitions that are due by the clock, in the order they fell due.
+// It reports whether a transition was taken, or the model crashed checking a guard.
+func (fsm *FiniteStateMachine) Tick() bool {
+	fsm.err = nil
+	fsm.outbox = nil
+	fsm.internalSteps = 0
+	fsm.begin("")
+	fired, changed := false, false
+	for !fsm.isStopped() {
+		due, took := fsm.fireNextTimer(fsm.clock.Now())
+		if !due {
+			break
+		}
+		fired = true
+		changed = changed || took
+		fsm.runToCompletion()
+	}
+	if fired {
+		fsm.settle()
+	}
+	return changed
+}
+
+// GetNextTimeout returns when the next timer of the active states falls due
+func (fsm *FiniteStateMachine) GetNextTimeout() types.Option[time.Time] {
+	if _, _, due, ok := fsm.nextTimer(); ok {
+		return types.Some(due)
+	}
+	return types.None[time.Time]()
+}
+
+// nextTimer finds the timer falling due first, ties go to the outermost state in the order the states are active
+func (fsm *FiniteStateMachine) nextTimer() (*State, *Timer, time.Time, bool) {
+	var nextState *State
+	var next *Timer
+	var nextDue time.Time
+	for _, stateName := range fsm.GetActiveStates() {
+		state := fsm.states[stateName]
+		for _, timer := range state.timers {
+			due, armed := fsm.armed[timer]
+			if armed && (next == nil || due.Before(nextDue)) {
+				nextState, next, nextDue = state, timer, due
+			}
+		}
+	}
+	return nextState, next, nextDue, next != nil
+}
+
+// fireNextTimer takes the transition of the first timer when it is due by now.
+// It reports if there was one, and if its transition was taken or the model crashed.
+func (fsm *FiniteStateMachine) fireNextTimer(now time.Time) (bool, bool) {
+	state, timer, due, ok := fsm.nextTimer()
+	if !ok || due.After(now) {
+		return false, false
+	}
+	fsm.logger.Debugf("Timer %s of %s is due", timer, state.GetName())
+	fsm.now = due
+	delete(fsm.armed, timer)
+	holds, err := timer.edge.holds(&fsm.variables)
+	if err != nil {
+		fsm.fail(mode.CRASH, err)
+		return true, true
+	}
+	fsm.evaluated(state, timer.String())(timer.edge, holds)
+	if holds {
+		resultMode, err := fsm.take(state, timer.String(), timer.edge)
+		if err != nil {
+			fsm.fail(mode.CRASH, err)
+			return true, true
+		}
+		if resultMode == mode.TERMINATE {
+			fsm.mode = mode.TERMINATE
+			return true, true
+		}
+	}
+	if _, rearmed := fsm.armed[timer]; timer.repeat && !rearmed && fsm.IsIn(state.GetName()) {
+		fsm.armed[timer] = due.Add(timer.delay)
+	}
+	fsm.mode = mode.CONTINUE
+	return true, holds
+}
+
+// armTimers starts the timers of an entered state, they fall due counting from the current step.
+// A timer without a positive delay is left out, it would fall due again and again within one Tick.
+func (fsm *FiniteStateMachine) armTimers(state *State) {
+	for _, timer := range state.timers {
+		if timer.delay <= 0 {
+			continue
+		}
+		fsm.armed[timer] = fsm.now.Add(timer.delay)
+	}
+}
+
+// disarmTimers stops the timers of a state that is left
+func (fsm *FiniteStateMachine) disarmTimers(state *State) {
+	for _, timer := range state.timers {
+		delete(fsm.armed, timer)
+	}
+}
+
+// disarmAll stops every timer, a model that terminated or crashed takes no more timed transitions
+func (fsm *FiniteStateMachine) disarmAll() {
+	fsm.armed = map[*Timer]time.Time{}
+}
+
+// isStopped reports if the model has terminated or crashed
+func (fsm *FiniteStateMachine) isStopped() bool {
+	return fsm.mode == mode.TERMINATE || fsm.mode == mode.CRASH
+}
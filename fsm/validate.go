@@ -0,0 +1,159 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+// ValidationError lists every problem Validate found in a model
+type ValidationError struct {
+	Model    string
+	Problems []error
+}
+
+func (err *ValidationError) Error() string {
+	problems := make([]string, len(err.Problems))
+	for i, problem := range err.Problems {
+		problems[i] = problem.Error()
+	}
+	return fmt.Sprintf("model %s is invalid: %s", err.Model, strings.Join(problems, "; "))
+}
+
+func (err *ValidationError) Unwrap() []error {
+	return err.Problems
+}
+
+// Validate checks the model before it is built. Every transition must lead to a declared state or choice,
+// the initial state must be declared, no state may be declared twice, every variable used must be declared,
+// no event parameter may have the name of a variable, every timer must have a positive delay
+// and no edge may be shadowed by an earlier edge on the same event without a guard.
+// The problems are returned together as a *ValidationError, nil when there are none.
+func (fsm *FsmBuilder) Validate() error {
+	problems := []error{}
+	problemf := func(format string, arguments ...any) {
+		problems = append(problems, fmt.Errorf(format, arguments...))
+	}
+	if len(fsm.initialName) == 0 {
+		problemf("no initial state")
+	} else if _, declared := fsm.states[fsm.initialName]; !declared {
+		problemf("initial state %s is not declared", fsm.initialName)
+	}
+	for _, duplicate := range fsm.duplicates {
+		problemf("state %s is declared more than once", duplicate)
+	}
+	for _, stateName := range sortedKeys(fsm.states) {
+		state := fsm.states[stateName]
+		if _, declared := fsm.states[state.initial]; len(state.initial) > 0 && !declared {
+			problemf("initial substate %s of %s is not declared", state.initial, stateName)
+		}
+	}
+	for _, problem := range fsm.checkEdges() {
+		problems = append(problems, errors.New(problem.message))
+	}
+	for _, choiceName := range sortedKeys(fsm.choices) {
+		if fsm.choices[choiceName].otherwise.IsNone() {
+			problemf("choice %s has no else branch", choiceName)
+		}
+	}
+	for _, event := range sortedKeys(fsm.events) {
+		for _, parameter := range fsm.events[event] {
+			if _, isVariable := fsm.variables.types[parameter.Name]; isVariable {
+				problemf("parameter %s of event %s has the name of a variable", parameter.Name, event)
+			}
+		}
+	}
+	for _, diagnostic := range typeCheck(fsm.states, fsm.choices, &fsm.variables, fsm.events) {
+		if diagnostic.Severity == SEVERITY_ERROR {
+			problems = append(problems, fmt.Errorf("%s", diagnostic.Message))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Model: fsm.modelName, Problems: problems}
+}
+
+// edgeProblem is a problem of an edge found by checkEdges, Validate returns it as an error and Load as a diagnostic
+type edgeProblem struct {
+	code    DiagnosticCode
+	origin  origin
+	message string
+}
+
+// checkEdges finds the edges leading to a state or choice that is not declared,
+// and the edges that are never taken as an earlier edge on the same event has no guard
+func (fsm *FsmBuilder) checkEdges() []edgeProblem {
+	problems := []edgeProblem{}
+	isDeclared := func(target string) bool {
+		_, isState := fsm.states[target]
+		_, isChoice := fsm.choices[target]
+		return isState || isChoice
+	}
+	checkTarget := func(from string, edge *Edge) {
+		if target := edge.resultingState.GetOrElse(""); edge.terminate != mode.TERMINATE && !isDeclared(target) {
+			problems = append(problems, edgeProblem{CODE_UNKNOWN_STATE, edge.metaData.origin, fmt.Sprintf("%s leads to %s, which is not declared", from, target)})
+		}
+	}
+	checkShadowed := func(from string, edges []*Edge) {
+		for i, edge := range edges {
+			if edge.isGuarded() {
+				continue
+			}
+			for j := i + 1; j < len(edges); j++ {
+				problems = append(problems, edgeProblem{CODE_UNREACHABLE_EDGE, edges[j].metaData.origin, fmt.Sprintf("edge %d of %s is unreachable, edge %d has no guard", j+1, from, i+1)})
+			}
+			return
+		}
+	}
+	for _, stateName := range sortedKeys(fsm.states) {
+		state := fsm.states[stateName]
+		for _, event := range sortedKeys(state.transitions) {
+			edges := state.transitions[event]
+			for _, edge := range edges {
+				checkTarget(fmt.Sprintf("%s on %s", stateName, event), edge)
+			}
+			checkShadowed(fmt.Sprintf("%s on %s", stateName, event), edges)
+		}
+		for _, autoEvent := range state.autoEvents {
+			if autoEvent.terminate != mode.TERMINATE && !isDeclared(autoEvent.resultingState) {
+				problems = append(problems, edgeProblem{CODE_UNKNOWN_STATE, autoEvent.origin, fmt.Sprintf("an auto-event of %s leads to %s, which is not declared", stateName, autoEvent.resultingState)})
+			}
+		}
+		for _, timer := range state.timers {
+			checkTarget(fmt.Sprintf("%s %s", stateName, timer), timer.edge)
+			if timer.delay <= 0 {
+				problems = append(problems, edgeProblem{CODE_INVALID_DURATION, timer.edge.metaData.origin, fmt.Sprintf("%s %s does not have a positive delay", stateName, timer)})
+			}
+		}
+	}
+	for _, choiceName := range sortedKeys(fsm.choices) {
+		choice := fsm.choices[choiceName]
+		for _, branch := range choice.branches {
+			checkTarget(fmt.Sprintf("choice %s", choiceName), branch)
+		}
+		checkShadowed(fmt.Sprintf("choice %s", choiceName), choice.branches)
+		choice.otherwise.HasValue(func(otherwise *Edge) {
+			checkTarget(fmt.Sprintf("choice %s", choiceName), otherwise)
+		})
+	}
+	return problems
+}
+
+// isGuarded reports if the edge has a guard, an edge without one shadows the edges after it
+func (edge *Edge) isGuarded() bool {
+	return edge.condition.IsSome() || len(edge.condition2.Conditions) > 0
+}
+
+// sortedKeys returns the keys of the map in order, so that problems are reported the same way every time
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
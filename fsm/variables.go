@@ -1,5 +1,11 @@
 package fsm
 
+import (
+	"sort"
+
+	"github.com/Wafl97/go_aml/util/types"
+)
+
 type VariableType uint
 
 const (
@@ -7,17 +13,94 @@ const (
 	INT    VariableType = 1
 	BOOL   VariableType = 2
 	STRING VariableType = 3
+	ENUM   VariableType = 4
 )
 
+func (variableType VariableType) String() string {
+	switch variableType {
+	case FLOAT:
+		return "float"
+	case INT:
+		return "int"
+	case BOOL:
+		return "bool"
+	case STRING:
+		return "string"
+	case ENUM:
+		return "enum"
+	default:
+		return ""
+	}
+}
+
+// GoType is the name of the type in generated code
+func (variableType VariableType) GoType() string {
+	switch variableType {
+	case FLOAT:
+		return "float64"
+	default:
+		return variableType.String()
+	}
+}
+
+// zero is the value a variable of the type holds when nothing is given
+func (variableType VariableType) zero() any {
+	switch variableType {
+	case INT:
+		return int64(0)
+	case FLOAT:
+		return float64(0)
+	case BOOL:
+		return false
+	default:
+		return ""
+	}
+}
+
+// ParseVariableType looks up the type by the name used in declarations (var i: int = 10)
+func ParseVariableType(name string) (VariableType, bool) {
+	switch name {
+	case "float":
+		return FLOAT, true
+	case "int":
+		return INT, true
+	case "bool":
+		return BOOL, true
+	case "string":
+		return STRING, true
+	default:
+		return FLOAT, false
+	}
+}
+
+// Enum is a named set of members, values of ENUM variables are the names of the members
+type Enum struct {
+	Name    string
+	Members []string
+}
+
+func (enum *Enum) Has(member string) bool {
+	for _, declared := range enum.Members {
+		if declared == member {
+			return true
+		}
+	}
+	return false
+}
+
 type Variables struct {
-	values map[string]any
-	types  map[string]VariableType
+	values    map[string]any
+	types     map[string]VariableType
+	enums     map[string]*Enum
+	enumTypes map[string]string
 }
 
 func NewVariables() Variables {
 	return Variables{
-		values: map[string]any{},
-		types:  map[string]VariableType{},
+		values:    map[string]any{},
+		types:     map[string]VariableType{},
+		enums:     map[string]*Enum{},
+		enumTypes: map[string]string{},
 	}
 }
 
@@ -37,6 +120,73 @@ func (variables *Variables) GetType(key string) VariableType {
 	return variables.types[key]
 }
 
+func (variables *Variables) remove(key string) {
+	delete(variables.values, key)
+	delete(variables.types, key)
+	delete(variables.enumTypes, key)
+}
+
+// Copy returns variables holding the same values, later changes to either are not seen by the other
+func (variables *Variables) Copy() Variables {
+	copied := NewVariables()
+	for key, value := range variables.values {
+		copied.values[key] = value
+	}
+	for key, valueType := range variables.types {
+		copied.types[key] = valueType
+	}
+	for key, enumName := range variables.enumTypes {
+		copied.enumTypes[key] = enumName
+	}
+	for name, enum := range variables.enums {
+		copied.enums[name] = enum
+	}
+	return copied
+}
+
+// DeclareEnum makes the members of the enum usable as values
+func (variables *Variables) DeclareEnum(enum *Enum) {
+	variables.enums[enum.Name] = enum
+}
+
+func (variables *Variables) GetEnum(name string) types.Option[*Enum] {
+	if enum, declared := variables.enums[name]; declared {
+		return types.Some(enum)
+	}
+	return types.None[*Enum]()
+}
+
+// GetEnums returns the declared enums ordered by name
+func (variables *Variables) GetEnums() []*Enum {
+	enums := make([]*Enum, 0, len(variables.enums))
+	for _, enum := range variables.enums {
+		enums = append(enums, enum)
+	}
+	sort.Slice(enums, func(i, j int) bool { return enums[i].Name < enums[j].Name })
+	return enums
+}
+
+// SetEnumType declares the variable as a value of the enum
+func (variables *Variables) SetEnumType(key string, enumName string) {
+	variables.types[key] = ENUM
+	variables.enumTypes[key] = enumName
+}
+
+// GetEnumType is the name of the enum of an ENUM variable
+func (variables *Variables) GetEnumType(key string) string {
+	return variables.enumTypes[key]
+}
+
+// memberOf finds the enum declaring the member
+func (variables *Variables) memberOf(member string) (*Enum, bool) {
+	for _, enum := range variables.GetEnums() {
+		if enum.Has(member) {
+			return enum, true
+		}
+	}
+	return nil, false
+}
+
 func GetAndCast[T any](variables *Variables, key string) T {
 	return variables.Get(key).(T)
 }
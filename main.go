@@ -2,42 +2,98 @@ package main
 
 import (
 	"flag"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/Wafl97/go_aml/fsm"
 	"github.com/Wafl97/go_aml/util/logger"
+	"github.com/Wafl97/go_aml/util/types"
 )
 
 func main() {
-	filename := flag.String("file", "model.aml", "")
+	filenames := flag.String("file", "model.aml", "the model, several files are composed into a system when separated by commas")
 	logMode := flag.String("log", "warn", "")
+	warningsAsErrors := flag.Bool("werror", false, "treat warnings as errors")
 	flag.Parse()
 	logger.SetLogLevelByString(*logMode)
 	log := logger.New("MAIN")
 
-	log.Infof("Loading from %s", *filename)
-
-	fileContentsBytes, err := os.ReadFile(*filename)
-	if err != nil {
-		log.Error(err.Error())
-		return
+	fsys, names := fileSystemFor(strings.Split(*filenames, ","))
+	log.Infof("Loading from %s", strings.Join(names, ", "))
+	//parser := parser2.NewParser()
+	//parser.ParseFsmString(fileContents)
+	system, diagnostics := loadModels(fsys, names)
+	for _, diagnostic := range diagnostics {
+		switch diagnostic.Severity {
+		case fsm.SEVERITY_ERROR:
+			log.Error(diagnostic.String())
+		case fsm.SEVERITY_WARNING:
+			log.Warn(diagnostic.String())
+		default:
+			log.Info(diagnostic.String())
+		}
 	}
-	fileContents := string(fileContentsBytes)
-	if strings.Contains(fileContents, "syntax fsm") {
-		//parser := parser2.NewParser()
-		//parser.ParseFsmString(fileContents)
-		fsm.FromString(fileContents).HasValue(func(model fsm.FiniteStateMachine) {
-			fsm.Generate(&model)
-			//summary := runners.RunAsRandom(&model, 100)
-			//summary.DeadlockState.HasValue(func(s string) {
-			//	log.Errorf("Model reached a deadlock in state %s", s)
-			//})
-			//log.Info("Done!")
-		}).Else(func() {
-			log.Error("Model is invalid ... exiting")
-		})
+	if diagnostics.HasErrors() || (*warningsAsErrors && diagnostics.HasWarnings()) {
+		log.Error("Model is invalid ... exiting")
+		os.Exit(1)
 	}
+	system.HasValue(func(system fsm.System) {
+		if machines := system.GetMachines(); len(machines) == 1 {
+			fsm.Generate(machines[0])
+		} else {
+			fsm.GenerateSystem(&system)
+		}
+		//summary := runners.RunAsRandom(&system, 100)
+		//summary.DeadlockState.HasValue(func(s fsm.Configuration) {
+		//	log.Errorf("Model reached a deadlock in %s", s)
+		//})
+		//log.Info("Done!")
+	})
 
 	//runners.RunAsCli(&tm)
 }
+
+// loadModels loads a single model on its own, so that it needs no name, and anything more as a system
+func loadModels(fsys fs.FS, names []string) (types.Option[fsm.System], fsm.Diagnostics) {
+	if len(names) == 1 {
+		if file, _ := fsm.ParseFS(fsys, names[0]); file == nil || len(file.GetModels()) == 1 {
+			model, diagnostics := fsm.LoadFS(fsys, names[0])
+			if model.IsNone() {
+				return types.None[fsm.System](), diagnostics
+			}
+			machine := model.Get()
+			return types.Some(fsm.NewSystem(&machine)), diagnostics
+		}
+	}
+	return fsm.LoadSystemFS(fsys, names...)
+}
+
+// fileSystemFor opens the working directory and names the files within it, so that included files
+// are reported relative to it. Files outside of the working directory are named from the root instead.
+func fileSystemFor(filenames []string) (fs.FS, []string) {
+	names := make([]string, len(filenames))
+	for i, filename := range filenames {
+		names[i] = path.Clean(filepath.ToSlash(filename))
+		if !fs.ValidPath(names[i]) {
+			return rootFileSystemFor(filenames)
+		}
+	}
+	return os.DirFS("."), names
+}
+
+func rootFileSystemFor(filenames []string) (fs.FS, []string) {
+	names := make([]string, len(filenames))
+	volume := ""
+	for i, filename := range filenames {
+		absolute, err := filepath.Abs(filename)
+		if err != nil {
+			absolute = filename
+		}
+		volume = filepath.VolumeName(absolute)
+		names[i] = strings.TrimPrefix(filepath.ToSlash(absolute[len(volume):]), "/")
+	}
+	return os.DirFS(volume + "/"), names
+}
@@ -0,0 +1,201 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+)
+
+// ErrActorStopped is returned for events fired at an actor whose context was cancelled
+var ErrActorStopped = errors.New("the actor has stopped")
+
+// Change is published by an actor after every event it handled, and after timers that fell due took a transition.
+// Event is empty for timers.
+// Err is the error the model returned for the event.
+type Change struct {
+	Event         string
+	Err           error
+	Mode          mode.Mode
+	Cause         string
+	Configuration fsm.Configuration
+}
+
+// withArguments is a Runnable taking events that carry arguments, a model or a system
+type withArguments interface {
+	FireWith(event string, arguments map[string]any) error
+}
+
+type actorRequest struct {
+	event     string
+	arguments map[string]any
+	inspect   func(model Runnable)
+	reply     chan Change
+}
+
+// Actor owns a model in its own goroutine. Events fired from any goroutine are handled one at a time
+// in the order they arrive, and the timers of the model fall due by the clock of the model, the wall clock by default.
+// The actor stops once its context is cancelled.
+type Actor struct {
+	model       Runnable
+	requests    chan actorRequest
+	done        chan struct{}
+	lock        sync.Mutex
+	subscribers []chan Change
+}
+
+// NewActor starts an actor owning the model, the model must not be used by anything else from then on
+func NewActor(ctx context.Context, model Runnable) *Actor {
+	actor := &Actor{
+		model:    model,
+		requests: make(chan actorRequest),
+		done:     make(chan struct{}),
+	}
+	go actor.run(ctx)
+	return actor
+}
+
+// Fire hands the event to the actor and waits for the change it made
+func (actor *Actor) Fire(ctx context.Context, event string) (Change, error) {
+	return actor.FireWith(ctx, event, nil)
+}
+
+// FireWith is Fire for an event carrying arguments
+func (actor *Actor) FireWith(ctx context.Context, event string, arguments map[string]any) (Change, error) {
+	request := actorRequest{event: event, arguments: arguments, reply: make(chan Change, 1)}
+	if err := actor.send(ctx, request); err != nil {
+		return Change{}, err
+	}
+	select {
+	case change := <-request.reply:
+		return change, nil
+	case <-ctx.Done():
+		// the event is handled all the same
+		return Change{}, ctx.Err()
+	}
+}
+
+// Inspect runs f with the model in between the events, f must not keep the model
+func (actor *Actor) Inspect(ctx context.Context, f func(model Runnable)) error {
+	request := actorRequest{inspect: f, reply: make(chan Change, 1)}
+	if err := actor.send(ctx, request); err != nil {
+		return err
+	}
+	select {
+	case <-request.reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe returns a channel receiving every change from now on. A subscriber falling more than buffer changes behind
+// misses changes rather than holding up the actor. The channel is closed when the actor stops.
+func (actor *Actor) Subscribe(buffer int) <-chan Change {
+	changes := make(chan Change, buffer)
+	actor.lock.Lock()
+	defer actor.lock.Unlock()
+	select {
+	case <-actor.done:
+		close(changes)
+	default:
+		actor.subscribers = append(actor.subscribers, changes)
+	}
+	return changes
+}
+
+// Done is closed once the actor has stopped
+func (actor *Actor) Done() <-chan struct{} {
+	return actor.done
+}
+
+func (actor *Actor) send(ctx context.Context, request actorRequest) error {
+	select {
+	case actor.requests <- request:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-actor.done:
+		return ErrActorStopped
+	}
+}
+
+func (actor *Actor) run(ctx context.Context) {
+	defer actor.stop()
+	timed, isTimed := actor.model.(Timed)
+	for {
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if isTimed {
+			timed.GetNextTimeout().HasValue(func(due time.Time) {
+				// the due time is read on the clock of the model, which need not be the wall clock
+				timer = time.NewTimer(due.Sub(timed.GetClock().Now()))
+				timeout = timer.C
+			})
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case request := <-actor.requests:
+			if request.inspect != nil {
+				request.inspect(actor.model)
+				request.reply <- Change{}
+				break
+			}
+			var err error
+			if model, ok := actor.model.(withArguments); ok {
+				err = model.FireWith(request.event, request.arguments)
+			} else {
+				err = actor.model.Fire(request.event)
+			}
+			change := actor.change(request.event)
+			change.Err = err
+			request.reply <- change
+			actor.publish(change)
+		case <-timeout:
+			if timed.Tick() {
+				actor.publish(actor.change(""))
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (actor *Actor) change(event string) Change {
+	return Change{
+		Event:         event,
+		Mode:          actor.model.GetMode(),
+		Cause:         actor.model.GetCause(),
+		Configuration: actor.model.GetConfiguration(),
+	}
+}
+
+func (actor *Actor) publish(change Change) {
+	actor.lock.Lock()
+	defer actor.lock.Unlock()
+	for _, subscriber := range actor.subscribers {
+		select {
+		case subscriber <- change:
+		default:
+		}
+	}
+}
+
+// stop closes the subscriptions, Subscribe hands out closed channels from then on
+func (actor *Actor) stop() {
+	actor.lock.Lock()
+	defer actor.lock.Unlock()
+	close(actor.done)
+	for _, subscriber := range actor.subscribers {
+		close(subscriber)
+	}
+	actor.subscribers = nil
+}
@@ -2,6 +2,7 @@ package runners
 
 import (
 	"math/rand"
+	"time"
 
 	"github.com/Wafl97/go_aml/fsm"
 	"github.com/Wafl97/go_aml/fsm/mode"
@@ -9,48 +10,143 @@ import (
 	"github.com/Wafl97/go_aml/util/types"
 )
 
+// Runnable is what the runners drive, a single model or a system of models
+type Runnable interface {
+	Fire(event string) error
+	GetMode() mode.Mode
+	GetCause() string
+	GetConfiguration() fsm.Configuration
+	GetActiveTriggers() []string
+	GetRegisteredStates() []string
+}
+
+// Timed is a Runnable with timed transitions, RunAsRandom drives them with a virtual clock.
+// Tick reports whether a timed transition was taken.
+type Timed interface {
+	SetClock(clock fsm.Clock)
+	GetClock() fsm.Clock
+	GetNextTimeout() types.Option[time.Time]
+	Tick() bool
+}
+
+// Queued is a Runnable that raises events, the steps taken for them are counted apart from the fired events
+type Queued interface {
+	GetInternalSteps() int
+}
+
+// Summary of a run. ExternalSteps counts the fired events and timers, InternalSteps the raised events handled for them.
+// Seed is the seed of the random choices, None when they were made from a given source, see RandomOptions.
+// Path holds the initial configuration and the one after every step that let the model continue, Trace every step taken.
 type Summary struct {
-	Path          []string
+	Seed          types.Option[int64]
+	Path          []fsm.Configuration
+	Trace         Trace
 	Occurences    map[string]int
-	DeadlockState types.Option[string]
+	DeadlockState types.Option[fsm.Configuration]
+	ExternalSteps int
+	InternalSteps int
+}
+
+// RandomOptions configure RunAsRandomWith. The choices are made from Source, or else from a source seeded by Seed,
+// or else from one seeded by the clock. Strategy defaults to NewUniform.
+// A run is replayed exactly by running the same model with the seed recorded in its summary.
+type RandomOptions struct {
+	Iterations int
+	Seed       types.Option[int64]
+	Source     rand.Source
+	Strategy   Strategy
 }
 
-func RunAsRandom(fsm *fsm.FiniteStateMachine, iterations int) Summary {
+// RunAsRandom fires random active triggers. Letting the next timer fall due is one more choice,
+// the virtual clock jumps ahead to it so that no time is spent waiting.
+func RunAsRandom(model Runnable, iterations int) Summary {
+	return RunAsRandomWith(model, RandomOptions{Iterations: iterations})
+}
+
+// RunAsRandomWith is RunAsRandom with the randomness and the strategy given by the options.
+// The model is given back its own clock once the run is done.
+func RunAsRandomWith(model Runnable, options RandomOptions) Summary {
+	iterations := options.Iterations
+	seed := types.None[int64]()
+	source := options.Source
+	if source == nil {
+		seed = types.Some(options.Seed.GetOrElse(time.Now().UnixNano()))
+		source = rand.NewSource(seed.Get())
+	}
+	random := rand.New(source)
+	strategy := options.Strategy
+	if strategy == nil {
+		strategy = NewUniform()
+	}
+	if stateful, isStateful := strategy.(Stateful); isStateful {
+		stateful.Reset()
+	}
 	summary := Summary{
-		Path:          make([]string, iterations),
-		Occurences:    make(map[string]int, len(fsm.GetRegisteredStates())),
-		DeadlockState: types.None[string](),
+		Seed:          seed,
+		Path:          make([]fsm.Configuration, 0, iterations),
+		Occurences:    make(map[string]int, len(model.GetRegisteredStates())),
+		DeadlockState: types.None[fsm.Configuration](),
 	}
-	currentState := fsm.GetCurrentState().Get()
-	summary.Path = append(summary.Path, currentState.GetName())
-	summary.Occurences[currentState.GetName()] = 1
+	configuration := model.GetConfiguration()
+	summary.Path = append(summary.Path, configuration)
+	summary.Occurences[configuration.String()] = 1
 	log := logger.New("RANDOM WRAPPER")
 	log.Infof("Running for %d iterations", iterations)
+	clock := fsm.NewVirtualClock()
+	timed, isTimed := model.(Timed)
+	if isTimed {
+		// the clock of the model is given back once the run is done, its timers start over by it
+		defer timed.SetClock(timed.GetClock())
+		timed.SetClock(clock)
+	}
+	queued, isQueued := model.(Queued)
+	recorder := newRecorder(model)
+	defer recorder.release()
 	for i := 1; i < iterations; i++ {
 		//time.Sleep(time.Duration(5) * time.Millisecond)
-		arr := currentState.GetEdgeTriggers()
+		arr := model.GetActiveTriggers()
+		timeout := types.None[time.Time]()
+		if isTimed {
+			timeout = timed.GetNextTimeout()
+		}
+		choices := arr
+		if timeout.IsSome() {
+			choices = append(append([]string{}, arr...), NEXT_TIMER)
+		}
 		var currentMode mode.Mode
-		if len(arr) > 0 {
-			randomChoise := arr[rand.Intn(len(arr))]
-			fsm.Fire(randomChoise)
-			currentMode = fsm.GetMode()
+		if len(choices) > 0 {
+			choice := choices[strategy.Choose(choices, random)]
+			step := recorder.record(choice, func() {
+				if choice != NEXT_TIMER {
+					model.Fire(choice)
+					return
+				}
+				clock.AdvanceTo(timeout.Get())
+				timed.Tick()
+			})
+			summary.Trace = append(summary.Trace, step)
+			summary.ExternalSteps++
+			if isQueued {
+				summary.InternalSteps += queued.GetInternalSteps()
+			}
+			currentMode = model.GetMode()
 		} else {
 			currentMode = mode.DEADLOCK
 		}
 		switch currentMode {
 		case mode.CONTINUE:
-			currentState = fsm.GetCurrentState().Get()
-			summary.Path[i] = currentState.GetName()
-			summary.Occurences[currentState.GetName()] += 1
+			configuration = model.GetConfiguration()
+			summary.Path = append(summary.Path, configuration)
+			summary.Occurences[configuration.String()] += 1
 		case mode.CRASH:
-			log.Errorf("Model crashed. Cause: %s", fsm.GetCause())
+			log.Errorf("Model crashed. Cause: %s", model.GetCause())
 			return summary
 		case mode.DEADLOCK:
 			log.Error("Deadlock! Exiting ...")
-			summary.DeadlockState = types.Some(fsm.GetCurrentState().Get().GetName())
+			summary.DeadlockState = types.Some(model.GetConfiguration())
 			return summary
 		case mode.TERMINATE:
-			log.Infof("Model terminated in state %s", fsm.GetCurrentState().Get().GetName())
+			log.Infof("Model terminated in %s", model.GetConfiguration())
 			return summary
 		}
 	}
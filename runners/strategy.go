@@ -0,0 +1,85 @@
+package runners
+
+import "math/rand"
+
+// NEXT_TIMER is the choice of letting the next timer fall due, it is offered to a strategy after the active triggers
+const NEXT_TIMER = "<timer>"
+
+// Strategy picks the index of the next choice of a random run, the choices are never empty.
+// All randomness must come from random, so that the run is replayed by its seed.
+type Strategy interface {
+	Choose(choices []string, random *rand.Rand) int
+}
+
+// Stateful is a strategy that remembers its earlier choices, RunAsRandomWith resets it before every run
+// so that a run does not depend on the runs before it
+type Stateful interface {
+	Strategy
+	Reset()
+}
+
+type uniform struct{}
+
+// NewUniform returns the strategy picking every choice with the same chance, the default of RunAsRandom
+func NewUniform() Strategy {
+	return uniform{}
+}
+
+func (uniform) Choose(choices []string, random *rand.Rand) int {
+	return random.Intn(len(choices))
+}
+
+type weighted struct {
+	weights map[string]float64
+}
+
+// NewWeighted returns the strategy picking the choices in proportion to their weights, a choice without a weight weighs 1.
+// When every choice weighs nothing they are picked with the same chance.
+func NewWeighted(weights map[string]float64) Strategy {
+	return weighted{weights: weights}
+}
+
+func (strategy weighted) Choose(choices []string, random *rand.Rand) int {
+	total := 0.0
+	weights := make([]float64, len(choices))
+	for i, choice := range choices {
+		weight, given := strategy.weights[choice]
+		if !given {
+			weight = 1
+		}
+		weights[i] = max(weight, 0)
+		total += weights[i]
+	}
+	if total == 0 {
+		return random.Intn(len(choices))
+	}
+	pick := random.Float64() * total
+	for i, weight := range weights {
+		if pick < weight {
+			return i
+		}
+		pick -= weight
+	}
+	return len(choices) - 1
+}
+
+type roundRobin struct {
+	next int
+}
+
+// NewRoundRobin returns the strategy taking the choices in turn by their position: the first choice, then the second
+// and so on, starting over after the last. The position carries over from one step to the next and wraps around
+// when there are fewer choices. It uses no randomness, and RunAsRandomWith starts it over for every run.
+func NewRoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+func (strategy *roundRobin) Choose(choices []string, random *rand.Rand) int {
+	choice := strategy.next % len(choices)
+	strategy.next = choice + 1
+	return choice
+}
+
+func (strategy *roundRobin) Reset() {
+	strategy.next = 0
+}
@@ -0,0 +1,197 @@
+package runners
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/Wafl97/go_aml/fsm"
+	"github.com/Wafl97/go_aml/fsm/mode"
+	"github.com/Wafl97/go_aml/util/functions"
+)
+
+// GuardResult is the outcome of a guard checked during a step
+type GuardResult struct {
+	State string `json:"state"`
+	Guard string `json:"guard"`
+	Holds bool   `json:"holds"`
+}
+
+// VariableChange is a variable a step changed
+type VariableChange struct {
+	Name   string `json:"name"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// Step is an event fired at a model, or NEXT_TIMER for the next timer falling due. Source and Target are the active states
+// before and after it, the guards and the changes are left empty for models that cannot be observed.
+type Step struct {
+	Event   string            `json:"event"`
+	Source  fsm.Configuration `json:"source"`
+	Target  fsm.Configuration `json:"target"`
+	Mode    mode.Mode         `json:"mode"`
+	Guards  []GuardResult     `json:"guards,omitempty"`
+	Changes []VariableChange  `json:"changes,omitempty"`
+}
+
+// Trace is the steps of a run in order, written as JSON Lines with one step per line
+type Trace []Step
+
+// Observable is a Runnable whose steps are recorded in full, a model or a system.
+// Observe returns the function unregistering the observer.
+type Observable interface {
+	Observe(hook fsm.Hook, observer functions.Consumer[fsm.Observation]) func()
+}
+
+// WriteTo writes the trace as JSON Lines
+func (trace Trace) WriteTo(writer io.Writer) (int64, error) {
+	written := int64(0)
+	for _, step := range trace {
+		line, err := json.Marshal(step)
+		if err != nil {
+			return written, err
+		}
+		n, err := writer.Write(append(line, '\n'))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadTrace reads a trace written as JSON Lines
+func ReadTrace(reader io.Reader) (Trace, error) {
+	trace := Trace{}
+	decoder := json.NewDecoder(reader)
+	for {
+		var step Step
+		err := decoder.Decode(&step)
+		if errors.Is(err, io.EOF) {
+			return trace, nil
+		}
+		if err != nil {
+			return trace, fmt.Errorf("bad trace at step %d, %s", len(trace), err.Error())
+		}
+		trace = append(trace, step)
+	}
+}
+
+// Divergence is returned by Replay for the first step the model took differently than the trace
+type Divergence struct {
+	Index    int
+	Expected Step
+	Actual   Step
+}
+
+func (divergence *Divergence) Error() string {
+	expected, actual := divergence.Expected, divergence.Actual
+	var what string
+	switch {
+	case !reflect.DeepEqual(expected.Source, actual.Source):
+		what = fmt.Sprintf("it was in %s instead of %s", actual.Source, expected.Source)
+	case !reflect.DeepEqual(expected.Target, actual.Target):
+		what = fmt.Sprintf("it went to %s instead of %s", actual.Target, expected.Target)
+	case expected.Mode != actual.Mode:
+		what = fmt.Sprintf("its mode was %d instead of %d", actual.Mode, expected.Mode)
+	case !reflect.DeepEqual(expected.Guards, actual.Guards):
+		what = fmt.Sprintf("the guards were %v instead of %v", actual.Guards, expected.Guards)
+	default:
+		what = fmt.Sprintf("the changes were %v instead of %v", actual.Changes, expected.Changes)
+	}
+	return fmt.Sprintf("step %d on %s diverges, %s", divergence.Index, expected.Event, what)
+}
+
+// Replay fires the events of the trace at the model, which must be where the trace began, and compares every step.
+// Timers fall due by a virtual clock as they do in RunAsRandom, the model is given back its own clock afterwards. It returns the first *Divergence, nil when there is none.
+func Replay(model Runnable, trace Trace) error {
+	recorder := newRecorder(model)
+	defer recorder.release()
+	clock := fsm.NewVirtualClock()
+	timed, isTimed := model.(Timed)
+	if isTimed {
+		defer timed.SetClock(timed.GetClock())
+		timed.SetClock(clock)
+	}
+	for i, expected := range trace {
+		actual := recorder.record(expected.Event, func() {
+			if expected.Event != NEXT_TIMER {
+				model.Fire(expected.Event)
+				return
+			}
+			if isTimed {
+				timed.GetNextTimeout().HasValue(clock.AdvanceTo)
+				timed.Tick()
+			}
+		})
+		if !sameStep(expected, actual) {
+			return &Divergence{Index: i, Expected: expected, Actual: actual}
+		}
+	}
+	return nil
+}
+
+// sameStep compares the steps as they read in JSON, so that a step read from a trace matches the one recorded
+func sameStep(expected, actual Step) bool {
+	expectedLine, expectedErr := json.Marshal(expected)
+	actualLine, actualErr := json.Marshal(actual)
+	return expectedErr == nil && actualErr == nil && string(expectedLine) == string(actualLine)
+}
+
+// recorder observes the model while a step is recorded, release unregisters its observers once the run is done
+type recorder struct {
+	model      Runnable
+	step       *Step
+	unobserves []func()
+}
+
+func newRecorder(model Runnable) *recorder {
+	recorder := &recorder{model: model}
+	observable, isObservable := model.(Observable)
+	if !isObservable {
+		return recorder
+	}
+	guards := observable.Observe(fsm.GUARD_EVALUATED, func(observation fsm.Observation) {
+		if recorder.step == nil {
+			return
+		}
+		recorder.step.Guards = append(recorder.step.Guards, GuardResult{
+			State: observation.Source.Get().GetName(),
+			Guard: observation.Edge.Get().GetGuard(),
+			Holds: observation.Holds,
+		})
+	})
+	changes := observable.Observe(fsm.VARIABLE_CHANGED, func(observation fsm.Observation) {
+		if recorder.step == nil {
+			return
+		}
+		recorder.step.Changes = append(recorder.step.Changes, VariableChange{
+			Name:   observation.Variable,
+			Before: observation.Before.Get(observation.Variable),
+			After:  observation.After.Get(observation.Variable),
+		})
+	})
+	recorder.unobserves = []func(){guards, changes}
+	return recorder
+}
+
+func (recorder *recorder) release() {
+	for _, unobserve := range recorder.unobserves {
+		unobserve()
+	}
+	recorder.unobserves = nil
+}
+
+// record takes the step made by fire on the event
+func (recorder *recorder) record(event string, fire func()) Step {
+	step := Step{Event: event, Source: recorder.model.GetConfiguration()}
+	recorder.step = &step
+	fire()
+	recorder.step = nil
+	step.Target = recorder.model.GetConfiguration()
+	step.Mode = recorder.model.GetMode()
+	return step
+}
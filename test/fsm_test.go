@@ -39,7 +39,7 @@ func TestFSM(t *testing.T) {
 			})
 		},
 	).Initial(STATE_1)
-	sm := smb.Build()
+	sm, _ := smb.Build()
 	if sm.GetModelName() != MODEL_NAME {
 		t.Fail()
 	}
@@ -142,12 +142,15 @@ func TestFullModel(t *testing.T) {
 		}).
 		Initial("S1")
 
-	tm := tmb.Build()
+	tm, err := tmb.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	sum := runners.RunAsRandom(&tm, 1000)
 	log.Infof("Path: %v", sum.Path)
 	log.Infof("Occurences: %v", sum.Occurences)
-	sum.DeadlockState.HasValue(func(s string) {
+	sum.DeadlockState.HasValue(func(s fsm.Configuration) {
 		log.Infof("Deadlock State: %v", s)
 	})
 }